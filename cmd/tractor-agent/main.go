@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/manifold/qtalk/golang/mux"
 	"github.com/manifold/tractor/pkg/agent"
 	"github.com/manifold/tractor/pkg/agent/console"
+	"github.com/manifold/tractor/pkg/agent/dashboard"
 	"github.com/manifold/tractor/pkg/agent/rpc"
 	"github.com/manifold/tractor/pkg/agent/selfdev"
 	"github.com/manifold/tractor/pkg/agent/systray"
@@ -27,11 +29,29 @@ var (
 
 	tractorUserPath string
 	devMode         bool
+	gatewayAddr     string
+	headless        bool
+	dashboardAddr   string
+
+	// flags overriding the config file, applied only when set
+	watchInterval     time.Duration
+	consoleBufferSize int64
+	studioURL         string
+	stopTimeout       time.Duration
 )
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&devMode, "dev", "d", false, "run in debug mode")
 	rootCmd.PersistentFlags().StringVarP(&tractorUserPath, "path", "p", "", "path to the user tractor directory (default is ~/.tractor)")
+	rootCmd.PersistentFlags().StringVar(&gatewayAddr, "gateway", "", "address to serve the HTTP JSON gateway on, such as localhost:4242")
+	rootCmd.PersistentFlags().BoolVar(&headless, "headless", false, "run without the system tray, serving a web dashboard instead")
+	rootCmd.PersistentFlags().StringVar(&dashboardAddr, "dashboard", "localhost:4280", "address to serve the web dashboard on when headless")
+
+	defaults := agent.DefaultConfig()
+	rootCmd.PersistentFlags().DurationVar(&watchInterval, "watch-interval", time.Duration(defaults.WatchInterval), "how often workspaces are checked for changes (overrides config)")
+	rootCmd.PersistentFlags().Int64Var(&consoleBufferSize, "console-buffer-size", defaults.ConsoleBufferSize, "bytes of console output kept per workspace (overrides config)")
+	rootCmd.PersistentFlags().StringVar(&studioURL, "studio-url", defaults.StudioURL, "URL Studio is served at (overrides config)")
+	rootCmd.PersistentFlags().DurationVar(&stopTimeout, "stop-timeout", time.Duration(defaults.StopTimeout), "how long workspaces have to exit before being killed (overrides config)")
 }
 
 func main() {
@@ -44,8 +64,12 @@ func runAgent(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if !subprocess.Available {
+		headless = true
+	}
+
 	ctx := context.Background()
-	ag := openAgent()
+	ag := openAgent(cmd)
 
 	if agentSockExists(ag) && devMode {
 		fmt.Println("Agent will not run in dev mode if agent socket exists.")
@@ -60,8 +84,12 @@ func services(a *agent.Agent) []daemon.Service {
 	services := []daemon.Service{
 		a,
 		a.Console,
-		&systray.Service{},
-		&rpc.Service{},
+		&rpc.Service{GatewayAddr: gatewayAddr},
+	}
+	if headless {
+		services = append(services, &dashboard.Service{Addr: dashboardAddr})
+	} else {
+		services = append(services, &systray.Service{})
 	}
 	if devMode {
 		services = append(services, []daemon.Service{
@@ -71,12 +99,32 @@ func services(a *agent.Agent) []daemon.Service {
 	return services
 }
 
-func openAgent() *agent.Agent {
-	ag, err := agent.Open(tractorUserPath, console.New(), devMode)
+func openAgent(cmd *cobra.Command) *agent.Agent {
+	ag, err := agent.Open(tractorUserPath, console.New(), devMode, configOverrides(cmd))
 	fatal(err)
 	return ag
 }
 
+// configOverrides returns a config override applying the config flags that
+// were set.
+func configOverrides(cmd *cobra.Command) func(*agent.Config) {
+	return func(c *agent.Config) {
+		flags := cmd.Flags()
+		if flags.Changed("watch-interval") {
+			c.WatchInterval = agent.Duration(watchInterval)
+		}
+		if flags.Changed("console-buffer-size") {
+			c.ConsoleBufferSize = consoleBufferSize
+		}
+		if flags.Changed("studio-url") {
+			c.StudioURL = studioURL
+		}
+		if flags.Changed("stop-timeout") {
+			c.StopTimeout = agent.Duration(stopTimeout)
+		}
+	}
+}
+
 func agentSockExists(ag *agent.Agent) bool {
 	_, err := mux.DialUnix(ag.SocketPath)
 	if err != nil {
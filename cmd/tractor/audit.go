@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type auditParams struct {
+	Since time.Time
+	Until time.Time
+	Path  string
+	Limit int
+}
+
+type auditEntry struct {
+	Time   time.Time   `msgpack:"time"`
+	Caller string      `msgpack:"caller"`
+	Method string      `msgpack:"method"`
+	Path   string      `msgpack:"path"`
+	Field  string      `msgpack:"field"`
+	Old    interface{} `msgpack:"old"`
+	New    interface{} `msgpack:"new"`
+	Error  string      `msgpack:"error"`
+}
+
+// `tractor audit` command
+func auditCmd() *cobra.Command {
+	var since, until, path string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Shows the audit log of a workspace",
+		Long:  "Shows calls that changed a workspace and the object changes they made, oldest first.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			params := auditParams{Path: path, Limit: limit}
+			var err error
+			params.Since, err = parseTime(since)
+			fatal(err)
+			params.Until, err = parseTime(until)
+			fatal(err)
+
+			client := workspaceClient()
+			var entries []auditEntry
+			_, err = client.Call("auditLog", params, &entries)
+			fatal(err)
+
+			for _, e := range entries {
+				caller := e.Caller
+				if caller == "" {
+					caller = "-"
+				}
+				ts := e.Time.Local().Format(time.RFC3339)
+				switch {
+				case e.Field != "":
+					fmt.Printf("%s %s %s %s/%s: %v -> %v\n", ts, caller, e.Method, e.Path, e.Field, e.Old, e.New)
+				case e.Error != "":
+					fmt.Printf("%s %s call %s %s failed: %s\n", ts, caller, e.Method, e.Path, e.Error)
+				default:
+					fmt.Printf("%s %s call %s %s\n", ts, caller, e.Method, e.Path)
+				}
+			}
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "", "show entries after a time (RFC3339) or duration ago (e.g. 1h)")
+	cmd.Flags().StringVar(&until, "until", "", "show entries before a time (RFC3339) or duration ago")
+	cmd.Flags().StringVar(&path, "object", "", "only show entries for an object path and its descendants")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "only show the most recent entries")
+	workspaceFlags(cmd)
+	return cmd
+}
+
+// parseTime parses an RFC3339 time or a duration before now. An empty
+// string is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
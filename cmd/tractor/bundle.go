@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	workspacePath string
+)
+
+type importNodeParams struct {
+	ID     string
+	Bundle []byte
+}
+
+type importNodeResult struct {
+	ID      string
+	Path    string
+	Missing []string
+	Pending []string
+}
+
+// `tractor export` command
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <path>",
+		Short: "Exports a subtree of a workspace as a bundle",
+		Long:  "Exports an object, its descendants and their delegate packages as a bundle written to STDOUT.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := workspaceClient()
+			var bundle []byte
+			_, err := client.Call("exportNode", args[0], &bundle)
+			fatal(err)
+			_, err = os.Stdout.Write(bundle)
+			fatal(err)
+		},
+	}
+	workspaceFlags(cmd)
+	return cmd
+}
+
+// `tractor import` command
+func importCmd() *cobra.Command {
+	var parentID string
+	cmd := &cobra.Command{
+		Use:   "import [bundle]",
+		Short: "Imports a bundle into a workspace",
+		Long:  "Imports a bundle created with export, read from the given file or STDIN, into a workspace.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var bundle []byte
+			var err error
+			if len(args) > 0 {
+				bundle, err = ioutil.ReadFile(args[0])
+			} else {
+				bundle, err = ioutil.ReadAll(os.Stdin)
+			}
+			fatal(err)
+
+			client := workspaceClient()
+			var result importNodeResult
+			_, err = client.Call("importNode", importNodeParams{
+				ID:     parentID,
+				Bundle: bundle,
+			}, &result)
+			fatal(err)
+
+			fmt.Printf("imported %s (%s)\n", result.Path, result.ID)
+			for _, name := range result.Missing {
+				fmt.Printf("missing component type: %s\n", name)
+			}
+			if len(result.Pending) > 0 {
+				fmt.Printf("%d delegate component(s) available after the workspace recompiles\n", len(result.Pending))
+			}
+			if len(result.Missing) > 0 {
+				os.Exit(2)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&parentID, "parent", "", "ID of the object to import under (default is the root)")
+	workspaceFlags(cmd)
+	return cmd
+}
+
+func workspaceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&workspacePath, "workspace", "w", ".", "workspace name or path")
+	cmd.Flags().StringVarP(&tractorUserPath, "path", "p", "", "path to the user tractor directory (default is ~/.tractor)")
+}
+
+// workspaceClient returns a QRPC client for the daemon of the workspace
+// selected with the --workspace flag.
+func workspaceClient() *qrpc.Client {
+	path := workspacePath
+	if _, err := os.Stat(path); err == nil {
+		path, err = filepath.Abs(path)
+		fatal(err)
+	}
+	ws := openAgent().Workspace(path)
+	if ws == nil {
+		fatal(fmt.Errorf("no workspace found for %q", workspacePath))
+	}
+	sess, err := mux.DialUnix(ws.SocketPath)
+	fatal(err)
+	client := &qrpc.Client{Session: sess}
+	_, err = client.Call("authenticate", ws.Token, nil)
+	fatal(err)
+	return client
+}
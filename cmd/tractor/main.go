@@ -25,11 +25,20 @@ var (
 )
 
 func main() {
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		// cobra has printed the usage error
+		os.Exit(2)
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(agentCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(auditCmd())
+	rootCmd.AddCommand(replCmd())
+	rootCmd.AddCommand(searchCmd())
+	rootCmd.AddCommand(workspaceCmd())
 
 	ct, cancelFunc := context.WithCancel(context.Background())
 	sigQuit = ct
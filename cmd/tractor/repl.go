@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// `tractor repl` command
+func replCmd() *cobra.Command {
+	var session string
+	cmd := &cobra.Command{
+		Use:   "repl [workspace]",
+		Short: "Opens a REPL in a running workspace",
+		Long:  "Opens a REPL that evaluates Go expressions in a running workspace, with Root and Selected, the node selected in a studio session, in scope.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				workspacePath = args[0]
+			}
+			client := workspaceClient()
+			resp, err := client.Call("repl", session, nil)
+			fatal(err)
+			if !resp.Hijacked {
+				fatal(fmt.Errorf("workspace did not open a repl"))
+			}
+
+			go func() {
+				io.Copy(resp.Channel, os.Stdin)
+				resp.Channel.Close()
+			}()
+			go func() {
+				<-sigQuit.Done()
+				resp.Channel.Close()
+			}()
+			_, err = io.Copy(os.Stdout, resp.Channel)
+			resp.Channel.Close()
+			if err != nil && err != io.EOF {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Println()
+		},
+	}
+	workspaceFlags(cmd)
+	cmd.Flags().StringVar(&session, "session", "", "key of the session whose selected node is Selected")
+	return cmd
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type searchParams struct {
+	Query string
+	Limit int
+}
+
+type searchResult struct {
+	ID      string        `msgpack:"id"`
+	Path    string        `msgpack:"path"`
+	Score   int           `msgpack:"score"`
+	Matches []searchMatch `msgpack:"matches"`
+}
+
+type searchMatch struct {
+	Kind       string   `msgpack:"kind"`
+	Snippet    string   `msgpack:"snippet"`
+	Highlights [][2]int `msgpack:"highlights"`
+}
+
+// `tractor search` command
+func searchCmd() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "search <query>...",
+		Short: "Searches the objects of a workspace",
+		Long:  "Searches object names, attributes, component types and field values for objects matching every term, best first.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := workspaceClient()
+			var results []searchResult
+			_, err := client.Call("search", searchParams{Query: strings.Join(args, " "), Limit: limit}, &results)
+			fatal(err)
+
+			mark := bracketMark
+			if isTerminal(os.Stdout) {
+				mark = boldMark
+			}
+			for _, r := range results {
+				fmt.Println(r.Path)
+				for _, m := range r.Matches {
+					fmt.Printf("  %-9s %s\n", m.Kind, highlight(m.Snippet, m.Highlights, mark))
+				}
+			}
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "show at most this many results (default 50)")
+	workspaceFlags(cmd)
+	return cmd
+}
+
+func bracketMark(s string) string {
+	return "[" + s + "]"
+}
+
+func boldMark(s string) string {
+	return "\x1b[1m" + s + "\x1b[0m"
+}
+
+// highlight marks the byte ranges of s.
+func highlight(s string, spans [][2]int, mark func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[0] < last || span[1] > len(s) {
+			continue
+		}
+		b.WriteString(s[last:span[0]])
+		b.WriteString(mark(s[span[0]:span[1]]))
+		last = span[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
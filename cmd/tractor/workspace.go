@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/agent"
+	agentrpc "github.com/manifold/tractor/pkg/agent/rpc"
+	"github.com/skratchdot/open-golang/open"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the workspace commands.
+const (
+	exitError      = 1 // the command failed, 2 is for usage errors
+	exitNotRunning = 3 // status: the workspace isn't running
+	exitNotFound   = 4 // no workspace has the name
+)
+
+var jsonOutput bool
+
+type workspaceInfo struct {
+	Name    string   `json:"name" msgpack:"name"`
+	Path    string   `json:"path" msgpack:"path"`
+	Status  string   `json:"status" msgpack:"status"`
+	Pipes   int      `json:"pipes" msgpack:"pipes"`
+	Written int64    `json:"written" msgpack:"written"`
+	Output  []string `json:"output,omitempty" msgpack:"output"`
+	// StudioURL opens the workspace in Studio.
+	StudioURL string `json:"studioURL,omitempty" msgpack:"studioURL"`
+	// BuildError is set when a created workspace failed to build.
+	BuildError string `json:"buildError,omitempty" msgpack:"buildError"`
+}
+
+type createParams struct {
+	Path string
+	Name string
+}
+
+type logsParams struct {
+	Name   string
+	Follow bool
+	Since  time.Time
+	Run    int
+}
+
+// `tractor workspace` command
+func workspaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "workspace",
+		Aliases: []string{"ws"},
+		Short:   "Manages the workspaces of the agent",
+		Long:    "Manages the workspaces of the running agent over its QRPC socket.",
+	}
+	cmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "print JSON instead of text")
+	cmd.PersistentFlags().StringVarP(&tractorUserPath, "path", "p", "", "path to the user tractor directory (default is ~/.tractor)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the workspaces",
+		Long:  "Lists the workspaces linked to the agent and their status.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			infos, err := listWorkspaces(agentClient())
+			exitOn(err)
+			if jsonOutput {
+				printJSON(infos)
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTATUS\tPATH")
+			for _, info := range infos {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", info.Name, info.Status, info.Path)
+			}
+			w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "new <path> [name]",
+		Short: "Creates a workspace",
+		Long:  "Creates a workspace at the path from the workspace template and links it to the agent, named after the directory unless a name is given.",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := filepath.Abs(args[0])
+			exitOn(err)
+			params := createParams{Path: path}
+			if len(args) > 1 {
+				params.Name = args[1]
+			}
+			var info workspaceInfo
+			_, err = agentClient().Call("create", params, &info)
+			exitOn(err)
+			printInfo(info, fmt.Sprintf("workspace %q created at %s", info.Name, info.Path))
+			if info.BuildError != "" {
+				exitOn(fmt.Errorf("workspace %q failed to build: %s", info.Name, info.BuildError))
+			}
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "start <name>",
+		Short: "Starts a workspace",
+		Long:  "Starts a workspace if it isn't running.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			if info.Status != "Available" {
+				info = callWorkspace(client, "start", info.Name)
+			}
+			printInfo(info, fmt.Sprintf("workspace %q started", info.Name))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stop <name>",
+		Short: "Stops a workspace",
+		Long:  "Stops a workspace.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			info = callWorkspace(client, "stop", info.Name)
+			printInfo(info, fmt.Sprintf("workspace %q stopped", info.Name))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "restart <name>",
+		Short: "Restarts a workspace",
+		Long:  "Starts a workspace, restarting it if it is running.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			info = callWorkspace(client, "start", info.Name)
+			printInfo(info, fmt.Sprintf("workspace %q restarted", info.Name))
+		},
+	})
+
+	var (
+		follow   bool
+		since    string
+		run      int
+		previous bool
+	)
+	logsCmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Shows the console output of a workspace",
+		Long: "Shows the recent console output of a workspace, and with -f keeps streaming it until interrupted. " +
+			"With --since, --run or --previous it shows the console log kept on disk instead, which survives restarts.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			params := logsParams{Follow: follow, Run: run}
+			if previous {
+				params.Run = -1
+			}
+			if since != "" {
+				t, err := parseSince(since)
+				exitOn(err)
+				params.Since = t
+			}
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			params.Name = info.Name
+			var out string
+			resp, err := client.Call("logs", params, &out)
+			exitOn(err)
+			if !resp.Hijacked {
+				fmt.Print(out)
+				return
+			}
+			go func() {
+				<-sigQuit.Done()
+				resp.Channel.Close()
+			}()
+			io.Copy(os.Stdout, resp.Channel)
+			resp.Channel.Close()
+		},
+	}
+	logsCmd.Flags().BoolVarP(&follow, "follow", "f", false, "stream output as it is written")
+	logsCmd.Flags().StringVar(&since, "since", "", "show the console log since a time (RFC 3339) or duration ago (such as 10m)")
+	logsCmd.Flags().IntVar(&run, "run", 0, "show the console log of a run of the workspace daemon")
+	logsCmd.Flags().BoolVar(&previous, "previous", false, "show the console log of the run before the last one")
+	cmd.AddCommand(logsCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status <name>",
+		Short: "Shows the status of a workspace",
+		Long:  "Shows the status of a workspace. It exits with status 3 if the workspace isn't running.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			var detail agent.WorkspaceDetail
+			_, err = client.Call("status", info.Name, &detail)
+			exitOn(err)
+			if jsonOutput {
+				printJSON(struct {
+					workspaceInfo
+					Detail agent.WorkspaceDetail `json:"detail"`
+				}{info, detail})
+			} else {
+				fmt.Printf("name:    %s\n", info.Name)
+				fmt.Printf("path:    %s\n", info.Path)
+				fmt.Printf("status:  %s, %s\n", detail.Status, detail.Summary())
+				fmt.Printf("since:   %s\n", detail.Since.Format(time.RFC3339))
+				if detail.State != agent.StateCrashed && detail.State != agent.StateCrashLooping &&
+					(detail.ExitCode != 0 || detail.Signal != "") {
+					if detail.Signal != "" {
+						fmt.Printf("exited:  killed by %s\n", detail.Signal)
+					} else {
+						fmt.Printf("exited:  exit code %d\n", detail.ExitCode)
+					}
+				}
+				build := "ok"
+				if detail.BuildError != "" {
+					build = detail.BuildError
+				}
+				fmt.Printf("build:   %s in %s\n", build, detail.BuildDuration.Round(time.Millisecond))
+				fmt.Printf("console: %d bytes written, %d connected\n", info.Written, info.Pipes)
+				if len(detail.Output) > 0 {
+					fmt.Println("last output before crash looping:")
+					for _, line := range detail.Output {
+						fmt.Println("  " + line)
+					}
+				}
+			}
+			if detail.PID == 0 {
+				os.Exit(exitNotRunning)
+			}
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "open <name>",
+		Short: "Opens a workspace in Studio",
+		Long:  "Opens a workspace in Studio in the default browser. With --json it prints the Studio URL instead.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			info, err := findWorkspaceInfo(agentClient(), args[0])
+			exitOn(err)
+			if info.StudioURL == "" {
+				exitOn(fmt.Errorf("the agent has no Studio URL for workspace %q", info.Name))
+			}
+			if jsonOutput {
+				printJSON(map[string]string{"name": info.Name, "url": info.StudioURL})
+				return
+			}
+			exitOn(open.Start(info.StudioURL))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rollback <name>",
+		Short: "Reverts a workspace to its previous build",
+		Long:  "Reverts a workspace to the binary it ran before its last successful build, restarting it if it is running.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			info = callWorkspace(client, "rollback", info.Name)
+			printInfo(info, fmt.Sprintf("workspace %q rolled back", info.Name))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "unlink <name>",
+		Short: "Unlinks a workspace",
+		Long:  "Stops a workspace and removes it from the agent. Its files are left in place.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := agentClient()
+			info, err := findWorkspaceInfo(client, args[0])
+			exitOn(err)
+			var msg string
+			_, err = client.Call("unlink", info.Name, &msg)
+			exitOn(err)
+			if jsonOutput {
+				printJSON(info)
+				return
+			}
+			fmt.Println(msg)
+		},
+	})
+
+	return cmd
+}
+
+// parseSince parses a time in RFC 3339, or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, use a time like 2020-01-30T15:04:05Z or a duration like 10m", s)
+	}
+	return t, nil
+}
+
+// agentClient returns a QRPC client for the running agent.
+func agentClient() *qrpc.Client {
+	ag := openAgent()
+	if !agentSockExists(ag) {
+		exitOn(fmt.Errorf("agent is not running: no socket at %s", ag.SocketPath))
+	}
+	sess, err := mux.DialUnix(ag.SocketPath)
+	exitOn(err)
+	return &qrpc.Client{Session: sess}
+}
+
+func listWorkspaces(client *qrpc.Client) ([]workspaceInfo, error) {
+	var infos []workspaceInfo
+	_, err := client.Call("list", nil, &infos)
+	return infos, err
+}
+
+// findWorkspaceInfo returns the workspace with the name, or an ErrNotFound
+// error.
+func findWorkspaceInfo(client *qrpc.Client, name string) (workspaceInfo, error) {
+	infos, err := listWorkspaces(client)
+	if err != nil {
+		return workspaceInfo{}, err
+	}
+	for _, info := range infos {
+		if info.Name == name {
+			return info, nil
+		}
+	}
+	return workspaceInfo{}, fmt.Errorf("%w: no workspace named %q", agentrpc.ErrNotFound, name)
+}
+
+// callWorkspace calls a method taking a workspace name and returns the
+// workspace as it is afterwards.
+func callWorkspace(client *qrpc.Client, method, name string) workspaceInfo {
+	var msg string
+	_, err := client.Call(method, name, &msg)
+	exitOn(err)
+	info, err := findWorkspaceInfo(client, name)
+	exitOn(err)
+	return info
+}
+
+func printInfo(info workspaceInfo, msg string) {
+	if jsonOutput {
+		printJSON(info)
+		return
+	}
+	fmt.Println(msg)
+}
+
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	exitOn(err)
+	fmt.Println(string(b))
+}
+
+// exitOn prints err and exits with a code for it, as JSON with --json.
+func exitOn(err error) {
+	if err == nil {
+		return
+	}
+	code := exitError
+	if agentrpc.IsNotFound(err) {
+		code = exitNotFound
+	}
+	if jsonOutput {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Fprintln(os.Stderr, string(b))
+	} else {
+		fmt.Fprintln(os.Stderr, "tractor:", err)
+	}
+	os.Exit(code)
+}
@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -17,6 +18,8 @@ import (
 	"github.com/manifold/tractor/pkg/misc/daemon"
 	"github.com/manifold/tractor/pkg/misc/logging"
 	"github.com/manifold/tractor/pkg/misc/logging/null"
+	"github.com/manifold/tractor/pkg/misc/runlog"
+	"github.com/manifold/tractor/pkg/misc/secret"
 )
 
 // Agent manages multiple workspaces in a directory (default: ~/.tractor).
@@ -26,6 +29,14 @@ type Agent struct {
 	WorkspacesPath       string // ~/.tractor/workspaces
 	WorkspaceSocketsPath string // ~/.tractor/sockets
 	WorkspaceBinPath     string // ~/.tractor/bin
+	WorkspaceKeysPath    string // ~/.tractor/keys
+	WorkspaceTokensPath  string // ~/.tractor/tokens
+	WorkspaceGrantsPath  string // ~/.tractor/grants
+	WorkspaceLogsPath    string // ~/.tractor/logs
+	TokenPath            string // ~/.tractor/agent.token
+	ConfigPath           string // ~/.tractor/config.json
+	Token                string // token HTTP gateway clients present to the agent
+	TemplatePath         string // workspace template new workspaces are created from
 	GoBin                string
 	DevMode              bool
 
@@ -36,11 +47,16 @@ type Agent struct {
 	WorkspacesChanged chan struct{}
 	workspaces        map[string]*Workspace
 	mu                sync.RWMutex
+
+	config    Config
+	overrides []func(*Config)
+	configMu  sync.RWMutex
 }
 
 // Open returns a new agent for the given path. If the given path is empty, a
-// default of ~/.tractor will be used.
-func Open(path string, console *console.Service, devMode bool) (*Agent, error) {
+// default of ~/.tractor will be used. The agent is configured by the config
+// file in the path, changed by overrides such as those from flags.
+func Open(path string, console *console.Service, devMode bool, overrides ...func(*Config)) (*Agent, error) {
 	bin, err := exec.LookPath("go")
 	if err != nil {
 		return nil, err
@@ -54,6 +70,7 @@ func Open(path string, console *console.Service, devMode bool) (*Agent, error) {
 		GoBin:             bin,
 		workspaces:        make(map[string]*Workspace),
 		WorkspacesChanged: make(chan struct{}),
+		overrides:         overrides,
 	}
 
 	if len(a.Path) == 0 {
@@ -64,18 +81,40 @@ func Open(path string, console *console.Service, devMode bool) (*Agent, error) {
 		a.Path = p
 	}
 
+	a.ConfigPath = filepath.Join(a.Path, ConfigFile)
+	if a.config, err = a.loadConfig(); err != nil {
+		return nil, err
+	}
+
 	a.SocketPath = filepath.Join(a.Path, "agent.sock")
-	a.WorkspacesPath = filepath.Join(a.Path, "workspaces")
-	a.WorkspaceBinPath = filepath.Join(a.Path, "bin")
-	a.WorkspaceSocketsPath = filepath.Join(a.Path, "sockets")
+	a.WorkspacesPath = a.config.dir(a.Path, a.config.WorkspacesDir)
+	a.WorkspaceBinPath = a.config.dir(a.Path, a.config.BinDir)
+	a.WorkspaceSocketsPath = a.config.dir(a.Path, a.config.SocketsDir)
+	a.WorkspaceKeysPath = a.config.dir(a.Path, a.config.KeysDir)
+	a.WorkspaceTokensPath = a.config.dir(a.Path, a.config.TokensDir)
+	a.WorkspaceGrantsPath = a.config.dir(a.Path, a.config.GrantsDir)
+	a.WorkspaceLogsPath = a.config.dir(a.Path, a.config.LogsDir)
+	a.TokenPath = filepath.Join(a.Path, "agent.token")
+	a.TemplatePath = defaultTemplatePath()
+	if a.config.TemplateDir != "" {
+		a.TemplatePath = a.config.dir(a.Path, a.config.TemplateDir)
+	}
 	if a.Logger == nil {
 		a.Logger = &null.Logger{}
 	}
 
+	os.MkdirAll(a.Path, 0700)
 	os.MkdirAll(a.WorkspacesPath, 0700)
 	os.MkdirAll(a.WorkspaceSocketsPath, 0700)
 	os.MkdirAll(a.WorkspaceBinPath, 0700)
+	os.MkdirAll(a.WorkspaceKeysPath, 0700)
+	os.MkdirAll(a.WorkspaceTokensPath, 0700)
+	os.MkdirAll(a.WorkspaceGrantsPath, 0700)
+	os.MkdirAll(a.WorkspaceLogsPath, 0700)
 
+	if a.Token, err = secret.LoadTokenFile(a.TokenPath); err != nil {
+		return nil, err
+	}
 	return a, nil
 }
 
@@ -168,6 +207,7 @@ func (a *Agent) Workspaces() ([]*Workspace, error) {
 
 	workspaces := make([]*Workspace, 0, len(entries))
 	a.mu.Lock()
+	defer a.mu.Unlock()
 	for _, entry := range entries {
 		if !a.isWorkspaceDir(entry) {
 			continue
@@ -184,10 +224,172 @@ func (a *Agent) Workspaces() ([]*Workspace, error) {
 		}
 		workspaces = append(workspaces, ws)
 	}
-	a.mu.Unlock()
 	return workspaces, nil
 }
 
+// CreateWorkspace scaffolds a new workspace at path from the template,
+// symlinks it into WorkspacesPath as name, or the basename of path if name
+// is empty, and compiles it. If the agent is running, the workspace is
+// started. A workspace that fails to compile is still created and returned
+// with the build error.
+func (a *Agent) CreateWorkspace(path, name string) (*Workspace, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	if err := a.checkNewName(name); err != nil {
+		return nil, err
+	}
+	if err := scaffold(a.TemplatePath, path); err != nil {
+		return nil, err
+	}
+	if err := os.Symlink(path, filepath.Join(a.WorkspacesPath, name)); err != nil {
+		return nil, err
+	}
+	ws, err := a.openWorkspace(name)
+	if err != nil {
+		return nil, err
+	}
+	// a workspace that doesn't build is still watched, so it is rebuilt
+	// once it is fixed
+	err = ws.Recompile()
+	a.serve(ws)
+	return ws, err
+}
+
+// UnlinkWorkspace stops a workspace and removes its symlink. The workspace
+// directory and its keys are left, so it can be linked again.
+func (a *Agent) UnlinkWorkspace(name string) error {
+	ws, err := a.namedWorkspace(name)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	delete(a.workspaces, name)
+	a.mu.Unlock()
+	ws.close()
+	ws.removeBuilds()
+	runlog.Remove(ws.LogPath)
+	return os.Remove(ws.SymlinkPath)
+}
+
+// RenameWorkspace changes the name of a workspace, moving the files the
+// agent keeps for it and then its symlink. If a move fails, the moves made
+// are undone and the workspace keeps its name. If the agent is running, the
+// workspace is restarted.
+func (a *Agent) RenameWorkspace(name, newName string) (*Workspace, error) {
+	ws, err := a.namedWorkspace(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkNewName(newName); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	delete(a.workspaces, name)
+	a.mu.Unlock()
+	ws.close()
+	ws.removeBuilds()
+
+	type move struct {
+		from, to string
+		rename   func(from, to string) error
+	}
+	moves := []move{{ws.LogPath, filepath.Join(a.WorkspaceLogsPath, newName+".log"), runlog.Rename}}
+	newPaths := a.credentialPaths(newName)
+	for i, path := range a.credentialPaths(name) {
+		moves = append(moves, move{path, newPaths[i], renameIfExists})
+	}
+	// the symlink is what names the workspace, so it is moved last
+	moves = append(moves, move{ws.SymlinkPath, filepath.Join(a.WorkspacesPath, newName), os.Rename})
+	for i, m := range moves {
+		if err := m.rename(m.from, m.to); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if err := moves[j].rename(moves[j].to, moves[j].from); err != nil {
+					logErr(a.Logger, "[workspace]", name, "unable to undo rename:", err)
+				}
+			}
+			if old, err := a.openWorkspace(name); err == nil {
+				a.serve(old)
+			}
+			return nil, err
+		}
+	}
+	renamed, err := a.openWorkspace(newName)
+	if err != nil {
+		return nil, err
+	}
+	a.serve(renamed)
+	return renamed, nil
+}
+
+func renameIfExists(path, newPath string) error {
+	if err := os.Rename(path, newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// credentialPaths returns the paths of the secret key, token and grants of
+// a workspace. Each is kept in its own directory so they can't be mistaken
+// for those of a workspace with a similar name.
+func (a *Agent) credentialPaths(name string) []string {
+	return []string{
+		filepath.Join(a.WorkspaceKeysPath, name),
+		filepath.Join(a.WorkspaceTokensPath, name),
+		filepath.Join(a.WorkspaceGrantsPath, name+".json"),
+	}
+}
+
+// namedWorkspace returns the workspace linked as name. Unlike Workspace, it
+// never links a new one.
+func (a *Agent) namedWorkspace(name string) (*Workspace, error) {
+	workspaces, err := a.Workspaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ws := range workspaces {
+		if ws.Name == name {
+			return ws, nil
+		}
+	}
+	return nil, fmt.Errorf("no workspace named %q", name)
+}
+
+// checkNewName returns an error if name can't be used for a new workspace.
+func (a *Agent) checkNewName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid workspace name: %q", name)
+	}
+	if _, err := os.Lstat(filepath.Join(a.WorkspacesPath, name)); err == nil {
+		return fmt.Errorf("workspace %q already exists", name)
+	}
+	return nil
+}
+
+func (a *Agent) openWorkspace(name string) (*Workspace, error) {
+	ws, err := OpenWorkspace(a, name)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.workspaces[name] = ws
+	a.mu.Unlock()
+	return ws, nil
+}
+
+// serve runs a workspace added while the agent is running, like the
+// workspaces found when it started.
+func (a *Agent) serve(ws *Workspace) {
+	if a.Daemon == nil || a.Daemon.Context == nil {
+		return
+	}
+	go ws.Serve(a.Daemon.Context)
+}
+
 // Shutdown shuts all workspaces down and cleans up socket files.
 func (a *Agent) Shutdown() {
 	info(a.Logger, "[server] shutting down")
@@ -204,7 +406,11 @@ func (a *Agent) Watch(ctx context.Context) {
 		return
 	}
 	watcher.Add(a.WorkspacesPath)
+	// the config file is watched through its directory since editors
+	// often replace files rather than writing them
+	watcher.Add(a.Path)
 	debounce := Debounce(20 * time.Millisecond)
+	debounceConfig := Debounce(20 * time.Millisecond)
 	for {
 		select {
 		case <-ctx.Done():
@@ -217,6 +423,15 @@ func (a *Agent) Watch(ctx context.Context) {
 			if event.Op&fsnotify.Chmod == fsnotify.Chmod {
 				continue
 			}
+			if filepath.Clean(event.Name) == a.ConfigPath {
+				debounceConfig(func() {
+					a.ReloadConfig()
+				})
+				continue
+			}
+			if filepath.Dir(filepath.Clean(event.Name)) != a.WorkspacesPath {
+				continue
+			}
 
 			debounce(func() {
 				a.WorkspacesChanged <- struct{}{}
@@ -26,6 +26,11 @@ func TestAgent(t *testing.T) {
 		assert.Equal(t, filepath.Join(ag.Path, "agent.sock"), ag.SocketPath)
 		assert.Equal(t, filepath.Join(ag.Path, "workspaces"), ag.WorkspacesPath)
 		assert.Equal(t, filepath.Join(ag.Path, "sockets"), ag.WorkspaceSocketsPath)
+		assert.Equal(t, filepath.Join(ag.Path, "keys"), ag.WorkspaceKeysPath)
+		assert.Equal(t, filepath.Join(ag.Path, "tokens"), ag.WorkspaceTokensPath)
+		assert.Equal(t, filepath.Join(ag.Path, "grants"), ag.WorkspaceGrantsPath)
+		assert.Equal(t, filepath.Join(ag.Path, "agent.token"), ag.TokenPath)
+		assert.Len(t, ag.Token, 64)
 	})
 
 	t.Run("finds workspaces", func(t *testing.T) {
@@ -86,6 +91,75 @@ func TestAgentWorkspaces(t *testing.T) {
 	})
 }
 
+func TestAgentManageWorkspaces(t *testing.T) {
+	// named like the token file of "test" used to be
+	ag, teardown := setup(t, "test.token")
+	defer teardown()
+
+	t.Run("keeps workspace name when renaming fails", func(t *testing.T) {
+		old := ag.Workspace("test")
+		require.NotNil(t, old)
+		// a directory in the way of the token
+		blocked := filepath.Join(ag.WorkspaceTokensPath, "blocked")
+		require.NoError(t, os.MkdirAll(filepath.Join(blocked, "x"), 0700))
+		defer os.RemoveAll(blocked)
+
+		_, err := ag.RenameWorkspace("test", "blocked")
+		assert.Error(t, err)
+		assert.Equal(t, []string{"err", "test", "test.token"}, agentWsNames(ag))
+		_, err = os.Stat(filepath.Join(ag.WorkspaceKeysPath, "blocked"))
+		assert.True(t, os.IsNotExist(err))
+		ws := ag.Workspace("test")
+		require.NotNil(t, ws)
+		assert.Equal(t, old.Token, ws.Token)
+	})
+
+	t.Run("renames workspace and its keys", func(t *testing.T) {
+		old := ag.Workspace("test")
+		require.NotNil(t, old)
+		other := ag.Workspace("test.token")
+		require.NotNil(t, other)
+		assert.NotEqual(t, old.Token, other.Token)
+
+		ws, err := ag.RenameWorkspace("test", "renamed")
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", ws.Name)
+		assert.Equal(t, old.TargetPath, ws.TargetPath)
+		assert.Equal(t, old.Token, ws.Token)
+		assert.Equal(t, []string{"err", "renamed", "test.token"}, agentWsNames(ag))
+		assert.FileExists(t, other.KeyPath)
+		assert.FileExists(t, other.TokenPath)
+
+		_, err = ag.RenameWorkspace("renamed", "err")
+		assert.Error(t, err)
+		_, err = ag.RenameWorkspace("renamed", "../escape")
+		assert.Error(t, err)
+	})
+
+	t.Run("unlinks workspace", func(t *testing.T) {
+		require.NoError(t, ag.UnlinkWorkspace("renamed"))
+		assert.Equal(t, []string{"err", "test.token"}, agentWsNames(ag))
+		assert.DirExists(t, filepath.Join(pkgpath, "testworkspace"))
+		assert.Error(t, ag.UnlinkWorkspace("renamed"))
+	})
+
+	t.Run("scaffolds workspace from template", func(t *testing.T) {
+		dst := filepath.Join(ag.Path, "new")
+		require.NoError(t, scaffold(ag.TemplatePath, dst))
+		assert.FileExists(t, filepath.Join(dst, "workspace.go"))
+		assert.FileExists(t, filepath.Join(dst, "obj", "README.txt"))
+
+		gomod, err := ioutil.ReadFile(filepath.Join(dst, "go.mod"))
+		require.NoError(t, err)
+		root, err := filepath.Abs(filepath.Join(ag.TemplatePath, "..", ".."))
+		require.NoError(t, err)
+		assert.Contains(t, string(gomod), "replace github.com/manifold/tractor => "+root+"\n")
+		assert.Contains(t, string(gomod), "replace workspace => ./\n")
+
+		assert.Error(t, scaffold(ag.TemplatePath, dst))
+	})
+}
+
 func agentWsNames(ag *Agent) []string {
 	wss, _ := ag.Workspaces()
 	return wsNames(wss)
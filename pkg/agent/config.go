@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/manifold/tractor/pkg/misc/runlog"
+)
+
+// ConfigFile is the name of the agent config file in the agent directory.
+const ConfigFile = "config.json"
+
+// Config is the agent configuration, loaded from ~/.tractor/config.json.
+// Settings missing from the file keep their defaults. The file is reloaded
+// when it changes, but the directory layout and console buffer and log
+// settings only apply when the agent starts, and the stop timeout and watch
+// interval when a workspace starts.
+type Config struct {
+	// Directories of the agent layout, relative to the agent directory
+	// unless absolute.
+	WorkspacesDir string `json:"workspacesDir"`
+	SocketsDir    string `json:"socketsDir"`
+	BinDir        string `json:"binDir"`
+	KeysDir       string `json:"keysDir"`
+	TokensDir     string `json:"tokensDir"`
+	GrantsDir     string `json:"grantsDir"`
+	LogsDir       string `json:"logsDir"`
+	// TemplateDir is the workspace template new workspaces are created
+	// from. If empty, it is data/workspace of the source tree the agent
+	// was built from.
+	TemplateDir string `json:"templateDir"`
+
+	// WatchInterval is how often workspaces are polled for changes, and how
+	// long changes settle before a workspace is rebuilt.
+	WatchInterval Duration `json:"watchInterval"`
+	// WatchExtensions are the extensions of the files watched for changes.
+	WatchExtensions []string `json:"watchExtensions"`
+	// WatchIgnore skips watching paths containing any of its substrings.
+	WatchIgnore []string `json:"watchIgnore"`
+
+	// ConsoleBufferSize is how many bytes of console output are kept for
+	// each workspace.
+	ConsoleBufferSize int64 `json:"consoleBufferSize"`
+	// StudioURL is where Studio is served.
+	StudioURL string `json:"studioURL"`
+	// StopTimeout is how long a workspace daemon has to exit after being
+	// interrupted before it is killed.
+	StopTimeout Duration `json:"stopTimeout"`
+
+	// LogMaxSize is the size at which workspace console logs are rotated.
+	LogMaxSize int64 `json:"logMaxSize"`
+	// LogMaxFiles is how many rotated console logs are kept per workspace.
+	LogMaxFiles int `json:"logMaxFiles"`
+	// LogMaxAge is how long a console log is written to before it is
+	// rotated, and how long rotated logs are kept.
+	LogMaxAge Duration `json:"logMaxAge"`
+}
+
+// DefaultConfig returns the configuration used without a config file.
+func DefaultConfig() Config {
+	return Config{
+		WorkspacesDir:     "workspaces",
+		SocketsDir:        "sockets",
+		BinDir:            "bin",
+		KeysDir:           "keys",
+		TokensDir:         "tokens",
+		GrantsDir:         "grants",
+		LogsDir:           "logs",
+		WatchInterval:     Duration(50 * time.Millisecond),
+		WatchExtensions:   []string{".go", ".ts", ".tsx", ".js", ".jsx", ".html"},
+		WatchIgnore:       []string{"node_modules"},
+		ConsoleBufferSize: 1024 * 1024,
+		StudioURL:         "http://localhost:3000",
+		StopTimeout:       Duration(3 * time.Second),
+		LogMaxSize:        runlog.DefaultMaxSize,
+		LogMaxFiles:       runlog.DefaultMaxFiles,
+		LogMaxAge:         Duration(runlog.DefaultMaxAge),
+	}
+}
+
+// LoadConfig reads the config file at path over the defaults and validates
+// it. A missing file gives the defaults.
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate returns an error describing the first invalid setting.
+func (c Config) Validate() error {
+	for _, dir := range []struct{ name, path string }{
+		{"workspacesDir", c.WorkspacesDir},
+		{"socketsDir", c.SocketsDir},
+		{"binDir", c.BinDir},
+		{"keysDir", c.KeysDir},
+		{"tokensDir", c.TokensDir},
+		{"grantsDir", c.GrantsDir},
+		{"logsDir", c.LogsDir},
+	} {
+		if dir.path == "" {
+			return fmt.Errorf("%s is empty", dir.name)
+		}
+	}
+	if c.WatchInterval <= 0 {
+		return errors.New("watchInterval must be positive")
+	}
+	if len(c.WatchExtensions) == 0 {
+		return errors.New("watchExtensions is empty")
+	}
+	for _, ext := range c.WatchExtensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("watchExtensions: %q doesn't start with a dot", ext)
+		}
+	}
+	if c.ConsoleBufferSize <= 0 {
+		return errors.New("consoleBufferSize must be positive")
+	}
+	u, err := url.Parse(c.StudioURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("studioURL: %q isn't an http or https URL", c.StudioURL)
+	}
+	if c.StopTimeout <= 0 {
+		return errors.New("stopTimeout must be positive")
+	}
+	if c.LogMaxSize <= 0 || c.LogMaxFiles <= 0 || c.LogMaxAge <= 0 {
+		return errors.New("logMaxSize, logMaxFiles and logMaxAge must be positive")
+	}
+	return nil
+}
+
+// dir returns a layout directory of the config inside the agent directory.
+func (c Config) dir(agentPath, dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(agentPath, dir)
+}
+
+// Duration is a time.Duration written as a string like "50ms" in the config
+// file.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"50ms\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config returns the current configuration of the agent.
+func (a *Agent) Config() Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
+}
+
+// loadConfig loads the config file and applies the overrides of the agent.
+func (a *Agent) loadConfig() (Config, error) {
+	c, err := LoadConfig(a.ConfigPath)
+	if err != nil {
+		return c, err
+	}
+	for _, override := range a.overrides {
+		override(&c)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("overridden config: %w", err)
+	}
+	return c, nil
+}
+
+// ReloadConfig reloads the config file, keeping the current configuration
+// if it is invalid.
+func (a *Agent) ReloadConfig() error {
+	c, err := a.loadConfig()
+	if err != nil {
+		logErr(a.Logger, "[config] not reloaded:", err)
+		return err
+	}
+	a.configMu.Lock()
+	old := a.config
+	a.config = c
+	a.configMu.Unlock()
+	if old.WorkspacesDir != c.WorkspacesDir || old.SocketsDir != c.SocketsDir ||
+		old.BinDir != c.BinDir || old.KeysDir != c.KeysDir || old.TokensDir != c.TokensDir ||
+		old.GrantsDir != c.GrantsDir || old.LogsDir != c.LogsDir || old.TemplateDir != c.TemplateDir ||
+		old.ConsoleBufferSize != c.ConsoleBufferSize || old.LogMaxSize != c.LogMaxSize ||
+		old.LogMaxFiles != c.LogMaxFiles || old.LogMaxAge != c.LogMaxAge {
+		info(a.Logger, "[config] reloaded, layout and console buffer and log changes apply when the agent restarts")
+	} else {
+		info(a.Logger, "[config] reloaded")
+	}
+	return nil
+}
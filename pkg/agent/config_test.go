@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-agent-config-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ConfigFile)
+
+	writeConfig := func(s string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(s), 0644))
+	}
+
+	t.Run("defaults without a file", func(t *testing.T) {
+		c, err := LoadConfig(path)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultConfig(), c)
+	})
+
+	t.Run("file over defaults", func(t *testing.T) {
+		writeConfig(`{"watchInterval": "200ms", "watchIgnore": ["vendor"], "binDir": "/opt/tractor/bin"}`)
+		c, err := LoadConfig(path)
+		require.NoError(t, err)
+		assert.Equal(t, Duration(200*time.Millisecond), c.WatchInterval)
+		assert.Equal(t, []string{"vendor"}, c.WatchIgnore)
+		assert.Equal(t, "/opt/tractor/bin", c.dir(dir, c.BinDir))
+		assert.Equal(t, filepath.Join(dir, "keys"), c.dir(dir, c.KeysDir))
+		assert.Equal(t, DefaultConfig().StudioURL, c.StudioURL)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{
+			`{"watchInterval": 50}`,
+			`{"watchInterval": "-1s"}`,
+			`{"watchExtensions": ["go"]}`,
+			`{"studioURL": "localhost:3000"}`,
+			`{"consoleBufferSize": 0}`,
+			`{"logMaxFiles": 0}`,
+			`{"logMaxAge": "0s"}`,
+			`{"keysDir": ""}`,
+			`{"grantsDir": ""}`,
+			`{"unknown": true}`,
+			`{`,
+		} {
+			writeConfig(s)
+			_, err := LoadConfig(path)
+			assert.Error(t, err, s)
+		}
+	})
+
+	t.Run("overrides and reload", func(t *testing.T) {
+		writeConfig(`{"stopTimeout": "10s", "studioURL": "http://localhost:4000"}`)
+		ag, err := Open(dir, nil, false, func(c *Config) {
+			c.StudioURL = "http://studio.local"
+		})
+		require.NoError(t, err)
+		assert.Equal(t, Duration(10*time.Second), ag.Config().StopTimeout)
+		assert.Equal(t, "http://studio.local", ag.Config().StudioURL)
+
+		writeConfig(`{"stopTimeout": "1s"}`)
+		require.NoError(t, ag.ReloadConfig())
+		assert.Equal(t, Duration(time.Second), ag.Config().StopTimeout)
+		assert.Equal(t, "http://studio.local", ag.Config().StudioURL)
+
+		// an invalid file keeps the config
+		writeConfig(`{"stopTimeout": "soon"}`)
+		assert.Error(t, ag.ReloadConfig())
+		assert.Equal(t, Duration(time.Second), ag.Config().StopTimeout)
+	})
+
+	t.Run("template dir", func(t *testing.T) {
+		writeConfig(`{}`)
+		ag, err := Open(dir, nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, defaultTemplatePath(), ag.TemplatePath)
+
+		writeConfig(`{"templateDir": "template"}`)
+		ag, err = Open(dir, nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "template"), ag.TemplatePath)
+	})
+}
@@ -0,0 +1,148 @@
+// Package dashboard serves a web dashboard of the agent workspaces, for
+// running the agent headless where there is no system tray.
+package dashboard
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/manifold/tractor/pkg/agent"
+	"github.com/manifold/tractor/pkg/agent/rpc"
+	"github.com/manifold/tractor/pkg/misc/logging"
+)
+
+// tokenCookie holds the agent token once a browser has presented it.
+const tokenCookie = "tractor-agent-token"
+
+// Service serves the dashboard in front of the agent gateway, which serves
+// its JSON API:
+//
+//	GET  /                              the dashboard
+//	GET  /status                        workspaces and their detailed status
+//	GET  /workspaces/{name}/logs        recent console output of a workspace
+//	POST /workspaces/{name}/start       starts or restarts a workspace
+//	POST /workspaces/{name}/stop        stops a workspace
+//
+// along with the other gateway routes. Clients authenticate with the agent
+// token as a Bearer token or the token query parameter. Browsers opening
+// /?token={token} are given a cookie holding it so the dashboard can call
+// the API, which the gateway on its own refuses to browsers.
+type Service struct {
+	Agent *agent.Agent
+	RPC   *rpc.Service
+	Log   logging.Logger
+	// Addr is the address to serve the dashboard on, such as localhost:4280.
+	Addr string
+
+	l net.Listener
+}
+
+func (s *Service) InitializeDaemon() (err error) {
+	s.l, err = net.Listen("tcp", s.Addr)
+	return err
+}
+
+func (s *Service) Serve(ctx context.Context) {
+	s.Log.Infof("[server] dashboard http://%s/?token=... (token in %s)", s.Addr, s.Agent.TokenPath)
+	if err := http.Serve(s.l, s.Handler()); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		s.Log.Info("[dashboard]", err)
+	}
+}
+
+func (s *Service) TerminateDaemon() error {
+	return s.l.Close()
+}
+
+// Handler returns the HTTP handler of the dashboard.
+func (s *Service) Handler() http.Handler {
+	gateway := s.RPC.Gateway()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticate(w, r) {
+			return
+		}
+		if !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("origin not allowed: %s", r.Header.Get("Origin")))
+			return
+		}
+		if r.URL.Path == "/" {
+			if allowMethod(w, r, http.MethodGet) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte(page))
+			}
+			return
+		}
+
+		// pass the request on as from a client with the token, since the
+		// gateway refuses browsers and the origin has been checked
+		r = r.Clone(r.Context())
+		r.Header.Del("Origin")
+		r.Header.Del("Cookie")
+		r.Header.Set("Authorization", "Bearer "+s.Agent.Token)
+		gateway.ServeHTTP(w, r)
+	})
+}
+
+// authenticate checks the agent token of a request, setting the token
+// cookie when it is given as a query parameter.
+func (s *Service) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	fromQuery := token != ""
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if c, err := r.Cookie(tokenCookie); err == nil && !fromQuery {
+		token = c.Value
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.Agent.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token, open /?token={token} with the token in %s", s.Agent.TokenPath))
+		return false
+	}
+	if fromQuery && r.URL.Path == "/" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		// drop the token from the address bar and history
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return false
+	}
+	return true
+}
+
+// sameOrigin reports whether a request comes from the dashboard itself, or
+// from a client that isn't a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || origin == "http://"+r.Host || origin == "https://"+r.Host
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,161 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manifold/tractor/pkg/agent"
+	"github.com/manifold/tractor/pkg/agent/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_, b, _, _ = runtime.Caller(0)
+	wspath     = filepath.Join(filepath.Dir(b), "..", "testutil", "testworkspace")
+)
+
+func setup(t *testing.T) (*agent.Agent, *httptest.Server, func()) {
+	dirname, err := ioutil.TempDir("", "tractor-pkg-agent-dashboard")
+	require.NoError(t, err)
+	ag, err := agent.Open(dirname, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, os.Symlink(wspath, filepath.Join(ag.WorkspacesPath, "test")))
+
+	s := &Service{Agent: ag, RPC: &rpc.Service{Agent: ag}}
+	server := httptest.NewServer(s.Handler())
+	return ag, server, func() {
+		server.Close()
+		ag.Shutdown()
+		os.RemoveAll(dirname)
+	}
+}
+
+// noRedirect is a client that returns redirects instead of following them.
+var noRedirect = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func request(t *testing.T, method, url string, header map[string]string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := noRedirect.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAuthentication(t *testing.T) {
+	ag, server, teardown := setup(t)
+	defer teardown()
+	bearer := "Bearer " + ag.Token
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		header map[string]string
+		status int
+	}{
+		{"no token", "/status", nil, http.StatusUnauthorized},
+		{"wrong token", "/status", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"wrong cookie", "/status", map[string]string{"Cookie": tokenCookie + "=wrong"}, http.StatusUnauthorized},
+		{"bearer", "/status", map[string]string{"Authorization": bearer}, http.StatusOK},
+		{"query", "/status?token=" + ag.Token, nil, http.StatusOK},
+		{"cookie", "/status", map[string]string{"Cookie": tokenCookie + "=" + ag.Token}, http.StatusOK},
+		{"page", "/", map[string]string{"Authorization": bearer}, http.StatusOK},
+		{"same origin", "/status", map[string]string{"Authorization": bearer, "Origin": server.URL}, http.StatusOK},
+		{"other origin", "/status", map[string]string{"Authorization": bearer, "Origin": "http://example.com"}, http.StatusForbidden},
+		{"other origin page", "/", map[string]string{"Authorization": bearer, "Origin": "http://example.com"}, http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := request(t, http.MethodGet, server.URL+tt.path, tt.header)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("token cookie", func(t *testing.T) {
+		resp := request(t, http.MethodGet, server.URL+"/?token="+ag.Token, nil)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/", resp.Header.Get("Location"))
+		cookies := resp.Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, tokenCookie, cookies[0].Name)
+		assert.Equal(t, ag.Token, cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+	})
+}
+
+func TestStartStop(t *testing.T) {
+	ag, server, teardown := setup(t)
+	defer teardown()
+	ws := ag.Workspace("test")
+	require.NotNil(t, ws)
+	status := make(chan agent.WorkspaceStatus, 3)
+	last := ws.Status()
+	ws.Observe(func(_ *agent.Workspace, detail agent.WorkspaceDetail) {
+		if detail.Status != last {
+			last = detail.Status
+			status <- detail.Status
+		}
+	})
+	header := map[string]string{
+		"Cookie": tokenCookie + "=" + ag.Token,
+		"Origin": server.URL,
+	}
+	nextStatus := func() agent.WorkspaceStatus {
+		select {
+		case s := <-status:
+			return s
+		case <-time.After(30 * time.Second):
+			require.FailNow(t, "workspace status didn't change")
+			return ""
+		}
+	}
+
+	resp := request(t, http.MethodPost, server.URL+"/workspaces/test/start", header)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, agent.StatusAvailable, nextStatus())
+
+	resp = request(t, http.MethodGet, server.URL+"/status", header)
+	var body struct {
+		Workspaces []rpc.WorkspaceStatus
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	require.Len(t, body.Workspaces, 1)
+	assert.Equal(t, "test", body.Workspaces[0].Name)
+	assert.NotZero(t, body.Workspaces[0].PID)
+
+	resp = request(t, http.MethodPost, server.URL+"/workspaces/test/stop", header)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, agent.StatusUnavailable, nextStatus())
+
+	resp = request(t, http.MethodPost, server.URL+"/workspaces/test/start", map[string]string{
+		"Cookie": tokenCookie + "=" + ag.Token,
+		"Origin": "http://example.com",
+	})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = request(t, http.MethodPost, server.URL+"/workspaces/missing/start", header)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.True(t, strings.Contains(string(b), "NotFound"), string(b))
+}
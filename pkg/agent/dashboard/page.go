@@ -0,0 +1,123 @@
+package dashboard
+
+// page is the dashboard. It polls the status endpoint and renders the
+// workspaces with their console output and actions.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tractor Agent</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; width: 100%; }
+  th, td { text-align: left; padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+  th { font-weight: 600; }
+  .Available { color: #1a7f37; }
+  .Partially { color: #9a6700; }
+  .Unavailable, .CrashLooping { color: #cf222e; }
+  .path { color: #666; font-size: 0.9em; }
+  button { margin-right: 0.3em; }
+  pre { background: #111; color: #ddd; padding: 1em; max-height: 30em; overflow: auto; white-space: pre-wrap; }
+  #error { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Tractor Agent</h1>
+<p id="error"></p>
+<table>
+  <thead><tr><th>Workspace</th><th>Status</th><th>Build</th><th></th></tr></thead>
+  <tbody id="workspaces"></tbody>
+</table>
+<h2 id="logs-title" hidden></h2>
+<pre id="logs" hidden></pre>
+<script>
+var logsFor = null;
+
+function el(tag, text, className) {
+  var e = document.createElement(tag);
+  if (text) e.textContent = text;
+  if (className) e.className = className;
+  return e;
+}
+
+function button(text, onclick) {
+  var b = el("button", text);
+  b.onclick = onclick;
+  return b;
+}
+
+function call(method, path) {
+  return fetch(path, {method: method, credentials: "same-origin"}).then(function(resp) {
+    if (!resp.ok) {
+      return resp.json().then(function(body) { throw new Error(body.error); });
+    }
+    return resp;
+  });
+}
+
+function act(name, action) {
+  call("POST", "/workspaces/" + encodeURIComponent(name) + "/" + action)
+    .then(refresh).catch(showError);
+}
+
+function showLogs(name) {
+  logsFor = name;
+  refreshLogs();
+}
+
+function refreshLogs() {
+  if (logsFor === null) return;
+  call("GET", "/workspaces/" + encodeURIComponent(logsFor) + "/logs")
+    .then(function(resp) { return resp.text(); })
+    .then(function(text) {
+      var title = document.getElementById("logs-title");
+      var logs = document.getElementById("logs");
+      var atEnd = logs.scrollTop + logs.clientHeight >= logs.scrollHeight - 4;
+      title.textContent = "Console: " + logsFor;
+      logs.textContent = text;
+      title.hidden = logs.hidden = false;
+      if (atEnd) logs.scrollTop = logs.scrollHeight;
+    }).catch(showError);
+}
+
+function showError(err) {
+  document.getElementById("error").textContent = err ? err.message : "";
+}
+
+function render(workspaces) {
+  var body = document.getElementById("workspaces");
+  body.textContent = "";
+  workspaces.forEach(function(ws) {
+    var row = el("tr");
+    var name = el("td");
+    name.appendChild(el("div", ws.displayName));
+    name.appendChild(el("div", ws.path, "path"));
+    row.appendChild(name);
+    row.appendChild(el("td", ws.summary, ws.status));
+    row.appendChild(el("td", ws.buildError ? "failed: " + ws.buildError : "ok"));
+    var actions = el("td");
+    if (ws.pid) {
+      actions.appendChild(button("Restart", function() { act(ws.name, "start"); }));
+      actions.appendChild(button("Stop", function() { act(ws.name, "stop"); }));
+    } else {
+      actions.appendChild(button("Start", function() { act(ws.name, "start"); }));
+    }
+    actions.appendChild(button("Logs", function() { showLogs(ws.name); }));
+    row.appendChild(actions);
+    body.appendChild(row);
+  });
+}
+
+function refresh() {
+  call("GET", "/status")
+    .then(function(resp) { return resp.json(); })
+    .then(function(status) { showError(null); render(status.workspaces); refreshLogs(); })
+    .catch(showError);
+}
+
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
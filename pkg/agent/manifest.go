@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/manifold/tractor/pkg/misc/secret"
+)
+
+// ManifestFile is the name of the workspace manifest, beside workspace.go.
+const ManifestFile = "tractor.json"
+
+// Manifest describes how a workspace is built and run. A workspace without
+// one is built plainly, listens on its unix socket and starts with the agent.
+// It is read when the agent opens the workspace and again when it changes.
+type Manifest struct {
+	// Name is shown instead of the workspace name, such as in the systray.
+	Name string `json:"name,omitempty"`
+	// Build is passed to go build, and tags to go vet too.
+	Build BuildOptions `json:"build,omitempty"`
+	// Env is added to the environment of the workspace daemon.
+	Env map[string]string `json:"env,omitempty"`
+	// Listen is where the workspace daemon serves QRPC.
+	Listen ListenOptions `json:"listen,omitempty"`
+	// Autostart starts the workspace daemon when the agent starts. It
+	// defaults to true.
+	Autostart *bool `json:"autostart,omitempty"`
+	// WatchIgnore are globs of paths relative to the workspace, or of file
+	// names, whose changes don't rebuild the workspace.
+	WatchIgnore []string `json:"watchIgnore,omitempty"`
+}
+
+// BuildOptions are the go build options of a workspace. Flags take their
+// values as -flag=value.
+type BuildOptions struct {
+	Flags   []string `json:"flags,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Ldflags string   `json:"ldflags,omitempty"`
+}
+
+// ListenOptions are the protocol and address the workspace daemon listens
+// on. The protocol is unix or websocket. The address of unix is always the
+// workspace socket, websocket needs one.
+type ListenOptions struct {
+	Proto string `json:"proto,omitempty"`
+	Addr  string `json:"addr,omitempty"`
+}
+
+// LoadManifest reads the manifest of the workspace at dir. A workspace
+// without one gets an empty manifest.
+func LoadManifest(dir string) (*Manifest, error) {
+	path := filepath.Join(dir, ManifestFile)
+	m := &Manifest{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return &Manifest{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return &Manifest{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Validate returns an error describing the first invalid setting.
+func (m *Manifest) Validate() error {
+	for _, flag := range m.Build.Flags {
+		if !strings.HasPrefix(flag, "-") {
+			return fmt.Errorf("build.flags: %q isn't a flag", flag)
+		}
+		name := strings.SplitN(strings.TrimLeft(flag, "-"), "=", 2)[0]
+		switch name {
+		case "o", "tags", "ldflags":
+			return fmt.Errorf("build.flags: -%s isn't allowed, the agent sets the output and tags and ldflags have their own settings", name)
+		}
+	}
+	for _, tag := range m.Build.Tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t") {
+			return fmt.Errorf("build.tags: invalid tag %q", tag)
+		}
+	}
+	for k := range m.Env {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("env: invalid variable name %q", k)
+		}
+		if k == secret.EnvKey || k == secret.EnvToken {
+			return fmt.Errorf("env: %s is set by the agent", k)
+		}
+	}
+	switch m.Listen.Proto {
+	case "", "unix":
+		if m.Listen.Addr != "" {
+			return errors.New("listen.addr: unix always listens on the workspace socket")
+		}
+	case "websocket":
+		if m.Listen.Addr == "" {
+			return errors.New("listen.addr: websocket needs an address, such as localhost:4243")
+		}
+	default:
+		return fmt.Errorf("listen.proto: unknown protocol %q, use unix or websocket", m.Listen.Proto)
+	}
+	for _, glob := range m.WatchIgnore {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("watchIgnore: %q: %w", glob, err)
+		}
+	}
+	return nil
+}
+
+// DisplayName returns the name the workspace is shown as.
+func (w *Workspace) DisplayName() string {
+	if m := w.Manifest(); m.Name != "" {
+		return m.Name
+	}
+	return w.Name
+}
+
+// Manifest returns the manifest of the workspace.
+func (w *Workspace) Manifest() Manifest {
+	w.manifestMu.RLock()
+	defer w.manifestMu.RUnlock()
+	return *w.manifest
+}
+
+// ReloadManifest reads the manifest again after it changed. An invalid one
+// is reported and the previous one kept. Build settings apply to the next
+// build, and the listen address and environment when the daemon restarts.
+func (w *Workspace) ReloadManifest() error {
+	m, err := LoadManifest(w.TargetPath)
+	if err != nil {
+		logErr(w.log, "[workspace]", w.Name, "manifest not reloaded:", err)
+		return err
+	}
+	w.manifestMu.Lock()
+	w.manifest = m
+	w.manifestMu.Unlock()
+	info(w.log, "[workspace]", w.Name, "manifest reloaded")
+	return nil
+}
+
+// isManifest reports whether a path is the manifest of the workspace.
+func (w *Workspace) isManifest(path string) bool {
+	return path == filepath.Join(w.TargetPath, ManifestFile)
+}
+
+// autostart reports whether the daemon starts with the agent.
+func (w *Workspace) autostart() bool {
+	m := w.Manifest()
+	return m.Autostart == nil || *m.Autostart
+}
+
+// listensOnSocket reports whether the daemon listens on the workspace socket,
+// which the agent uses to send it build results.
+func (w *Workspace) listensOnSocket() bool {
+	proto := w.Manifest().Listen.Proto
+	return proto == "" || proto == "unix"
+}
+
+// buildArgs returns the go build arguments building the workspace to bin.
+func (w *Workspace) buildArgs(bin string) []string {
+	m := w.Manifest()
+	args := append([]string{"build"}, m.Build.Flags...)
+	args = append(args, w.tagArgs()...)
+	if m.Build.Ldflags != "" {
+		args = append(args, "-ldflags", m.Build.Ldflags)
+	}
+	return append(args, "-o", bin, ".")
+}
+
+// tagArgs returns the -tags argument of the build tags, if any.
+func (w *Workspace) tagArgs() []string {
+	tags := w.Manifest().Build.Tags
+	if len(tags) == 0 {
+		return nil
+	}
+	return []string{"-tags", strings.Join(tags, ",")}
+}
+
+// daemonArgs returns the arguments of the workspace daemon.
+func (w *Workspace) daemonArgs() []string {
+	proto, addr := "unix", w.SocketPath
+	if m := w.Manifest(); !w.listensOnSocket() {
+		proto, addr = m.Listen.Proto, m.Listen.Addr
+	}
+	return []string{w.BinPath,
+		"-proto", proto, "-addr", addr, "-grants", w.GrantsPath, "-build", w.BuildPath}
+}
+
+// daemonEnv returns the environment variables of the manifest.
+func (w *Workspace) daemonEnv() []string {
+	var env []string
+	for k, v := range w.Manifest().Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// watchIgnored reports whether changes to a path are ignored by the
+// manifest globs.
+func (w *Workspace) watchIgnored(fullPath string) bool {
+	rel, err := filepath.Rel(w.TargetPath, fullPath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, glob := range w.Manifest().WatchIgnore {
+		if ok, _ := filepath.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, filepath.Base(fullPath)); ok {
+			return true
+		}
+		// a glob matching a directory ignores everything in it
+		for dir := filepath.Dir(rel); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if ok, _ := filepath.Match(glob, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-agent-manifest-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeManifest := func(s string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ManifestFile), []byte(s), 0644))
+	}
+
+	t.Run("defaults without a file", func(t *testing.T) {
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		ws := &Workspace{Name: "ws", TargetPath: dir, SocketPath: "/tmp/ws.sock", BinPath: "/tmp/ws", manifest: m}
+		assert.Equal(t, "ws", ws.DisplayName())
+		assert.True(t, ws.autostart())
+		assert.True(t, ws.listensOnSocket())
+		assert.Equal(t, []string{"build", "-o", "/tmp/ws.new", "."}, ws.buildArgs("/tmp/ws.new"))
+		assert.Equal(t, []string{"-proto", "unix", "-addr", "/tmp/ws.sock"}, ws.daemonArgs()[1:5])
+		assert.Empty(t, ws.daemonEnv())
+	})
+
+	t.Run("settings", func(t *testing.T) {
+		writeManifest(`{
+			"name": "My Workspace",
+			"build": {"flags": ["-race", "-trimpath"], "tags": ["dev", "sqlite"], "ldflags": "-X main.version=1"},
+			"env": {"PORT": "8080", "DEBUG": "1"},
+			"listen": {"proto": "websocket", "addr": "localhost:5000"},
+			"autostart": false,
+			"watchIgnore": ["generated", "*_gen.go", "assets/*"]
+		}`)
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		ws := &Workspace{Name: "ws", TargetPath: dir, SocketPath: "/tmp/ws.sock", BinPath: "/tmp/ws", manifest: m}
+		assert.Equal(t, "My Workspace", ws.DisplayName())
+		assert.False(t, ws.autostart())
+		assert.False(t, ws.listensOnSocket())
+		assert.Equal(t, []string{"build", "-race", "-trimpath", "-tags", "dev,sqlite",
+			"-ldflags", "-X main.version=1", "-o", "/tmp/ws.new", "."}, ws.buildArgs("/tmp/ws.new"))
+		assert.Equal(t, []string{"-proto", "websocket", "-addr", "localhost:5000"}, ws.daemonArgs()[1:5])
+		assert.Equal(t, []string{"DEBUG=1", "PORT=8080"}, ws.daemonEnv())
+
+		assert.True(t, ws.watchIgnored(filepath.Join(dir, "generated", "a.go")))
+		assert.True(t, ws.watchIgnored(filepath.Join(dir, "pkg", "x_gen.go")))
+		assert.True(t, ws.watchIgnored(filepath.Join(dir, "assets", "app.js")))
+		assert.False(t, ws.watchIgnored(filepath.Join(dir, "workspace.go")))
+		assert.False(t, ws.watchIgnored(filepath.Join(dir, "pkg", "assets.go")))
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		writeManifest(`{"name": "Before", "env": {"PORT": "8080"}}`)
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		ws := &Workspace{Name: "ws", TargetPath: dir, SocketPath: "/tmp/ws.sock", BinPath: "/tmp/ws", manifest: m}
+		assert.True(t, ws.isManifest(filepath.Join(dir, ManifestFile)))
+		assert.False(t, ws.isManifest(filepath.Join(dir, "sub", ManifestFile)))
+
+		writeManifest(`{"name": "After", "listen": {"proto": "websocket", "addr": "localhost:5000"}}`)
+		require.NoError(t, ws.ReloadManifest())
+		assert.Equal(t, "After", ws.DisplayName())
+		assert.Empty(t, ws.daemonEnv())
+		assert.Equal(t, []string{"-proto", "websocket", "-addr", "localhost:5000"}, ws.daemonCommand()[1:5])
+
+		// an invalid manifest keeps the previous one
+		writeManifest(`{"unknown": true}`)
+		assert.Error(t, ws.ReloadManifest())
+		assert.Equal(t, "After", ws.DisplayName())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{
+			`{"build": {"flags": ["-o", "bin"]}}`,
+			`{"build": {"flags": ["-tags=dev"]}}`,
+			`{"build": {"flags": ["race"]}}`,
+			`{"build": {"tags": ["a,b"]}}`,
+			`{"env": {"TRACTOR_SECRET_KEY": "x"}}`,
+			`{"env": {"A=B": "x"}}`,
+			`{"listen": {"proto": "tcp", "addr": "localhost:5000"}}`,
+			`{"listen": {"proto": "websocket"}}`,
+			`{"listen": {"addr": "/tmp/other.sock"}}`,
+			`{"watchIgnore": ["[a"]}`,
+			`{"autostart": "yes"}`,
+			`{"unknown": true}`,
+		} {
+			writeManifest(s)
+			m, err := LoadManifest(dir)
+			assert.Error(t, err, s)
+			assert.Equal(t, &Manifest{}, m, s)
+		}
+	})
+}
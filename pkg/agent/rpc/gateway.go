@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manifold/tractor/pkg/agent"
+	"github.com/manifold/tractor/pkg/misc/runlog"
+)
+
+// Gateway returns an HTTP handler that serves the agent RPC API as JSON for
+// scripts and tools that don't speak qrpc:
+//
+//	GET  /status                    workspaces and their detailed status
+//	GET  /workspaces                workspaces and their status
+//	GET  /workspaces/{name}         a workspace and its status
+//	GET  /workspaces/{name}/status  a workspace and its detailed status
+//	GET  /workspaces/{name}/logs    recent console output of a workspace
+//	POST /workspaces/{name}/start   starts or restarts a workspace
+//	POST /workspaces/{name}/stop    stops a workspace
+//	GET  /workspaces/{name}/output  server-sent events of workspace output
+//
+// The logs and output routes take since, a time in RFC 3339, and run query
+// parameters to replay the console log like the logs and connect calls.
+// Clients authenticate with the agent token as a Bearer token, or as the
+// token query parameter where they can't set headers. Browsers are refused
+// since the agent has no origins to allow.
+func (s *Service) Gateway() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeError(w, http.StatusForbidden, fmt.Errorf("origin not allowed: %s", r.Header.Get("Origin")))
+			return
+		}
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Agent.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+
+		if r.URL.Path == "/status" {
+			s.gatewayStatus(w, r)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] != "workspaces" || len(parts) > 3 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+			return
+		}
+		if len(parts) == 1 {
+			s.gatewayList(w, r)
+			return
+		}
+		ws := s.Agent.Workspace(parts[1])
+		if ws == nil {
+			writeError(w, http.StatusNotFound, notFound(parts[1]))
+			return
+		}
+		action := ""
+		if len(parts) == 3 {
+			action = parts[2]
+		}
+		switch action {
+		case "":
+			if allowMethod(w, r, http.MethodGet) {
+				writeJSON(w, http.StatusOK, workspaceInfo(ws))
+			}
+		case "status":
+			if allowMethod(w, r, http.MethodGet) {
+				writeJSON(w, http.StatusOK, workspaceStatus(ws))
+			}
+		case "logs":
+			if allowMethod(w, r, http.MethodGet) {
+				s.gatewayLogs(w, r, ws)
+			}
+		case "start":
+			if allowMethod(w, r, http.MethodPost) {
+				if err := ws.Start(); err != nil {
+					writeError(w, http.StatusInternalServerError, err)
+					return
+				}
+				writeJSON(w, http.StatusOK, workspaceInfo(ws))
+			}
+		case "stop":
+			if allowMethod(w, r, http.MethodPost) {
+				ws.Stop()
+				writeJSON(w, http.StatusOK, workspaceInfo(ws))
+			}
+		case "output":
+			if allowMethod(w, r, http.MethodGet) {
+				s.gatewayOutput(w, r, ws)
+			}
+		default:
+			writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		}
+	})
+}
+
+func (s *Service) gatewayList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	workspaces, err := s.Agent.Workspaces()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	infos := make([]WorkspaceInfo, len(workspaces))
+	for i, ws := range workspaces {
+		infos[i] = workspaceInfo(ws)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// WorkspaceStatus is a workspace and its detailed status as served by the
+// gateway status routes.
+type WorkspaceStatus struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Path        string `json:"path"`
+	Summary     string `json:"summary"`
+	Pipes       int    `json:"pipes"`
+	Written     int64  `json:"written"`
+	agent.WorkspaceDetail
+}
+
+func workspaceStatus(ws *agent.Workspace) WorkspaceStatus {
+	pipes, written := ws.BufferStatus()
+	detail := ws.Detail()
+	return WorkspaceStatus{
+		Name:            ws.Name,
+		DisplayName:     ws.DisplayName(),
+		Path:            ws.TargetPath,
+		Summary:         detail.Summary(),
+		Pipes:           pipes,
+		Written:         written,
+		WorkspaceDetail: detail,
+	}
+}
+
+func (s *Service) gatewayStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	workspaces, err := s.Agent.Workspaces()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	statuses := make([]WorkspaceStatus, len(workspaces))
+	for i, ws := range workspaces {
+		statuses[i] = workspaceStatus(ws)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"workspaces": statuses})
+}
+
+// gatewayQuery returns the console log query of the since and run query
+// parameters of a request.
+func gatewayQuery(r *http.Request) (runlog.Query, error) {
+	var q runlog.Query
+	var err error
+	if since := r.URL.Query().Get("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return q, fmt.Errorf("invalid since: %s", since)
+		}
+	}
+	if run := r.URL.Query().Get("run"); run != "" {
+		if q.Run, err = strconv.Atoi(run); err != nil {
+			return q, fmt.Errorf("invalid run: %s", run)
+		}
+	}
+	return q, nil
+}
+
+func (s *Service) gatewayLogs(w http.ResponseWriter, r *http.Request, ws *agent.Workspace) {
+	q, err := gatewayQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	out := ws.Output()
+	if !q.Since.IsZero() || q.Run != 0 {
+		if out, err = ws.Replay(q); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(out)
+}
+
+// gatewayOutput streams workspace output as "output" events, one per line,
+// starting the workspace if it isn't running like the connect call.
+func (s *Service) gatewayOutput(w http.ResponseWriter, r *http.Request, ws *agent.Workspace) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	q, err := gatewayQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	out, err := connect(ws, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer out.Close()
+	go func() {
+		<-r.Context().Done()
+		out.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	lines := bufio.NewScanner(out)
+	for lines.Scan() {
+		b, _ := json.Marshal(lines.Text())
+		if _, err := fmt.Fprintf(w, "event: output\ndata: %s\n\n", b); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
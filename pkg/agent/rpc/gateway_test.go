@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_, b, _, _ = runtime.Caller(0)
+	wspath     = filepath.Join(filepath.Dir(b), "..", "testutil", "testworkspace")
+)
+
+func setupGateway(t *testing.T) (*agent.Agent, http.Handler, func()) {
+	dirname, err := ioutil.TempDir("", "tractor-pkg-agent-rpc")
+	require.NoError(t, err)
+	ag, err := agent.Open(dirname, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, os.Symlink(wspath, filepath.Join(ag.WorkspacesPath, "test")))
+	s := &Service{Agent: ag}
+	return ag, s.Gateway(), func() {
+		ag.Shutdown()
+		os.RemoveAll(dirname)
+	}
+}
+
+func gatewayRequest(h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayAuth(t *testing.T) {
+	ag, h, teardown := setupGateway(t)
+	defer teardown()
+	bearer := "Bearer " + ag.Token
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		header map[string]string
+		status int
+	}{
+		{"no token", "/workspaces", nil, http.StatusUnauthorized},
+		{"wrong token", "/workspaces", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"bearer", "/workspaces", map[string]string{"Authorization": bearer}, http.StatusOK},
+		{"query", "/workspaces?token=" + ag.Token, nil, http.StatusOK},
+		{"origin", "/workspaces", map[string]string{"Authorization": bearer, "Origin": "http://localhost"}, http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := gatewayRequest(h, http.MethodGet, tt.target, tt.header)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	ag, h, teardown := setupGateway(t)
+	defer teardown()
+	header := map[string]string{"Authorization": "Bearer " + ag.Token}
+
+	w := gatewayRequest(h, http.MethodGet, "/workspaces", header)
+	require.Equal(t, http.StatusOK, w.Code)
+	var infos []WorkspaceInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+	require.Len(t, infos, 1)
+	assert.Equal(t, "test", infos[0].Name)
+	assert.Empty(t, infos[0].StudioURL)
+
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test", header)
+	require.Equal(t, http.StatusOK, w.Code)
+	var info WorkspaceInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "test", info.Name)
+
+	w = gatewayRequest(h, http.MethodGet, "/status", header)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status struct {
+		Workspaces []WorkspaceStatus
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.Len(t, status.Workspaces, 1)
+	assert.Equal(t, "test", status.Workspaces[0].Name)
+	assert.Equal(t, "stopped", status.Workspaces[0].Summary)
+
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/status", header)
+	require.Equal(t, http.StatusOK, w.Code)
+	var ws WorkspaceStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ws))
+	assert.Equal(t, agent.StateStopped, ws.State)
+
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/logs", header)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/logs?since=2020-01-02T15:04:05Z", header)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/logs?since=yesterday", header)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/output?run=last", header)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/missing", header)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, IsNotFound(errors.New(body["error"])), body["error"])
+
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/start", header)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+	w = gatewayRequest(h, http.MethodPost, "/status", header)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	w = gatewayRequest(h, http.MethodGet, "/workspaces/test/nope", header)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = gatewayRequest(h, http.MethodGet, "/nope", header)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGatewayOutput(t *testing.T) {
+	ag, h, teardown := setupGateway(t)
+	defer teardown()
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/workspaces/test/output", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+ag.Token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the workspace is started and prints its pid
+	events := bufio.NewReader(resp.Body)
+	for _, prefix := range []string{"event: output\n", "data: \"pid ", "\n"} {
+		line, err := events.ReadString('\n')
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(line, prefix), "%q doesn't start with %q", line, prefix)
+	}
+}
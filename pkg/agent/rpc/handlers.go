@@ -3,19 +3,90 @@ package rpc
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"time"
 
 	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/agent"
+	"github.com/manifold/tractor/pkg/misc/runlog"
 )
 
+// WorkspaceInfo describes a workspace and its console buffer.
+type WorkspaceInfo struct {
+	Name        string `json:"name" msgpack:"name"`
+	DisplayName string `json:"displayName" msgpack:"displayName"`
+	Path        string `json:"path" msgpack:"path"`
+	Status      string `json:"status" msgpack:"status"`
+	State       string `json:"state" msgpack:"state"`
+	Pipes       int    `json:"pipes" msgpack:"pipes"`
+	Written     int64  `json:"written" msgpack:"written"`
+	// Output is the end of the console output of a crash looping workspace.
+	Output []string `json:"output,omitempty" msgpack:"output"`
+	// StudioURL opens the workspace in Studio. It carries the workspace
+	// token, so it is only listed over the agent socket.
+	StudioURL string `json:"studioURL,omitempty" msgpack:"studioURL"`
+	// BuildError is set when a workspace was created but failed to build.
+	BuildError string `json:"buildError,omitempty" msgpack:"buildError"`
+}
+
+func workspaceInfo(ws *agent.Workspace) WorkspaceInfo {
+	pipes, written := ws.BufferStatus()
+	return WorkspaceInfo{
+		Name:        ws.Name,
+		DisplayName: ws.DisplayName(),
+		Path:        ws.TargetPath,
+		Status:      ws.Status().String(),
+		State:       string(ws.Detail().State),
+		Pipes:       pipes,
+		Written:     written,
+		Output:      ws.CrashOutput(),
+	}
+}
+
+type CreateParams struct {
+	Path string
+	Name string
+}
+
+type LogsParams struct {
+	Name   string
+	Follow bool
+	// Since and Run replay the console log instead of the recent output.
+	// See runlog.Query.
+	Since time.Time
+	Run   int
+}
+
+type ConnectParams struct {
+	Name string
+	// Since and Run replay the console log instead of the recent output.
+	// See runlog.Query.
+	Since time.Time
+	Run   int
+}
+
+type RenameParams struct {
+	Name    string
+	NewName string
+}
+
+// Connect starts a workspace if it isn't running and streams its console
+// output over the hijacked call channel, from the recent output or the
+// console log since a time or of a run.
 func (s *Service) Connect() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
-		ws, err := findWorkspace(s.Agent, c)
-		if err != nil {
+		var params ConnectParams
+		if err := c.Decode(&params); err != nil {
 			r.Return(err)
 			return
 		}
+		ws := s.Agent.Workspace(params.Name)
+		if ws == nil {
+			r.Return(notFound(params.Name))
+			return
+		}
 
-		out, err := ws.Connect()
+		out, err := connect(ws, runlog.Query{Since: params.Since, Run: params.Run})
 		if err != nil {
 			r.Return(err)
 			return
@@ -68,3 +139,183 @@ func (s *Service) Stop() func(qrpc.Responder, *qrpc.Call) {
 		r.Return(fmt.Sprintf("workspace %q stopped", ws.Name))
 	}
 }
+
+// connect connects to a workspace, replaying the console log selected by q
+// if it selects any.
+func connect(ws *agent.Workspace, q runlog.Query) (io.ReadCloser, error) {
+	if q.Since.IsZero() && q.Run == 0 {
+		return ws.Connect()
+	}
+	return ws.ConnectFrom(q)
+}
+
+// Logs returns the recent console output of a workspace, or the console log
+// since a time or of a run. With Follow, it streams the output as it is
+// written over the hijacked call channel instead. The stream ends when the
+// daemon exits or is stopped, which for a daemon that isn't running is after
+// it next starts.
+func (s *Service) Logs() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params LogsParams
+		if err := c.Decode(&params); err != nil {
+			r.Return(err)
+			return
+		}
+		ws := s.Agent.Workspace(params.Name)
+		if ws == nil {
+			r.Return(notFound(params.Name))
+			return
+		}
+		query := runlog.Query{Since: params.Since, Run: params.Run}
+		replay := !query.Since.IsZero() || query.Run != 0
+		if !params.Follow {
+			if !replay {
+				r.Return(string(ws.Output()))
+				return
+			}
+			out, err := ws.Replay(query)
+			if err != nil {
+				r.Return(err)
+				return
+			}
+			r.Return(string(out))
+			return
+		}
+
+		var out io.ReadCloser
+		if replay {
+			var err error
+			if out, err = ws.FollowFrom(query); err != nil {
+				r.Return(err)
+				return
+			}
+		} else {
+			out = ws.Follow()
+		}
+		defer out.Close()
+		ch, err := r.Hijack(ws.SocketPath)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		go func() {
+			// the client closing its end ends the stream
+			io.Copy(ioutil.Discard, ch)
+			out.Close()
+		}()
+		io.Copy(ch, out)
+		ch.Close()
+	}
+}
+
+// Status returns the detailed status of a workspace.
+func (s *Service) Status() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		ws, err := findWorkspace(s.Agent, c)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(ws.Detail())
+	}
+}
+
+// Rollback reverts a workspace to its previous build.
+func (s *Service) Rollback() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		ws, err := findWorkspace(s.Agent, c)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		if err := ws.Rollback(); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(fmt.Sprintf("workspace %q rolled back", ws.Name))
+	}
+}
+
+// Build returns the result of the last build of a workspace, or nil if it
+// hasn't been built.
+func (s *Service) Build() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		ws, err := findWorkspace(s.Agent, c)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(ws.LastBuild())
+	}
+}
+
+// List returns the workspaces linked to the agent.
+func (s *Service) List() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		workspaces, err := s.Agent.Workspaces()
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		infos := make([]WorkspaceInfo, len(workspaces))
+		for i, ws := range workspaces {
+			infos[i] = workspaceInfo(ws)
+			infos[i].StudioURL = ws.StudioURL()
+		}
+		r.Return(infos)
+	}
+}
+
+// Create scaffolds, links and compiles a new workspace.
+func (s *Service) Create() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params CreateParams
+		if err := c.Decode(&params); err != nil {
+			r.Return(err)
+			return
+		}
+		ws, err := s.Agent.CreateWorkspace(params.Path, params.Name)
+		if ws == nil {
+			r.Return(err)
+			return
+		}
+		info := workspaceInfo(ws)
+		if err != nil {
+			info.BuildError = err.Error()
+		}
+		r.Return(info)
+	}
+}
+
+// Unlink stops a workspace and removes it from the agent, leaving its files.
+func (s *Service) Unlink() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var name string
+		if err := c.Decode(&name); err != nil {
+			r.Return(err)
+			return
+		}
+		if err := s.Agent.UnlinkWorkspace(name); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(fmt.Sprintf("workspace %q unlinked", name))
+	}
+}
+
+// Rename changes the name a workspace is linked as.
+func (s *Service) Rename() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params RenameParams
+		if err := c.Decode(&params); err != nil {
+			r.Return(err)
+			return
+		}
+		ws, err := s.Agent.RenameWorkspace(params.Name, params.NewName)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(workspaceInfo(ws))
+	}
+}
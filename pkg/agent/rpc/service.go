@@ -2,7 +2,10 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -13,13 +16,17 @@ import (
 	"github.com/manifold/tractor/pkg/misc/logging"
 )
 
-// Service provides a QRPC server to connect, restart, and stop running
-// workspaces.
+// Service provides a QRPC server to list, create, rename and unlink
+// workspaces, and to connect, restart, and stop running workspaces.
 type Service struct {
 	Agent *agent.Agent
 	Log   logging.Logger
-	api   qrpc.API
-	l     mux.Listener
+	// GatewayAddr, if set, is the address to serve the HTTP JSON gateway on.
+	GatewayAddr string
+
+	api qrpc.API
+	l   mux.Listener
+	gl  net.Listener
 }
 
 func (s *Service) InitializeDaemon() (err error) {
@@ -31,6 +38,20 @@ func (s *Service) InitializeDaemon() (err error) {
 	s.api.HandleFunc("connect", s.Connect())
 	s.api.HandleFunc("start", s.Start())
 	s.api.HandleFunc("stop", s.Stop())
+	s.api.HandleFunc("list", s.List())
+	s.api.HandleFunc("create", s.Create())
+	s.api.HandleFunc("unlink", s.Unlink())
+	s.api.HandleFunc("rename", s.Rename())
+	s.api.HandleFunc("logs", s.Logs())
+	s.api.HandleFunc("build", s.Build())
+	s.api.HandleFunc("rollback", s.Rollback())
+	s.api.HandleFunc("status", s.Status())
+
+	if s.GatewayAddr != "" {
+		if s.gl, err = net.Listen("tcp", s.GatewayAddr); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -40,6 +61,10 @@ func (s *Service) Serve(ctx context.Context) {
 	//s.periodicStatus()
 
 	s.Log.Infof("[server] unix://%s", s.Agent.SocketPath)
+	if s.gl != nil {
+		s.Log.Infof("[server] gateway http://%s", s.GatewayAddr)
+		go http.Serve(s.gl, s.Gateway())
+	}
 	if err := server.Serve(s.l, s.api); err != nil {
 		fmt.Println(err)
 	}
@@ -49,6 +74,9 @@ func (s *Service) Serve(ctx context.Context) {
 func (s *Service) TerminateDaemon() error {
 	s.Agent.Shutdown()
 	os.Remove(s.Agent.SocketPath)
+	if s.gl != nil {
+		s.gl.Close()
+	}
 	return nil
 }
 
@@ -94,5 +122,21 @@ func findWorkspace(a *agent.Agent, call *qrpc.Call) (*agent.Workspace, error) {
 		return ws, nil
 	}
 
-	return nil, fmt.Errorf("no workspace found for %q", workspacePath)
+	return nil, notFound(workspacePath)
+}
+
+// ErrNotFound is returned by calls for a workspace the agent doesn't have.
+// Errors only cross the wire as strings, so it is the code the message
+// starts with, like the codes of workspace RPC errors, and clients check
+// for it with IsNotFound.
+var ErrNotFound = errors.New("NotFound")
+
+func notFound(name string) error {
+	return fmt.Errorf("%w: no workspace found for %q", ErrNotFound, name)
+}
+
+// IsNotFound reports whether an error, such as one returned from a call,
+// is ErrNotFound.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || (err != nil && strings.HasPrefix(err.Error(), ErrNotFound.Error()+": "))
 }
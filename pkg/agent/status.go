@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is what a workspace is doing, in more detail than its status.
+type State string
+
+const (
+	StateStopped      State = "stopped"       // not started, or stopped by the user
+	StateCompiling    State = "compiling"     // building the workspace binary
+	StateBuildFailed  State = "build-failed"  // the last build failed and nothing is running
+	StateStarting     State = "starting"      // the daemon is starting
+	StateRunning      State = "running"       // the daemon is running
+	StateExited       State = "exited"        // the daemon exited without an error
+	StateCrashed      State = "crashed"       // the daemon exited with an error
+	StateCrashLooping State = "crash-looping" // the daemon kept crashing and isn't restarted
+)
+
+// WorkspaceDetail is the status of a workspace along with what it is doing
+// and details of its last exit and build. It is what observers are passed.
+type WorkspaceDetail struct {
+	Status WorkspaceStatus `json:"status" msgpack:"status"`
+	State  State           `json:"state" msgpack:"state"`
+	// Since is when the workspace entered State.
+	Since time.Time `json:"since" msgpack:"since"`
+	// PID and Uptime are of the running daemon, which keeps running while
+	// the workspace is compiling.
+	PID    int           `json:"pid,omitempty" msgpack:"pid"`
+	Uptime time.Duration `json:"uptime,omitempty" msgpack:"uptime"`
+	// ExitCode and Signal are of the last time the daemon exited. ExitCode
+	// is -1 if it was killed by Signal.
+	ExitCode int    `json:"exitCode" msgpack:"exitCode"`
+	Signal   string `json:"signal,omitempty" msgpack:"signal"`
+	// BuildDuration and BuildError are of the last build.
+	BuildDuration time.Duration `json:"buildDuration" msgpack:"buildDuration"`
+	BuildError    string        `json:"buildError,omitempty" msgpack:"buildError"`
+	// Output is the end of the console output when the daemon started
+	// crash looping.
+	Output []string `json:"output,omitempty" msgpack:"output"`
+
+	startedAt time.Time
+}
+
+// Summary describes the state of the workspace in a few words, such as
+// "crashed with exit code 2".
+func (d WorkspaceDetail) Summary() string {
+	switch d.State {
+	case StateRunning:
+		return fmt.Sprintf("running (pid %d, up %s)", d.PID, d.Uptime.Round(time.Second))
+	case StateCrashed, StateCrashLooping:
+		if d.Signal != "" {
+			return fmt.Sprintf("%s, killed by %s", d.State, d.Signal)
+		}
+		return fmt.Sprintf("%s with exit code %d", d.State, d.ExitCode)
+	case StateBuildFailed:
+		return fmt.Sprintf("build failed: %s", d.BuildError)
+	default:
+		return string(d.State)
+	}
+}
+
+// Detail returns the detailed status of the workspace.
+func (w *Workspace) Detail() WorkspaceDetail {
+	w.statMu.Lock()
+	defer w.statMu.Unlock()
+	d := w.detail
+	if d.PID != 0 {
+		d.Uptime = time.Since(d.startedAt)
+	}
+	return d
+}
+
+// update changes the detailed status and passes it to observers if it
+// changed. Since is set when the state changes.
+func (w *Workspace) update(f func(d *WorkspaceDetail)) {
+	w.statMu.Lock()
+	defer w.statMu.Unlock()
+	old := w.detail
+	f(&w.detail)
+	d := &w.detail
+	if d.State != old.State {
+		d.Since = time.Now()
+		if d.State != StateCrashLooping {
+			d.Output = nil
+		}
+	} else if d.Status == old.Status && d.PID == old.PID && d.BuildError == old.BuildError &&
+		d.BuildDuration == old.BuildDuration {
+		return
+	}
+	if d.Status != old.Status {
+		info(w.log, "[workspace]", w.Name, "state:", old.Status, "=>", d.Status)
+	}
+
+	w.obsMu.Lock()
+	for _, cb := range w.observers {
+		cb(w, *d)
+	}
+	w.obsMu.Unlock()
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -39,6 +40,8 @@ func (s *Service) InitializeDaemon() (err error) {
 
 func (s *Service) start() (err error) {
 	s.subcmd = subcmd.New(os.Args[0], "--", "systray")
+	// the tray stays up until the agent shuts down
+	s.subcmd.Policy = subcmd.RestartAlways
 	s.subcmd.Started = make(chan *exec.Cmd)
 	s.subcmd.Setup = func(cmd *exec.Cmd) error {
 
@@ -69,22 +72,12 @@ func (s *Service) Serve(ctx context.Context) {
 
 		var items []MenuItem
 		for idx, ws := range workspaces {
-			items = append(items, MenuItem{
-				Title:   ws.Name,
-				Tooltip: "Open workspace",
-				Icon:    ws.Status().String(),
-				Enabled: true,
-			})
-			ws.Observe(func(ws *agent.Workspace, status agent.WorkspaceStatus) {
+			items = append(items, *workspaceItem(ws, ws.Detail()))
+			ws.Observe(func(ws *agent.Workspace, detail agent.WorkspaceDetail) {
 				s.send(Message{
 					Type: ItemUpdate,
-					Item: &MenuItem{
-						Title:   ws.Name,
-						Tooltip: "Open workspace",
-						Icon:    status.String(),
-						Enabled: true,
-					},
-					Idx: idx,
+					Item: workspaceItem(ws, detail),
+					Idx:  idx,
 				})
 			})
 		}
@@ -112,8 +105,8 @@ func (s *Service) Serve(ctx context.Context) {
 					break
 				}
 				for _, ws := range workspaces {
-					if ws.Name == msg.Item.Title {
-						open.Start("http://localhost:3000/#" + ws.TargetPath)
+					if ws.DisplayName() == msg.Item.Title {
+						open.Start(ws.StudioURL())
 					}
 				}
 			default:
@@ -123,6 +116,17 @@ func (s *Service) Serve(ctx context.Context) {
 	}
 }
 
+// workspaceItem returns the menu item of a workspace, with an icon for its
+// status and what it is doing in the tooltip.
+func workspaceItem(ws *agent.Workspace, detail agent.WorkspaceDetail) *MenuItem {
+	return &MenuItem{
+		Title:   ws.DisplayName(),
+		Tooltip: fmt.Sprintf("Open workspace (%s)", detail.Summary()),
+		Icon:    detail.Status.String(),
+		Enabled: true,
+	}
+}
+
 func (s *Service) Reload() {
 	s.subcmd.Restart()
 }
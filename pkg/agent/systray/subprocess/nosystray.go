@@ -0,0 +1,17 @@
+//go:build nosystray
+// +build nosystray
+
+package subprocess
+
+import (
+	"fmt"
+	"os"
+)
+
+// Available is whether the system tray was built in.
+const Available = false
+
+func Run() {
+	fmt.Fprintln(os.Stderr, "tractor-agent was built without the system tray (nosystray), run it with --headless")
+	os.Exit(1)
+}
@@ -1,3 +1,6 @@
+//go:build !nosystray
+// +build !nosystray
+
 package subprocess
 
 import (
@@ -20,11 +23,17 @@ var (
 		"Unavailable": iconData.Unavailable,
 		"Available":   iconData.Available,
 		"Partially":   iconData.Partially,
+		// crash looping workspaces are shown as unavailable
+		"CrashLooping": iconData.Unavailable,
 	}
 
 	menuItems []*systray.MenuItem
 )
 
+// Available is whether the system tray was built in. It isn't when built
+// with the nosystray tag, which drops the GTK and appindicator dependencies.
+const Available = true
+
 func Run() {
 	go receiveMessages(inbox, os.Stdin)
 	systray.Run(onReady, nil)
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// defaultTemplatePath is the data/workspace directory of the source tree the
+// agent was built from, which new workspaces are scaffolded from unless the
+// config has a templateDir. It only exists where the agent was built.
+func defaultTemplatePath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "data", "workspace")
+}
+
+// scaffold copies the workspace template at src to the new directory dst.
+// Files ending in .data are copied without it, so the template can hold Go
+// files that aren't part of the tractor module. Relative replace directives
+// in go.mod that point outside the template are made absolute so they still
+// resolve from dst.
+func scaffold(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, strings.TrimSuffix(rel, ".data"))
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if rel == "go.mod" {
+			b = []byte(resolveReplaces(string(b), src))
+		}
+		return ioutil.WriteFile(target, b, fi.Mode().Perm())
+	})
+}
+
+// resolveReplaces returns the go.mod with replace targets starting with
+// ../ made absolute relative to dir.
+func resolveReplaces(gomod, dir string) string {
+	lines := strings.Split(gomod, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "replace ") {
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		target := strings.TrimSpace(parts[1])
+		if !strings.HasPrefix(target, "../") && target != ".." {
+			continue
+		}
+		abs, err := filepath.Abs(filepath.Join(dir, target))
+		if err != nil {
+			continue
+		}
+		lines[i] = parts[0] + "=> " + abs
+	}
+	return strings.Join(lines, "\n")
+}
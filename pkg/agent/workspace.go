@@ -1,10 +1,12 @@
 package agent
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,10 +15,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
 	"github.com/manifold/tractor/pkg/agent/console"
 	"github.com/manifold/tractor/pkg/data/icons"
 	"github.com/manifold/tractor/pkg/misc/buffer"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
 	"github.com/manifold/tractor/pkg/misc/logging"
+	"github.com/manifold/tractor/pkg/misc/runlog"
+	"github.com/manifold/tractor/pkg/misc/secret"
 	"github.com/manifold/tractor/pkg/misc/subcmd"
 	"github.com/radovskyb/watcher"
 )
@@ -27,8 +34,19 @@ const (
 	StatusAvailable   WorkspaceStatus = "Available"
 	StatusPartially   WorkspaceStatus = "Partially"
 	StatusUnavailable WorkspaceStatus = "Unavailable"
-
-	WatchInterval = 50 * time.Millisecond
+	// StatusCrashLooping is set when the daemon keeps crashing soon after
+	// starting and is no longer restarted until started again.
+	StatusCrashLooping WorkspaceStatus = "CrashLooping"
+
+	// CrashOutputLines is how many lines of console output are kept when the
+	// daemon starts crash looping.
+	CrashOutputLines = 20
+
+	// KeepBuilds is how many previous binaries are kept for rollback.
+	KeepBuilds = 3
+	// StartupGrace is how long a new binary has to run before it is trusted.
+	// If it crashes sooner, the workspace reverts to the previous binary.
+	StartupGrace = 5 * time.Second
 )
 
 func (s WorkspaceStatus) Icon() []byte {
@@ -46,7 +64,7 @@ func (s WorkspaceStatus) String() string {
 	return string(s)
 }
 
-type WorkspaceObserver func(*Workspace, WorkspaceStatus)
+type WorkspaceObserver func(*Workspace, WorkspaceDetail)
 
 type Workspace struct {
 	Name        string // base name of dir (~/.tractor/workspaces/{name})
@@ -54,21 +72,42 @@ type Workspace struct {
 	TargetPath  string // absolute path to target of symlink (actual workspace)
 	SocketPath  string // absolute path to socket file (~/.tractor/sockets/{name}.sock)
 	BinPath     string // absolute path to compiled binary (~/.tractor/bin/{name})
-
+	BuildPath   string // absolute path to the last build result (~/.tractor/bin/{name}.build.json)
+	KeyPath     string // absolute path to secret key file (~/.tractor/keys/{name})
+	TokenPath   string // absolute path to RPC token file (~/.tractor/tokens/{name})
+	Token       string // token clients present to the workspace daemon
+	GrantsPath  string // absolute path to limited client credentials (~/.tractor/grants/{name}.json)
+	LogPath     string // absolute path to the console log (~/.tractor/logs/{name}.log)
+
+	agent       *Agent
+	manifest    *Manifest
+	manifestMu  sync.RWMutex // guards manifest and daemonCmd
 	log         logging.Logger
-	status      WorkspaceStatus
+	detail      WorkspaceDetail
 	consolePipe io.WriteCloser
 	observers   []WorkspaceObserver
 	consoleBuf  *buffer.Buffer
+	consoleLog  *runlog.Log
+	consoleMu   sync.Mutex // orders writes to the console log and buffer
 	daemon      *subcmd.Subcmd
 	daemonCmd   []string
 	goBin       string
+	secretKey   secret.Key
+	build       *gobuild.Result
+	// promoted is set when a new binary is moved into place, and trial
+	// while the daemon runs it for the first time.
+	promoted  bool
+	trial     bool
+	startedAt time.Time
 
 	watcher *watcher.Watcher
 
-	starting sync.Mutex
+	starting sync.Mutex // serializes starting the daemon
+	daemonMu sync.Mutex // guards daemon
+	compile  sync.Mutex // serializes Recompile, which builds to the same path
 	statMu   sync.Mutex
 	obsMu    sync.Mutex
+	buildMu  sync.Mutex
 }
 
 func OpenWorkspace(a *Agent, name string) (*Workspace, error) {
@@ -83,21 +122,54 @@ func OpenWorkspace(a *Agent, name string) (*Workspace, error) {
 		consolePipe = svc.NewPipe(name)
 	}
 	socketPath := filepath.Join(a.WorkspaceSocketsPath, fmt.Sprintf("%s.sock", name))
+	paths := a.credentialPaths(name)
+	keyPath, tokenPath, grantsPath := paths[0], paths[1], paths[2]
+	key, err := secret.LoadKeyFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	token, err := secret.LoadTokenFile(tokenPath)
+	if err != nil {
+		return nil, err
+	}
 	ws := &Workspace{
 		Name:        name,
 		SymlinkPath: symlinkPath,
 		TargetPath:  targetPath,
 		SocketPath:  socketPath,
 		BinPath:     binPath,
-		status:      StatusPartially,
+		BuildPath:   binPath + ".build.json",
+		KeyPath:     keyPath,
+		TokenPath:   tokenPath,
+		GrantsPath:  grantsPath,
+		LogPath:     filepath.Join(a.WorkspaceLogsPath, fmt.Sprintf("%s.log", name)),
+		Token:       token,
+		secretKey:   key,
+		detail: WorkspaceDetail{
+			Status: StatusPartially,
+			State:  StateStopped,
+			Since:  time.Now(),
+		},
 		observers:   make([]WorkspaceObserver, 0),
+		agent:       a,
 		log:         a.Logger,
 		consolePipe: consolePipe,
 		goBin:       a.GoBin,
-		daemonCmd: []string{binPath,
-			"-proto", "unix", "-addr", socketPath},
 	}
-	ws.consoleBuf, err = buffer.NewBuffer(1024 * 1024)
+	if ws.manifest, err = LoadManifest(targetPath); err != nil {
+		logErr(a.Logger, "[workspace]", name, "ignoring invalid manifest:", err)
+	}
+	if build, err := gobuild.Load(ws.BuildPath); err == nil {
+		ws.build = build
+		ws.detail.BuildDuration = build.Duration
+		ws.detail.BuildError = buildError(build)
+	}
+	config := a.Config()
+	ws.consoleBuf, err = buffer.NewBuffer(config.ConsoleBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	ws.consoleLog, err = runlog.Open(ws.LogPath, config.LogMaxSize, config.LogMaxFiles, time.Duration(config.LogMaxAge))
 	if err != nil {
 		return nil, err
 	}
@@ -107,77 +179,393 @@ func OpenWorkspace(a *Agent, name string) (*Workspace, error) {
 func (w *Workspace) Status() WorkspaceStatus {
 	w.statMu.Lock()
 	defer w.statMu.Unlock()
-	return w.status
+	return w.detail.Status
 }
 
+// Recompile builds the workspace binary and vets the workspace if it built.
+// Their output goes to the console and is parsed into the build result,
+// which is saved, returned by LastBuild and sent to the running daemon.
 func (w *Workspace) Recompile() error {
-	cmd := exec.Command("go", "build", "-o", w.BinPath, ".")
-	cmd.Dir = w.TargetPath
-	if w.consolePipe != nil {
-		cmd.Stdout = w.consolePipe
-		cmd.Stderr = w.consolePipe
+	w.compile.Lock()
+	defer w.compile.Unlock()
+	var prev State
+	w.update(func(d *WorkspaceDetail) {
+		prev = d.State
+		d.State = StateCompiling
+	})
+	result := &gobuild.Result{
+		Time:        time.Now(),
+		Diagnostics: []gobuild.Diagnostic{},
+	}
+	bin := w.BinPath + ".new"
+	out, err := w.goTool(w.buildArgs(bin)...)
+	if err == nil {
+		err = w.promote(bin)
+	}
+	if err != nil {
+		os.Remove(bin)
+		result.Diagnostics = gobuild.Parse(gobuild.Compile, w.TargetPath, out)
 	} else {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		result.OK = true
+		// vet findings are warnings and don't fail the build
+		if out, err := w.goTool(append(append([]string{"vet"}, w.tagArgs()...), "./...")...); err != nil {
+			result.Diagnostics = gobuild.Parse(gobuild.Vet, w.TargetPath, out)
+		}
+	}
+	result.Duration = time.Since(result.Time)
+	w.setBuild(result)
+	daemon := w.currentDaemon()
+	running := daemon != nil && subcmd.Running(daemon)
+	w.update(func(d *WorkspaceDetail) {
+		d.BuildDuration = result.Duration
+		d.BuildError = buildError(result)
+		switch {
+		case !result.OK && !running:
+			d.State = StateBuildFailed
+		case prev == StateBuildFailed:
+			d.State = StateStopped
+		default:
+			// a running daemon keeps running the last good build
+			d.State = prev
+		}
+	})
+	return err
+}
+
+// buildError describes why a build failed, or is empty if it didn't.
+func buildError(result *gobuild.Result) string {
+	if result.OK {
+		return ""
+	}
+	errs := result.Errors()
+	if len(errs) == 0 {
+		return "build failed"
+	}
+	if errs[0].File == "" {
+		return errs[0].Message
+	}
+	return fmt.Sprintf("%s:%d: %s", errs[0].File, errs[0].Line, errs[0].Message)
+}
+
+// promote moves a newly built binary into place. The binary it replaces is
+// kept for rollback along with up to KeepBuilds-1 older ones.
+func (w *Workspace) promote(bin string) error {
+	w.buildMu.Lock()
+	defer w.buildMu.Unlock()
+	os.Remove(w.prevBinPath(KeepBuilds))
+	for n := KeepBuilds - 1; n > 0; n-- {
+		os.Rename(w.prevBinPath(n), w.prevBinPath(n+1))
+	}
+	if _, err := os.Stat(w.BinPath); err == nil {
+		if err := os.Rename(w.BinPath, w.prevBinPath(1)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(bin, w.BinPath); err != nil {
+		return err
+	}
+	w.promoted = true
+	return nil
+}
+
+// revert replaces the binary with the previous one kept by promote.
+func (w *Workspace) revert() error {
+	w.buildMu.Lock()
+	defer w.buildMu.Unlock()
+	if _, err := os.Stat(w.prevBinPath(1)); err != nil {
+		return errors.New("no previous build to roll back to")
+	}
+	if err := os.Rename(w.prevBinPath(1), w.BinPath); err != nil {
+		return err
+	}
+	for n := 2; n <= KeepBuilds; n++ {
+		os.Rename(w.prevBinPath(n), w.prevBinPath(n-1))
+	}
+	w.promoted = false
+	w.trial = false
+	return nil
+}
+
+func (w *Workspace) prevBinPath(n int) string {
+	return fmt.Sprintf("%s.prev%d", w.BinPath, n)
+}
+
+// removeBuilds removes the binaries and build result kept for the workspace.
+func (w *Workspace) removeBuilds() {
+	os.Remove(w.BinPath)
+	os.Remove(w.BuildPath)
+	for n := 1; n <= KeepBuilds; n++ {
+		os.Remove(w.prevBinPath(n))
+	}
+}
+
+// Rollback reverts the workspace to the previous build, restarting the
+// daemon if it is running.
+func (w *Workspace) Rollback() error {
+	info(w.log, "[workspace]", w.Name, "Rollback()")
+	if err := w.revert(); err != nil {
+		return err
+	}
+	if daemon := w.currentDaemon(); daemon != nil && subcmd.Running(daemon) {
+		return daemon.Restart()
+	}
+	return nil
+}
+
+// started records that the daemon started, putting a newly promoted binary
+// on trial.
+func (w *Workspace) started() {
+	w.buildMu.Lock()
+	defer w.buildMu.Unlock()
+	w.trial = w.promoted
+	w.promoted = false
+	w.startedAt = time.Now()
+}
+
+// crashedOnTrial returns whether the daemon exiting with the status was a
+// binary on trial crashing within StartupGrace. Binaries that run longer or
+// exit cleanly are trusted from then on.
+func (w *Workspace) crashedOnTrial(exitStatus int) bool {
+	w.buildMu.Lock()
+	defer w.buildMu.Unlock()
+	if !w.trial {
+		return false
+	}
+	w.trial = false
+	// -1 is being killed by a signal, such as when restarting
+	return exitStatus > 0 && time.Since(w.startedAt) < StartupGrace
+}
+
+// revertCrash rolls back to the previous build after a new binary crashed on
+// startup, for the daemon to restart with.
+func (w *Workspace) revertCrash(exitErr error) {
+	logErr(w.log, "[workspace]", w.Name, "new build crashed on startup:", exitErr)
+	if err := w.revert(); err != nil {
+		logErr(w.log, "[workspace]", w.Name, "unable to roll back:", err)
+		return
+	}
+	info(w.log, "[workspace]", w.Name, "rolled back to the previous build")
+}
+
+// CrashOutput returns the last lines of console output from when the
+// daemon started crash looping, or nil if it isn't.
+func (w *Workspace) CrashOutput() []string {
+	w.statMu.Lock()
+	defer w.statMu.Unlock()
+	return w.detail.Output
+}
+
+// lastLines returns up to n of the last lines of b.
+func lastLines(b []byte, n int) []string {
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}
+	}
+	return lines
+}
+
+// goTool runs a go command in the workspace, copying its output to the
+// console, and returns the output.
+func (w *Workspace) goTool(args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	var console io.Writer = os.Stderr
+	if w.consolePipe != nil {
+		console = w.consolePipe
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = w.TargetPath
+	cmd.Stdout = io.MultiWriter(console, &out)
+	cmd.Stderr = cmd.Stdout
+	err := cmd.Run()
+	return out.Bytes(), err
+}
+
+// LastBuild returns the result of the last build of the workspace, or nil if
+// it hasn't been built.
+func (w *Workspace) LastBuild() *gobuild.Result {
+	w.buildMu.Lock()
+	defer w.buildMu.Unlock()
+	return w.build
+}
+
+func (w *Workspace) setBuild(result *gobuild.Result) {
+	w.buildMu.Lock()
+	w.build = result
+	w.buildMu.Unlock()
+	if err := result.Save(w.BuildPath); err != nil {
+		logErr(w.log, "unable to save build result:", err)
+	}
+	if daemon := w.currentDaemon(); daemon != nil && subcmd.Running(daemon) && w.listensOnSocket() {
+		// a daemon started after this loads the result with -build
+		go w.sendBuild(result)
 	}
-	return cmd.Run()
+}
+
+// sendBuild passes a build result to the running daemon, which shows it in
+// the workspace view.
+func (w *Workspace) sendBuild(result *gobuild.Result) {
+	sess, err := mux.DialUnix(w.SocketPath)
+	if err != nil {
+		info(w.log, "unable to send build result:", err)
+		return
+	}
+	defer sess.Close()
+	client := &qrpc.Client{Session: sess}
+	if _, err := client.Call("authenticate", w.Token, nil); err != nil {
+		info(w.log, "unable to send build result:", err)
+		return
+	}
+	if _, err := client.Call("setBuild", result, nil); err != nil {
+		info(w.log, "unable to send build result:", err)
+	}
+}
+
+// Config returns the configuration of the agent of the workspace.
+func (w *Workspace) Config() Config {
+	return w.agent.Config()
+}
+
+// StudioURL returns the URL that opens the workspace in Studio. It carries
+// the workspace token so Studio can authenticate with the workspace daemon.
+func (w *Workspace) StudioURL() string {
+	return fmt.Sprintf("%s/?token=%s#%s", strings.TrimSuffix(w.Config().StudioURL, "/"), url.QueryEscape(w.Token), w.TargetPath)
 }
 
 func (w *Workspace) SetDaemonCmd(args ...string) {
+	w.manifestMu.Lock()
+	defer w.manifestMu.Unlock()
 	w.daemonCmd = args
 }
 
+// daemonCommand returns the command running the daemon, as set by
+// SetDaemonCmd or otherwise from the manifest.
+func (w *Workspace) daemonCommand() []string {
+	w.manifestMu.RLock()
+	args := w.daemonCmd
+	w.manifestMu.RUnlock()
+	if args != nil {
+		return args
+	}
+	return w.daemonArgs()
+}
+
+// daemonEnviron returns the environment of the daemon.
+func (w *Workspace) daemonEnviron() []string {
+	return append(append(os.Environ(), w.daemonEnv()...),
+		fmt.Sprintf("%s=%s", secret.EnvKey, w.secretKey),
+		fmt.Sprintf("%s=%s", secret.EnvToken, w.Token))
+}
+
 func (w *Workspace) signal(sig os.Signal) {
-	if w.daemon != nil {
-		w.daemon.Signal(sig)
+	if daemon := w.currentDaemon(); daemon != nil {
+		daemon.Signal(sig)
 	}
 }
 
 func (w *Workspace) StartDaemon() error {
-	if w.daemon != nil {
+	if w.currentDaemon() != nil {
 		return errors.New("daemon already started")
 	}
 	if err := w.Recompile(); err != nil {
-		return err
+		if _, statErr := os.Stat(w.BinPath); statErr != nil {
+			return err
+		}
+		logErr(w.log, "[workspace]", w.Name, "build failed, starting the last good build:", err)
 	}
-	w.daemon = subcmd.New(w.daemonCmd[0], w.daemonCmd[1:]...)
-	w.daemon.Setup = func(cmd *exec.Cmd) error {
+	args := w.daemonCommand()
+	daemon := subcmd.New(args[0], args[1:]...)
+	daemon.Policy = subcmd.RestartOnFailure
+	daemon.StopTimeout = time.Duration(w.Config().StopTimeout)
+	daemon.Setup = func(cmd *exec.Cmd) error {
 		w.consoleBuf.Reset()
+		if _, err := w.consoleLog.StartRun(); err != nil {
+			logErr(w.log, "[workspace]", w.Name, "console log:", err)
+		}
 
+		// the manifest may have changed since the last run
+		cmd.Args = w.daemonCommand()
+		cmd.Env = w.daemonEnviron()
 		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 		cmd.Dir = w.TargetPath
 		cmd.StdinPipe()
-		if w.consolePipe != nil {
-			cmd.Stdout = io.MultiWriter(w.consoleBuf, w.consolePipe)
-			cmd.Stderr = io.MultiWriter(w.consoleBuf, w.consolePipe)
-		} else {
-			cmd.Stdout = w.consoleBuf
-			cmd.Stderr = w.consoleBuf
-		}
+		cmd.Stdout = consoleWriter{w}
+		cmd.Stderr = cmd.Stdout
 
 		return nil
 	}
 
-	w.daemon.Observe(func(cmd *subcmd.Subcmd, status subcmd.Status) {
+	daemon.Observe(func(cmd *subcmd.Subcmd, status subcmd.Status) {
 		switch status {
+		case subcmd.StatusStarting:
+			w.update(func(d *WorkspaceDetail) {
+				d.State = StateStarting
+			})
 		case subcmd.StatusStarted:
-			w.setStatus(StatusAvailable)
+			w.started()
+			pid := cmd.PID()
+			w.update(func(d *WorkspaceDetail) {
+				d.Status = StatusAvailable
+				d.State = StateRunning
+				d.PID = pid
+				d.startedAt = time.Now()
+			})
 		case subcmd.StatusExited:
 			w.cleanup()
-			if cmd.Error() != nil {
-				//info(w.log, cmd.Error())
-				w.setStatus(StatusUnavailable)
-			} else {
-				w.setStatus(StatusPartially)
+			exitErr := cmd.Error()
+			exitCode, signal := cmd.ExitStatus(), cmd.ExitSignal()
+			how := fmt.Sprintf("exited with code %d", exitCode)
+			if signal != nil {
+				how = fmt.Sprintf("killed by %s", signal)
+			}
+			w.consoleLog.EndRun(how)
+			w.update(func(d *WorkspaceDetail) {
+				d.PID = 0
+				d.ExitCode = exitCode
+				d.Signal = ""
+				if signal != nil {
+					d.Signal = signal.String()
+				}
+				if exitErr != nil {
+					d.Status = StatusUnavailable
+					d.State = StateCrashed
+				} else {
+					d.Status = StatusPartially
+					d.State = StateExited
+				}
+			})
+			if exitErr != nil && w.crashedOnTrial(exitCode) {
+				w.revertCrash(exitErr)
 			}
 		case subcmd.StatusStopped:
 			w.cleanup()
-			w.setStatus(StatusUnavailable)
+			w.consoleLog.EndRun("stopped")
+			w.update(func(d *WorkspaceDetail) {
+				d.Status = StatusUnavailable
+				d.State = StateStopped
+				d.PID = 0
+			})
+		case subcmd.StatusCrashLooping:
+			output := lastLines(w.consoleBuf.Bytes(), CrashOutputLines)
+			logErr(w.log, "[workspace]", w.Name, "crash looping, not restarting:", cmd.Error())
+			w.update(func(d *WorkspaceDetail) {
+				d.Status = StatusCrashLooping
+				d.State = StateCrashLooping
+				d.Output = output
+			})
 		}
 	})
 
-	if err := w.daemon.Start(); err != nil {
-		w.setStatus(StatusUnavailable)
+	w.daemonMu.Lock()
+	w.daemon = daemon
+	w.daemonMu.Unlock()
+	if err := daemon.Start(); err != nil {
+		w.update(func(d *WorkspaceDetail) {
+			d.Status = StatusUnavailable
+			d.State = StateStopped
+		})
 		return err
 	}
 
@@ -191,20 +579,31 @@ func (w *Workspace) cleanup() {
 }
 
 func (w *Workspace) Serve(ctx context.Context) {
-	w.StartDaemon()
+	if w.autostart() {
+		w.starting.Lock()
+		w.StartDaemon()
+		w.starting.Unlock()
+	} else {
+		info(w.log, "[workspace]", w.Name, "not started, autostart is off")
+	}
 
 	w.watcher = watcher.New()
 	// w.watcher.SetMaxEvents(1)
 	w.watcher.IgnoreHiddenFiles(true)
 	w.watcher.AddFilterHook(func(info os.FileInfo, fullPath string) error {
-		allowedExt := []string{".go", ".ts", ".tsx", ".js", ".jsx", ".html"}
-		ignoreSubstr := []string{"node_modules"}
-		for _, substr := range ignoreSubstr {
+		if w.isManifest(fullPath) {
+			return nil
+		}
+		if w.watchIgnored(fullPath) {
+			return watcher.ErrSkip
+		}
+		config := w.Config()
+		for _, substr := range config.WatchIgnore {
 			if strings.Contains(fullPath, substr) {
 				return watcher.ErrSkip
 			}
 		}
-		for _, ext := range allowedExt {
+		for _, ext := range config.WatchExtensions {
 			if filepath.Ext(info.Name()) == ext {
 				return nil
 			}
@@ -218,7 +617,8 @@ func (w *Workspace) Serve(ctx context.Context) {
 		return
 	}
 
-	debounce := Debounce(WatchInterval)
+	interval := time.Duration(w.Config().WatchInterval)
+	debounce := Debounce(interval)
 	go func() {
 		for {
 			select {
@@ -245,7 +645,11 @@ func (w *Workspace) Serve(ctx context.Context) {
 					// }
 				}
 
-				if filepath.Ext(event.Path) != ".go" { //&& !dirCreated
+				if w.isManifest(event.Path) {
+					if w.ReloadManifest() != nil {
+						continue
+					}
+				} else if filepath.Ext(event.Path) != ".go" { //&& !dirCreated
 					continue
 				}
 
@@ -257,8 +661,19 @@ func (w *Workspace) Serve(ctx context.Context) {
 						info(w.log, err)
 						return
 					}
+					if !w.daemonStarted() {
+						if w.autostart() {
+							// it couldn't start without a good build
+							info(w.log, "starting workspace:", w.Name)
+							if err := w.startDaemon(); err != nil {
+								info(w.log, err)
+							}
+						}
+						// otherwise built for when it is started
+						return
+					}
 					info(w.log, "reloading workspace:", w.Name)
-					if err := w.daemon.Restart(); err != nil {
+					if err := w.currentDaemon().Restart(); err != nil {
 						info(w.log, err)
 					}
 				})
@@ -274,7 +689,7 @@ func (w *Workspace) Serve(ctx context.Context) {
 		}
 	}()
 
-	if err := w.watcher.Start(WatchInterval); err != nil {
+	if err := w.watcher.Start(interval); err != nil {
 		logErr(w.log, "watcher error:", err)
 	}
 }
@@ -282,29 +697,146 @@ func (w *Workspace) Serve(ctx context.Context) {
 func (w *Workspace) Connect() (io.ReadCloser, error) {
 	info(w.log, "[workspace]", w.Name, "Connect()")
 	var err error
-	if !subcmd.Running(w.daemon) {
-		err = w.daemon.Start()
+	if daemon := w.currentDaemon(); daemon == nil {
+		err = w.startDaemon()
+	} else if !subcmd.Running(daemon) {
+		err = daemon.Start()
 	}
 	out := w.consoleBuf.Pipe()
 	return out, err
 }
 
+// ConnectFrom is like Connect, but replays the console log selected by q
+// instead of the recent output, which survives restarts of the daemon and
+// the agent.
+func (w *Workspace) ConnectFrom(q runlog.Query) (io.ReadCloser, error) {
+	info(w.log, "[workspace]", w.Name, "ConnectFrom()")
+	var err error
+	if daemon := w.currentDaemon(); daemon == nil {
+		err = w.startDaemon()
+	} else if !subcmd.Running(daemon) {
+		err = daemon.Start()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w.FollowFrom(q)
+}
+
+// Output returns the recent console output of the workspace daemon.
+func (w *Workspace) Output() []byte {
+	return w.consoleBuf.Bytes()
+}
+
+// Follow returns a reader of the recent console output followed by output
+// as it is written. Unlike Connect, it doesn't start the daemon.
+func (w *Workspace) Follow() io.ReadCloser {
+	return w.consoleBuf.Pipe()
+}
+
+// Replay returns the console log selected by q, with markers where runs of
+// the daemon started and ended.
+func (w *Workspace) Replay(q runlog.Query) ([]byte, error) {
+	entries, err := w.consoleLog.Replay(q)
+	if err != nil {
+		return nil, err
+	}
+	return runlog.Format(entries), nil
+}
+
+// FollowFrom returns a reader of the console log selected by q followed by
+// output as it is written. Like Follow, it doesn't start the daemon.
+func (w *Workspace) FollowFrom(q runlog.Query) (io.ReadCloser, error) {
+	// no output is written between replaying and following
+	w.consoleMu.Lock()
+	defer w.consoleMu.Unlock()
+	tail := w.consoleBuf.Tail()
+	history, err := w.Replay(q)
+	if err != nil {
+		tail.Close()
+		return nil, err
+	}
+	return &replayReader{Reader: io.MultiReader(bytes.NewReader(history), tail), tail: tail}, nil
+}
+
+type replayReader struct {
+	io.Reader
+	tail io.ReadCloser
+}
+
+func (r *replayReader) Close() error {
+	return r.tail.Close()
+}
+
+// consoleWriter writes daemon output to the console log, the console buffer
+// and the agent console.
+type consoleWriter struct {
+	w *Workspace
+}
+
+func (c consoleWriter) Write(p []byte) (int, error) {
+	c.w.consoleMu.Lock()
+	defer c.w.consoleMu.Unlock()
+	// output isn't lost if it can't be logged
+	c.w.consoleLog.Write(p)
+	n, err := c.w.consoleBuf.Write(p)
+	if err != nil || c.w.consolePipe == nil {
+		return n, err
+	}
+	return c.w.consolePipe.Write(p)
+}
+
 // Start starts the workspace daemon. creates the symlink to the path if it does
 // not exist, using the path basename as the symlink name
 func (w *Workspace) Start() error {
 	info(w.log, "[workspace]", w.Name, "Start()")
-	return w.daemon.Restart()
+	if daemon := w.currentDaemon(); daemon != nil {
+		return daemon.Restart()
+	}
+	return w.startDaemon()
+}
+
+// daemonStarted reports whether the daemon was set up by StartDaemon, which
+// it isn't before a workspace without autostart is first started.
+func (w *Workspace) daemonStarted() bool {
+	return w.currentDaemon() != nil
+}
+
+// currentDaemon returns the daemon set up by StartDaemon, or nil.
+func (w *Workspace) currentDaemon() *subcmd.Subcmd {
+	w.daemonMu.Lock()
+	defer w.daemonMu.Unlock()
+	return w.daemon
+}
+
+// startDaemon starts the daemon unless it was started meanwhile.
+func (w *Workspace) startDaemon() error {
+	w.starting.Lock()
+	defer w.starting.Unlock()
+	if daemon := w.currentDaemon(); daemon != nil {
+		return daemon.Restart()
+	}
+	return w.StartDaemon()
 }
 
 // Stop stops the workspace daemon, deleting the unix socket file.
 func (w *Workspace) Stop() error {
 	info(w.log, "[workspace]", w.Name, "Stop()")
-	if w.daemon != nil {
-		return w.daemon.Stop()
+	if daemon := w.currentDaemon(); daemon != nil {
+		return daemon.Stop()
 	}
 	return nil
 }
 
+// close stops the workspace daemon and watching for changes.
+func (w *Workspace) close() {
+	w.Stop()
+	if w.watcher != nil {
+		w.watcher.Close()
+	}
+	w.consoleLog.Close()
+}
+
 func (w *Workspace) Observe(cb WorkspaceObserver) {
 	w.obsMu.Lock()
 	w.observers = append(w.observers, cb)
@@ -314,20 +846,3 @@ func (w *Workspace) Observe(cb WorkspaceObserver) {
 func (w *Workspace) BufferStatus() (int, int64) {
 	return w.consoleBuf.Status()
 }
-
-func (w *Workspace) setStatus(s WorkspaceStatus) {
-	w.statMu.Lock()
-	if w.status == s {
-		w.statMu.Unlock()
-		return
-	}
-	info(w.log, "[workspace]", w.Name, "state:", w.status, "=>", s)
-
-	w.status = s
-	w.obsMu.Lock()
-	for _, cb := range w.observers {
-		cb(w, s)
-	}
-	w.obsMu.Unlock()
-	w.statMu.Unlock()
-}
@@ -5,8 +5,11 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,9 +22,19 @@ func TestWorkspace(t *testing.T) {
 	t.Run("stop/start", func(t *testing.T) {
 		status, ws := setupWorkspace(t, ag, "test1")
 		assert.Equal(t, StatusAvailable, <-status)
+		assert.Len(t, ws.Token, 64)
+		detail := ws.Detail()
+		assert.Equal(t, StateRunning, detail.State)
+		assert.NotZero(t, detail.PID)
+		assert.Empty(t, detail.BuildError)
+		assert.NotZero(t, detail.BuildDuration)
 
 		assert.Nil(t, ws.Stop())
 		assert.Equal(t, StatusUnavailable, <-status)
+		detail = ws.Detail()
+		assert.Equal(t, StateStopped, detail.State)
+		assert.Zero(t, detail.PID)
+		assert.Equal(t, "stopped", detail.Summary())
 
 		assert.Nil(t, ws.Start())
 		assert.Equal(t, StatusAvailable, <-status)
@@ -43,6 +56,30 @@ func TestWorkspace(t *testing.T) {
 		assert.Equal(t, StatusUnavailable, <-status)
 	})
 
+	t.Run("recompile/start", func(t *testing.T) {
+		ws := ag.Workspace("test3")
+		require.NotNil(t, ws)
+		status := make(chan WorkspaceStatus, 3)
+		last := ws.Status()
+		ws.Observe(func(_ *Workspace, detail WorkspaceDetail) {
+			if detail.Status != last {
+				last = detail.Status
+				status <- detail.Status
+			}
+		})
+
+		// the watcher recompiles while the workspace may be starting
+		recompiled := make(chan error)
+		go func() {
+			recompiled <- ws.Recompile()
+		}()
+		require.NoError(t, ws.Start())
+		assert.NoError(t, <-recompiled)
+		assert.Equal(t, StatusAvailable, <-status)
+		assert.NoError(t, ws.Stop())
+		assert.Equal(t, StatusUnavailable, <-status)
+	})
+
 	// t.Run("connect/stop", func(t *testing.T) {
 	// 	ws := ag.Workspace("test3")
 	// 	require.NotNil(t, ws)
@@ -71,16 +108,86 @@ func TestWorkspace(t *testing.T) {
 
 		assert.Equal(t, 1, ws.daemon.ExitStatus())
 		assert.Equal(t, StatusUnavailable, <-status)
+
+		// it is restarted with backoff until it is crash looping
+		timeout := time.After(10 * time.Second)
+		for crashLooping := false; !crashLooping; {
+			select {
+			case s := <-status:
+				crashLooping = s == StatusCrashLooping
+			case <-timeout:
+				require.FailNow(t, "workspace not crash looping")
+			}
+		}
+		detail := ws.Detail()
+		assert.Equal(t, StateCrashLooping, detail.State)
+		assert.Equal(t, 1, detail.ExitCode)
+		assert.Equal(t, "crash-looping with exit code 1", detail.Summary())
+		output := ws.CrashOutput()
+		require.NotEmpty(t, output)
+		assert.True(t, strings.HasPrefix(output[len(output)-1], "boomtown "))
 	})
 }
 
+func TestWorkspaceBuilds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-agent-builds-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ws := &Workspace{Name: "builds", BinPath: filepath.Join(dir, "builds")}
+
+	bin := func() string {
+		b, err := ioutil.ReadFile(ws.BinPath)
+		require.NoError(t, err)
+		return string(b)
+	}
+	promote := func(content string) {
+		tmp := ws.BinPath + ".new"
+		require.NoError(t, ioutil.WriteFile(tmp, []byte(content), 0755))
+		require.NoError(t, ws.promote(tmp))
+	}
+
+	assert.Error(t, ws.Rollback())
+	for i := 1; i <= KeepBuilds+2; i++ {
+		promote(strings.Repeat("v", i))
+	}
+	assert.Equal(t, "vvvvv", bin())
+	_, err = os.Stat(ws.prevBinPath(KeepBuilds + 1))
+	assert.True(t, os.IsNotExist(err))
+
+	// a new binary crashing on startup is reverted, one killed to restart isn't
+	ws.started()
+	assert.True(t, ws.crashedOnTrial(1))
+	ws.started()
+	assert.False(t, ws.crashedOnTrial(1))
+	promote("next")
+	ws.started()
+	assert.False(t, ws.crashedOnTrial(-1))
+
+	for _, want := range []string{"vvvvv", "vvvv", "vvv"} {
+		require.NoError(t, ws.Rollback())
+		assert.Equal(t, want, bin())
+	}
+	assert.Error(t, ws.Rollback())
+	assert.Equal(t, "vvv", bin())
+
+	ws.removeBuilds()
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
 func setupWorkspace(t *testing.T, ag *Agent, name string) (chan WorkspaceStatus, *Workspace) {
 	status := make(chan WorkspaceStatus, 3)
 	ws := ag.Workspace(name)
 	require.NotNil(t, ws)
 	//ws.SetDaemonCmd("cat")
-	ws.Observe(func(_ *Workspace, newStatus WorkspaceStatus) {
-		status <- newStatus
+	last := ws.Status()
+	ws.Observe(func(_ *Workspace, detail WorkspaceDetail) {
+		// only changes of status, not every detail
+		if detail.Status != last {
+			last = detail.Status
+			status <- detail.Status
+		}
 	})
 	require.NoError(t, ws.StartDaemon())
 	return status, ws
@@ -280,6 +280,17 @@ type ObjectSnapshot struct {
 	Main       string
 }
 
+// Err returns the error of the first component snapshot that is incomplete.
+// Such snapshots must not be written.
+func (s ObjectSnapshot) Err() error {
+	for _, com := range s.Components {
+		if com.Err != nil {
+			return com.Err
+		}
+	}
+	return nil
+}
+
 type ComponentSnapshot struct {
 	ObjectID string
 	ID       string
@@ -288,6 +299,9 @@ type ComponentSnapshot struct {
 	Attrs    map[string]interface{}
 	Value    interface{}
 	Refs     []SnapshotRef
+	// Err is set when the value could not be captured completely, such as
+	// when a secret field could not be sealed.
+	Err error `json:"-"`
 }
 
 type SnapshotRef struct {
@@ -0,0 +1,345 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/rs/xid"
+	"github.com/spf13/afero"
+)
+
+const (
+	BundleVersion = 1
+
+	bundleManifest = "manifest.json"
+)
+
+// BundleManifest describes the contents of a bundle.
+type BundleManifest struct {
+	Version int
+
+	// Path is the path of the exported object in its original tree.
+	Path string
+
+	// Objects are the IDs of the exported objects in tree order, starting
+	// with the exported object.
+	Objects []string
+
+	// Components are the names of the component types the objects require.
+	Components []string
+
+	// Packages are the IDs of objects that have a delegate package
+	// in the bundle.
+	Packages []string
+}
+
+// ImportResult reports what happened while importing a bundle.
+type ImportResult struct {
+	// Object is the top-most imported object.
+	Object manifold.Object
+
+	// Missing are component types in the bundle that are not registered.
+	// Components of these types are skipped.
+	Missing []string
+
+	// Pending are IDs of imported objects whose delegate components will
+	// be available after the workspace is recompiled. Their snapshots are
+	// kept in the image until then.
+	Pending []string
+}
+
+// Export writes a bundle of obj and its descendants to w. The bundle is a
+// gzipped tar archive with a manifest, the object snapshots, and any delegate
+// packages under pkg/obj owned by the objects. Secret fields stay sealed with
+// the key of this workspace.
+func (i *Image) Export(obj manifold.Object, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := BundleManifest{
+		Version: BundleVersion,
+		Path:    obj.Path(),
+	}
+	components := make(map[string]bool)
+	var snapshots []manifold.ObjectSnapshot
+	manifold.Walk(obj, func(o manifold.Object) {
+		snapshot := o.Snapshot()
+		snapshots = append(snapshots, snapshot)
+		manifest.Objects = append(manifest.Objects, o.ID())
+		for _, c := range snapshot.Components {
+			if c.ID == "" {
+				components[c.Name] = true
+			}
+		}
+	})
+	for name := range components {
+		manifest.Components = append(manifest.Components, name)
+	}
+	sort.Strings(manifest.Components)
+
+	for _, snapshot := range snapshots {
+		if err := snapshot.Err(); err != nil {
+			return err
+		}
+	}
+	for _, snapshot := range snapshots {
+		n, err := i.exportPackage(tw, snapshot.ID)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			manifest.Packages = append(manifest.Packages, snapshot.ID)
+		}
+		buf, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, path.Join(ObjectDir, snapshot.ID+".json"), buf); err != nil {
+			return err
+		}
+	}
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, bundleManifest, buf); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// exportPackage adds the files of the delegate package for the object ID to
+// the archive and returns how many were added.
+func (i *Image) exportPackage(tw *tar.Writer, id string) (int, error) {
+	dir := path.Join(PackageDir, ObjectDir, id)
+	if ok, _ := afero.DirExists(i.fs, dir); !ok {
+		return 0, nil
+	}
+	var n int
+	err := afero.Walk(i.fs, dir, func(filepath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		buf, err := afero.ReadFile(i.fs, filepath)
+		if err != nil {
+			return err
+		}
+		n++
+		return writeTarFile(tw, path.Join(PackageDir, id, strings.TrimPrefix(filepath, dir+"/")), buf)
+	})
+	return n, err
+}
+
+// Import reads a bundle written by Export and appends its objects under
+// parent. Objects are given new IDs, delegate packages are copied into
+// pkg/obj with the new IDs, and pkg/obj/import.go is regenerated.
+func (i *Image) Import(parent manifold.Object, r io.Reader) (*ImportResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *BundleManifest
+	snapshots := make(map[string]manifold.ObjectSnapshot)
+	packages := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == bundleManifest:
+			manifest = &BundleManifest{}
+			if err := json.Unmarshal(buf, manifest); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, ObjectDir+"/"):
+			var snapshot manifold.ObjectSnapshot
+			if err := json.Unmarshal(buf, &snapshot); err != nil {
+				return nil, err
+			}
+			snapshots[snapshot.ID] = snapshot
+		case strings.HasPrefix(name, PackageDir+"/"):
+			packages[name] = buf
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", bundleManifest)
+	}
+	if manifest.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", manifest.Version)
+	}
+	if len(manifest.Objects) == 0 {
+		return nil, fmt.Errorf("bundle has no objects")
+	}
+
+	result := &ImportResult{}
+	for _, name := range manifest.Components {
+		if library.Lookup(name) == nil {
+			result.Missing = append(result.Missing, name)
+		}
+	}
+
+	// check the whole bundle before anything is written to the workspace
+	ids := make(map[string]string)
+	for _, id := range manifest.Objects {
+		if _, ok := snapshots[id]; !ok {
+			return nil, fmt.Errorf("bundle is missing object: %s", id)
+		}
+		ids[id] = xid.New().String()
+	}
+	for _, id := range manifest.Packages {
+		if _, ok := ids[id]; !ok {
+			return nil, fmt.Errorf("bundle has a package for unknown object: %s", id)
+		}
+	}
+
+	if err := i.importPackages(manifest, packages, ids); err != nil {
+		return nil, err
+	}
+
+	var refs []manifold.SnapshotRef
+	objects := make(map[string]manifold.Object)
+	for _, oldID := range manifest.Objects {
+		snapshot := snapshots[oldID]
+		snapshot.ID = ids[oldID]
+		obj := object.FromSnapshot(snapshot)
+		for _, c := range snapshot.Components {
+			id := c.ID
+			if newID, ok := ids[id]; ok {
+				id = newID
+			}
+			if id != "" && library.LookupID(id) == nil {
+				// keep the delegate to be loaded once the workspace recompiles
+				i.addPending(obj.ID(), pendingSnapshot(c, obj.ID(), id, ids), snapshot.Main != "" && c.ID == snapshot.Main)
+				result.Pending = append(result.Pending, obj.ID())
+				continue
+			}
+			if id == "" && library.Lookup(c.Name) == nil {
+				continue
+			}
+			com := library.NewComponent(c.Name, c.Value, id)
+			com.SetEnabled(c.Enabled)
+			obj.AppendComponent(com)
+			if snapshot.Main != "" && c.ID == snapshot.Main {
+				obj.SetMain(com)
+			}
+			refs = append(refs, c.Refs...)
+		}
+		objects[snapshot.ID] = obj
+		if p, ok := objects[ids[snapshot.ParentID]]; ok {
+			p.AppendChild(obj)
+		}
+	}
+
+	root := objects[ids[manifest.Objects[0]]]
+	for _, ref := range refs {
+		src := objects[ids[ref.ObjectID]]
+		dst := objects[ids[ref.TargetID]]
+		if dst == nil {
+			// references outside the bundle are kept if the target exists
+			dst = parent.Root().FindID(ref.TargetID)
+		}
+		if src == nil || dst == nil {
+			log.Printf("dropping snapshot ref at %s, target %s not found", ref.Path, ref.TargetID)
+			continue
+		}
+		if err := restoreRef(src, dst, ref); err != nil {
+			log.Printf("unable to restore snapshot ref at %s: %s", ref.Path, err)
+		}
+	}
+
+	parent.AppendChild(root)
+	manifold.Walk(root, func(o manifold.Object) {
+		o.UpdateRegistry()
+		for _, c := range o.Components() {
+			if e, ok := c.Pointer().(componentEnabler); ok {
+				e.ComponentEnable()
+			}
+		}
+	})
+
+	result.Object = root
+	return result, nil
+}
+
+// pendingSnapshot returns the component snapshot c of the imported object
+// objID with the new component ID and refs to imported objects updated.
+func pendingSnapshot(c manifold.ComponentSnapshot, objID, id string, ids map[string]string) manifold.ComponentSnapshot {
+	c.ObjectID = objID
+	c.ID = id
+	refs := make([]manifold.SnapshotRef, len(c.Refs))
+	for n, ref := range c.Refs {
+		ref.ObjectID = objID
+		if newID, ok := ids[ref.TargetID]; ok {
+			ref.TargetID = newID
+		}
+		refs[n] = ref
+	}
+	c.Refs = refs
+	return c
+}
+
+// importPackages writes the delegate packages from a bundle to pkg/obj using
+// the new object IDs, then reindexes the object packages.
+func (i *Image) importPackages(manifest *BundleManifest, packages map[string][]byte, ids map[string]string) error {
+	if len(manifest.Packages) == 0 {
+		return nil
+	}
+	for name, buf := range packages {
+		parts := strings.SplitN(strings.TrimPrefix(name, PackageDir+"/"), "/", 2)
+		newID, ok := ids[parts[0]]
+		if !ok || len(parts) < 2 {
+			continue
+		}
+		// delegate packages register their component with the object ID
+		buf = bytes.Replace(buf, []byte(parts[0]), []byte(newID), -1)
+		filepath := path.Join(PackageDir, ObjectDir, newID, parts[1])
+		if err := i.fs.MkdirAll(path.Dir(filepath), 0755); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(i.fs, filepath, buf, 0644); err != nil {
+			return err
+		}
+	}
+	return i.IndexObjectPackages()
+}
+
+func writeTarFile(tw *tar.Writer, name string, buf []byte) error {
+	hdr := &tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(buf)),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(buf)
+	return err
+}
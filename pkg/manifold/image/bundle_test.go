@@ -0,0 +1,132 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unregisteredComponent struct{}
+
+type bundleDelegate struct {
+	Greeting string
+}
+
+func TestBundle(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "tractor-pkg-image-src-")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "tractor-pkg-image-dst-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+
+	root := object.New("::root")
+	web := object.New("Web")
+	handler := object.New("Handler")
+	root.AppendChild(web)
+	web.AppendChild(handler)
+	handler.AppendComponent(newTestComponent(t, &imageTarget{}))
+	com := newTestComponent(t, &imageSource{})
+	web.AppendComponent(com)
+	web.AppendComponent(library.NewComponent("image.unregisteredComponent", &unregisteredComponent{}, ""))
+	target := handler.Components()[0].Pointer().(*imageTarget)
+	com.Pointer().(*imageSource).Handlers = []http.Handler{target}
+
+	// a delegate as registered by the compiled package of the object
+	library.Register(&bundleDelegate{}, web.ID(), "")
+	delegate := library.LookupID(web.ID()).New()
+	delegate.Pointer().(*bundleDelegate).Greeting = "hello"
+	web.SetMain(delegate)
+
+	src := New(srcDir)
+	require.NoError(t, src.CreateObjectPackage(web))
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Export(web, &buf))
+
+	dstRoot := object.New("::root")
+	sys := object.New("System")
+	dstRoot.AppendChild(sys)
+	dst := New(dstDir)
+	result, err := dst.Import(sys, &buf)
+	require.NoError(t, err)
+
+	imported := result.Object
+	assert.Equal(t, "/System/Web", imported.Path())
+	assert.NotEqual(t, web.ID(), imported.ID())
+	assert.Equal(t, []string{"image.unregisteredComponent"}, result.Missing)
+	assert.Equal(t, []string{imported.ID()}, result.Pending)
+	assert.Nil(t, imported.Main())
+
+	ihandler := imported.FindChild("Handler")
+	require.NotNil(t, ihandler)
+	assert.NotEqual(t, handler.ID(), ihandler.ID())
+
+	require.Len(t, imported.Components(), 1)
+	iv := imported.Components()[0].Pointer().(*imageSource)
+	require.Len(t, iv.Handlers, 1)
+	assert.True(t, iv.Handlers[0] == ihandler.Components()[0].Pointer())
+
+	pkg, err := ioutil.ReadFile(filepath.Join(dstDir, PackageDir, ObjectDir, imported.ID(), "component.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(pkg), imported.ID())
+	assert.NotContains(t, string(pkg), web.ID())
+
+	index, err := ioutil.ReadFile(filepath.Join(dstDir, PackageDir, ObjectDir, "import.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), imported.ID())
+
+	// the delegate is kept until the workspace recompiles with its package
+	require.NoError(t, dst.Write(dstRoot))
+	library.Register(&bundleDelegate{}, imported.ID(), "")
+	loaded, err := New(dstDir).Load()
+	require.NoError(t, err)
+	limported := loaded.FindID(imported.ID())
+	require.NotNil(t, limported)
+	require.NotNil(t, limported.Main())
+	assert.Equal(t, imported.ID(), limported.Main().ID())
+	assert.Equal(t, "hello", limported.Main().Pointer().(*bundleDelegate).Greeting)
+}
+
+func TestBundleInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-image-dst-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.Marshal(BundleManifest{
+		Version:  BundleVersion,
+		Objects:  []string{"a", "b"},
+		Packages: []string{"a"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeTarFile(tw, bundleManifest, manifest))
+	require.NoError(t, writeTarFile(tw, "obj/a.json", []byte(`{"ID": "a", "Name": "A"}`)))
+	require.NoError(t, writeTarFile(tw, "pkg/a/component.go", []byte("package object\n")))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	root := object.New("::root")
+	sys := object.New("System")
+	root.AppendChild(sys)
+	_, err = New(dir).Import(sys, &buf)
+	assert.Error(t, err)
+	assert.Empty(t, sys.Children())
+
+	// nothing is written to the workspace
+	_, err = os.Stat(filepath.Join(dir, PackageDir))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -43,6 +43,16 @@ type Image struct {
 
 	lastObjPath map[string]string
 	writeMu     sync.Mutex
+
+	// pending holds the snapshots of components whose type isn't registered,
+	// such as delegates of imported objects before the workspace recompiles,
+	// by object ID. They are written back until they can be loaded.
+	pending map[string][]pendingComponent
+}
+
+type pendingComponent struct {
+	manifold.ComponentSnapshot
+	main bool
 }
 
 func New(filepath string) *Image {
@@ -50,6 +60,7 @@ func New(filepath string) *Image {
 		filepath:    filepath,
 		fs:          afero.NewBasePathFs(afero.NewOsFs(), filepath),
 		lastObjPath: make(map[string]string),
+		pending:     make(map[string][]pendingComponent),
 	}
 }
 
@@ -123,6 +134,10 @@ func (i *Image) Load() (manifold.Object, error) {
 		return r, nil
 	}
 
+	i.writeMu.Lock()
+	i.pending = make(map[string][]pendingComponent)
+	i.writeMu.Unlock()
+
 	obj, refs, err := i.loadObject(i.objFs, "/")
 	if err != nil {
 		return nil, err
@@ -139,10 +154,9 @@ func (i *Image) Load() (manifold.Object, error) {
 			log.Printf("no object found for snapshot ref target at %s", ref.TargetID)
 			continue
 		}
-		_, targetType, _ := src.GetField(ref.Path)
-		ptr := reflect.New(targetType)
-		dst.ValueTo(ptr)
-		src.SetField(ref.Path, reflect.Indirect(ptr).Interface())
+		if err := restoreRef(src, dst, ref); err != nil {
+			log.Printf("unable to restore snapshot ref at %s: %s", ref.Path, err)
+		}
 	}
 
 	manifold.Walk(obj, func(o manifold.Object) {
@@ -157,6 +171,39 @@ func (i *Image) Load() (manifold.Object, error) {
 	return obj, nil
 }
 
+// registered returns true if the type of the component snapshot is
+// registered, so it can be loaded.
+func registered(c manifold.ComponentSnapshot) bool {
+	if c.ID != "" {
+		return library.LookupID(c.ID) != nil
+	}
+	return library.Lookup(c.Name) != nil
+}
+
+func (i *Image) addPending(objID string, c manifold.ComponentSnapshot, main bool) {
+	i.writeMu.Lock()
+	defer i.writeMu.Unlock()
+	i.pending[objID] = append(i.pending[objID], pendingComponent{c, main})
+}
+
+// restoreRef sets the field, slice element or map entry at the ref path on
+// src to the value of the matching type from the dst registry.
+func restoreRef(src, dst manifold.Object, ref manifold.SnapshotRef) error {
+	_, targetType, err := src.GetField(ref.Path)
+	if err != nil {
+		return err
+	}
+	if targetType == nil {
+		return fmt.Errorf("no field found for path")
+	}
+	ptr := reflect.New(targetType)
+	dst.ValueTo(ptr)
+	if reflect.Indirect(ptr).IsZero() {
+		return fmt.Errorf("no %s value found on %s", targetType, dst.Path())
+	}
+	return src.SetField(ref.Path, reflect.Indirect(ptr).Interface())
+}
+
 func (i *Image) loadObject(fs afero.Fs, path string) (manifold.Object, []manifold.SnapshotRef, error) {
 	// TODO: Handle missing components?
 
@@ -175,6 +222,11 @@ func (i *Image) loadObject(fs afero.Fs, path string) (manifold.Object, []manifol
 	obj := object.FromSnapshot(snapshot)
 	i.lastObjPath[obj.ID()] = path
 	for _, c := range snapshot.Components {
+		if !registered(c) {
+			log.Printf("keeping unregistered component %s on %s until it is available", c.Name, path)
+			i.addPending(obj.ID(), c, snapshot.Main != "" && c.ID == snapshot.Main)
+			continue
+		}
 		refs = append(refs, c.Refs...)
 		com := library.NewComponent(c.Name, c.Value, c.ID)
 		com.SetEnabled(c.Enabled)
@@ -213,16 +265,42 @@ func (i *Image) Write(root manifold.Object) error {
 
 	i.objFs = afero.NewBasePathFs(i.fs, ObjectDir)
 
+	// snapshot every object first so nothing is written if one fails
+	snapshots := make(map[string]manifold.ObjectSnapshot)
+	if err := snapshotTree(root, snapshots); err != nil {
+		return err
+	}
+
 	if err := i.fs.MkdirAll(ObjectDir, 0755); err != nil {
 		return err
 	}
 
-	return i.writeObject(i.objFs, "/", root)
+	return i.writeObject(i.objFs, "/", root, snapshots)
+}
+
+func snapshotTree(obj manifold.Object, snapshots map[string]manifold.ObjectSnapshot) error {
+	snapshot := obj.Snapshot()
+	if err := snapshot.Err(); err != nil {
+		return err
+	}
+	snapshots[obj.ID()] = snapshot
+	for _, child := range obj.Children() {
+		if err := snapshotTree(child, snapshots); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (i *Image) writeObject(fs afero.Fs, path string, obj manifold.Object) error {
+func (i *Image) writeObject(fs afero.Fs, path string, obj manifold.Object, snapshots map[string]manifold.ObjectSnapshot) error {
 	i.lastObjPath[obj.ID()] = path
-	iobj := obj.Snapshot()
+	iobj := snapshots[obj.ID()]
+	for _, c := range i.pending[obj.ID()] {
+		iobj.Components = append(iobj.Components, c.ComponentSnapshot)
+		if c.main && iobj.Main == "" {
+			iobj.Main = c.ID
+		}
+	}
 
 	buf, err := json.MarshalIndent(iobj, "", "  ")
 	if err != nil {
@@ -239,12 +317,13 @@ func (i *Image) writeObject(fs afero.Fs, path string, obj manifold.Object) error
 			if err := i.objFs.Rename(oldPath, childPath); err != nil {
 				return err
 			}
+			i.movedObjPath(oldPath, childPath)
 		}
 		if err := fs.MkdirAll(pathName(child), 0755); err != nil {
 			return err
 		}
 		childFs := afero.NewBasePathFs(fs, pathName(child))
-		if err := i.writeObject(childFs, childPath, child); err != nil {
+		if err := i.writeObject(childFs, childPath, child, snapshots); err != nil {
 			return err
 		}
 	}
@@ -252,6 +331,16 @@ func (i *Image) writeObject(fs afero.Fs, path string, obj manifold.Object) error
 	return nil
 }
 
+// movedObjPath updates the last written paths of the descendants of an
+// object whose directory was renamed, since they moved along with it.
+func (i *Image) movedObjPath(oldPath, newPath string) {
+	for id, p := range i.lastObjPath {
+		if strings.HasPrefix(p, oldPath+"/") {
+			i.lastObjPath[id] = newPath + p[len(oldPath):]
+		}
+	}
+}
+
 func pathNameFromImage(parts []string) string {
 	shortid := parts[0][len(parts[0])-8:]
 	exp := regexp.MustCompile("[^a-zA-Z0-9]+")
@@ -0,0 +1,181 @@
+package image
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/misc/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type imageTarget struct {
+	Name string
+}
+
+func (c *imageTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+type imageSource struct {
+	Handler  http.Handler
+	Handlers []http.Handler
+	Targets  map[string]*imageTarget
+}
+
+type imageSecret struct {
+	Password string `tractor:"secret"`
+	Accounts []imageAccount
+}
+
+type imageAccount struct {
+	Token string `tractor:"secret"`
+}
+
+func init() {
+	library.Register(&imageTarget{}, "", "")
+	library.Register(&imageSource{}, "", "")
+	library.Register(&imageSecret{}, "", "")
+}
+
+func newTestComponent(t *testing.T, v interface{}) manifold.Component {
+	for _, rc := range library.Registered() {
+		if reflect.TypeOf(rc.NewValue()) == reflect.TypeOf(v) {
+			return rc.New()
+		}
+	}
+	require.FailNow(t, "component not registered")
+	return nil
+}
+
+func TestImageRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-image-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := object.New("::root")
+	src := object.New("src")
+	dst1 := object.New("dst1")
+	dst2 := object.New("dst2")
+	root.AppendChild(src)
+	root.AppendChild(dst1)
+	root.AppendChild(dst2)
+	dst1.AppendComponent(newTestComponent(t, &imageTarget{}))
+	dst2.AppendComponent(newTestComponent(t, &imageTarget{}))
+	com := newTestComponent(t, &imageSource{})
+	src.AppendComponent(com)
+
+	t1 := dst1.Components()[0].Pointer().(*imageTarget)
+	t2 := dst2.Components()[0].Pointer().(*imageTarget)
+	v := com.Pointer().(*imageSource)
+	v.Handler = t2
+	v.Handlers = []http.Handler{t1, t2}
+	v.Targets = map[string]*imageTarget{"one": t1, "two/2": t2}
+
+	require.NoError(t, New(dir).Write(root))
+
+	loaded, err := New(dir).Load()
+	require.NoError(t, err)
+
+	lsrc := loaded.FindChild("src")
+	ldst1 := loaded.FindChild("dst1")
+	ldst2 := loaded.FindChild("dst2")
+	require.NotNil(t, lsrc)
+	require.NotNil(t, ldst1)
+	require.NotNil(t, ldst2)
+
+	lt1 := ldst1.Components()[0].Pointer().(*imageTarget)
+	lt2 := ldst2.Components()[0].Pointer().(*imageTarget)
+	lv := lsrc.Components()[0].Pointer().(*imageSource)
+	assert.True(t, lv.Handler == lt2)
+	require.Len(t, lv.Handlers, 2)
+	assert.True(t, lv.Handlers[0] == lt1)
+	assert.True(t, lv.Handlers[1] == lt2)
+	assert.True(t, lv.Targets["one"] == lt1)
+	assert.True(t, lv.Targets["two/2"] == lt2)
+}
+
+func TestImageReparent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-image-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := object.New("::root")
+	a := object.New("a")
+	b := object.New("b")
+	moved := object.New("moved")
+	leaf := object.New("leaf")
+	root.AppendChild(a)
+	root.AppendChild(b)
+	a.AppendChild(moved)
+	moved.AppendChild(leaf)
+
+	img := New(dir)
+	require.NoError(t, img.Write(root))
+
+	a.RemoveChild(moved)
+	b.AppendChild(moved)
+	moved.SetName("renamed")
+	require.NoError(t, img.Write(root))
+
+	loaded, err := New(dir).Load()
+	require.NoError(t, err)
+	assert.Nil(t, loaded.FindChild("a/moved"))
+	lleaf := loaded.FindChild("b/renamed/leaf")
+	require.NotNil(t, lleaf)
+	assert.Equal(t, leaf.ID(), lleaf.ID())
+}
+
+func TestImageSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-image-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := secret.GenerateKey()
+	require.NoError(t, err)
+	secret.SetKey(key)
+	defer secret.SetKey(nil)
+
+	root := object.New("::root")
+	obj := object.New("obj")
+	root.AppendChild(obj)
+	com := newTestComponent(t, &imageSecret{})
+	obj.AppendComponent(com)
+	v := com.Pointer().(*imageSecret)
+	v.Password = "hunter2"
+	v.Accounts = []imageAccount{{Token: "token"}}
+	require.NoError(t, New(dir).Write(root))
+
+	// saving without a key keeps the sealed values
+	secret.SetKey(nil)
+	loaded, err := New(dir).Load()
+	require.NoError(t, err)
+	lv := loaded.FindChild("obj").Components()[0].Pointer().(*imageSecret)
+	assert.True(t, secret.IsSealed(lv.Password))
+	assert.True(t, secret.IsSealed(lv.Accounts[0].Token))
+	lv.Password = "changed"
+	require.NoError(t, New(dir).Write(loaded))
+
+	secret.SetKey(key)
+	loaded, err = New(dir).Load()
+	require.NoError(t, err)
+	lv = loaded.FindChild("obj").Components()[0].Pointer().(*imageSecret)
+	assert.Equal(t, "hunter2", lv.Password)
+	assert.Equal(t, "token", lv.Accounts[0].Token)
+
+	// a secret that was never sealed can't be saved without a key
+	secret.SetKey(nil)
+	other := object.New("other")
+	loaded.AppendChild(other)
+	com = newTestComponent(t, &imageSecret{})
+	other.AppendComponent(com)
+	com.Pointer().(*imageSecret).Password = "hunter2"
+	assert.Error(t, New(dir).Write(loaded))
+	loaded, err = New(dir).Load()
+	require.NoError(t, err)
+	assert.Nil(t, loaded.FindChild("other"))
+}
@@ -1,16 +1,19 @@
 package library
 
 import (
+	"encoding/json"
 	"fmt"
-	"path"
+	"log"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/manifold/tractor/pkg/manifold"
 	"github.com/manifold/tractor/pkg/misc/jsonpointer"
 	"github.com/manifold/tractor/pkg/misc/notify"
+	"github.com/manifold/tractor/pkg/misc/secret"
 	"github.com/mitchellh/mapstructure"
-	reflected "github.com/progrium/prototypes/go-reflected"
 )
 
 type component struct {
@@ -21,6 +24,11 @@ type component struct {
 	value   interface{}
 	typed   bool
 	loaded  bool // if Reload has been called once
+
+	// sealed holds the last sealed value of each secret field by path, kept
+	// in case the field can't be sealed again.
+	sealed   map[string]string
+	sealedMu sync.Mutex
 }
 
 type ComponentEnabler interface {
@@ -77,12 +85,25 @@ func (c *component) SetField(path string, value interface{}) error {
 }
 
 func (c *component) FieldType(path string) reflect.Type {
-	parts := strings.Split(path, "/")
-	rt := reflected.TypeOf(c.Pointer())
-	for _, part := range parts {
-		rt = rt.FieldType(part)
+	rt := reflect.TypeOf(c.Pointer())
+	for _, part := range strings.Split(path, "/") {
+		for rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+		switch rt.Kind() {
+		case reflect.Struct:
+			field, ok := rt.FieldByName(part)
+			if !ok {
+				return nil
+			}
+			rt = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			rt = rt.Elem()
+		default:
+			return nil
+		}
 	}
-	return rt.Type
+	return rt
 }
 
 func (c *component) CallMethod(path string, args []interface{}, reply interface{}) error {
@@ -179,6 +200,9 @@ func (c *component) Pointer() interface{} {
 	if !c.typed {
 		c.value = typedComponentValue(c.value, c.name, c.id)
 		c.typed = true
+		c.sealedMu.Lock()
+		c.sealed = openSecrets(c.name, reflect.ValueOf(c.value))
+		c.sealedMu.Unlock()
 	}
 	return c.value
 }
@@ -229,47 +253,199 @@ func (c *component) Snapshot() manifold.ComponentSnapshot {
 	}
 	if c.object != nil {
 		com.ObjectID = c.object.ID()
-		com.Value, com.Refs = extractRefs(c.object, com.Name, com.Value)
+		c.sealedMu.Lock()
+		if c.sealed == nil {
+			c.sealed = make(map[string]string)
+		}
+		com.Value, com.Refs, com.Err = extractRefs(c.object, com.Name, com.Value, c.sealed)
+		c.sealedMu.Unlock()
 	}
 	return com
 }
 
-func extractRefs(obj manifold.Object, basePath string, v interface{}) (out map[string]interface{}, refs []manifold.SnapshotRef) {
+// extractRefs returns a marshalable copy of the component value v with any
+// pointers or interfaces to components in the tree replaced by nil. A
+// SnapshotRef is returned for each of them, where the path is a JSON pointer
+// to the field, slice element or map entry relative to basePath. Secret
+// fields are sealed, falling back to their value in sealed, which is updated.
+// Nested structs are only copied into maps when something inside them was
+// replaced, so types like time.Time are encoded as they encode themselves.
+func extractRefs(obj manifold.Object, basePath string, v interface{}, sealed map[string]string) (out map[string]interface{}, refs []manifold.SnapshotRef, err error) {
 	if obj.Root() == nil {
 		return
 	}
-	out = make(map[string]interface{})
-	rv := reflected.ValueOf(v)
-	if rv.Kind() != reflect.Ptr {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
 		return
 	}
-	rt := rv.Type()
-	for _, field := range rt.Fields() {
-		ft := rt.FieldType(field)
-		fieldPath := path.Join(basePath, field)
-		var subrefs []manifold.SnapshotRef
-		switch ft.Kind() {
-		case reflect.Struct, reflect.Map, reflect.Slice:
-			out[field], subrefs = extractRefs(obj, fieldPath, rv.Get(field).Interface())
-			refs = append(refs, subrefs...)
-		case reflect.Ptr, reflect.Interface:
-			if rv.Get(field).IsNil() {
-				continue
-			}
-			target := obj.Root().FindPointer(rv.Get(field).Interface())
-			if target != nil {
-				refs = append(refs, manifold.SnapshotRef{
-					ObjectID: obj.ID(),
-					Path:     fieldPath,
-					TargetID: target.ID(),
-				})
-				out[field] = nil
+	e := &refExtractor{
+		obj:     obj,
+		visited: make(map[uintptr]bool),
+		sealed:  sealed,
+	}
+	return e.extractFields(basePath, rv), e.refs, e.err
+}
+
+type refExtractor struct {
+	obj     manifold.Object
+	refs    []manifold.SnapshotRef
+	visited map[uintptr]bool
+	sealed  map[string]string
+	err     error
+	// changes counts values replaced, sealed or dropped so far
+	changes int
+}
+
+func (e *refExtractor) extract(fieldPath string, rv reflect.Value) interface{} {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		if target := e.findTarget(rv); target != nil {
+			e.refs = append(e.refs, manifold.SnapshotRef{
+				ObjectID: e.obj.ID(),
+				Path:     fieldPath,
+				TargetID: target.ID(),
+			})
+			e.changes++
+			return nil
+		}
+		if rv.Kind() == reflect.Interface {
+			if rv.Type().NumMethod() > 0 {
+				// without a reference there is no concrete type to decode into
+				e.changes++
+				return nil
 			}
-		default:
-			out[field] = rv.Get(field).Interface()
+			return e.extract(fieldPath, rv.Elem())
+		}
+		if e.visited[rv.Pointer()] {
+			e.changes++
+			return nil
+		}
+		e.visited[rv.Pointer()] = true
+		defer delete(e.visited, rv.Pointer())
+		return e.extract(fieldPath, rv.Elem())
+	case reflect.Struct:
+		if !hasExportedFields(rv.Type()) || (marshalsItself(rv.Type()) && !hasSecretFields(rv.Type())) {
+			return structValue(rv)
+		}
+		changes := e.changes
+		out := e.extractFields(fieldPath, rv)
+		if e.changes == changes {
+			// nothing inside was replaced, so the struct can be encoded as it is
+			return structValue(rv)
+		}
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
 		}
+		out := make(map[string]interface{})
+		for _, key := range rv.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			out[name] = e.extract(joinPointer(fieldPath, name), rv.MapIndex(key))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// leave byte slices to be encoded as they are
+			return rv.Interface()
+		}
+		out := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out[i] = e.extract(joinPointer(fieldPath, strconv.Itoa(i)), rv.Index(i))
+		}
+		return out
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if !rv.IsNil() {
+			e.changes++
+		}
+		return nil
+	default:
+		return rv.Interface()
 	}
-	return
+}
+
+// extractFields returns a map of the exported fields of the struct rv.
+func (e *refExtractor) extractFields(fieldPath string, rv reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{})
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if isSecretField(field) && field.Type.Kind() == reflect.String {
+			out[field.Name] = e.seal(joinPointer(fieldPath, field.Name), rv.Field(i).String())
+			e.changes++
+			continue
+		}
+		out[field.Name] = e.extract(joinPointer(fieldPath, field.Name), rv.Field(i))
+	}
+	return out
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// marshalsItself returns true if values of type rt, or pointers to them,
+// implement json.Marshaler.
+func marshalsItself(rt reflect.Type) bool {
+	return rt.Implements(jsonMarshalerType) || reflect.PtrTo(rt).Implements(jsonMarshalerType)
+}
+
+func hasExportedFields(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSecretFields(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if isSecretField(rt.Field(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// structValue returns the struct rv to be encoded as it is, as a pointer to a
+// copy if only the pointer type implements json.Marshaler.
+func structValue(rv reflect.Value) interface{} {
+	if rv.Type().Implements(jsonMarshalerType) || !reflect.PtrTo(rv.Type()).Implements(jsonMarshalerType) {
+		return rv.Interface()
+	}
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	return ptr.Interface()
+}
+
+// findTarget returns the object with a component that the pointer or
+// interface value rv refers to, or nil if there is none.
+func (e *refExtractor) findTarget(rv reflect.Value) manifold.Object {
+	if rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+	return e.obj.Root().FindPointer(rv.Interface())
+}
+
+func joinPointer(base, name string) string {
+	return base + "/" + jsonpointer.Escape(name)
 }
 
 func typedComponentValue(value interface{}, name, id string) interface{} {
@@ -286,9 +462,195 @@ func typedComponentValue(value interface{}, name, id string) interface{} {
 	if typedValue == nil {
 		panic("unable to find registered component: " + name)
 	}
-	if err := mapstructure.Decode(value, typedValue); err == nil {
-		return typedValue
-	} else {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: decodeUnmarshalers,
+		Result:     typedValue,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := decoder.Decode(value); err != nil {
 		panic(err)
 	}
+	return typedValue
+}
+
+// decodeUnmarshalers is a mapstructure decode hook that decodes values into
+// types implementing json.Unmarshaler, like time.Time, by re-encoding them as
+// JSON, since snapshots save them as whatever their MarshalJSON returned.
+func decodeUnmarshalers(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from == to || !reflect.PtrTo(to).Implements(jsonUnmarshalerType) {
+		return data, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(to)
+	if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// IsSecretPath returns true if the field at path in the component, or any
+// field along the way, is tagged `tractor:"secret"`. Values at such paths
+// should not be shown or logged.
+func IsSecretPath(com manifold.Component, path string) bool {
+	rt := com.Type()
+	if rt == nil {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		for rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+		switch rt.Kind() {
+		case reflect.Struct:
+			field, ok := rt.FieldByName(part)
+			if !ok {
+				return false
+			}
+			if isSecretField(field) {
+				return true
+			}
+			rt = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			rt = rt.Elem()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// isSecretField returns true for struct fields tagged `tractor:"secret"`,
+// which are encrypted in snapshots.
+func isSecretField(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("tractor"), ",") {
+		if opt == "secret" {
+			return true
+		}
+	}
+	return false
+}
+
+// seal returns the sealed value of the secret field at fieldPath. If it
+// can't be sealed, the value last sealed is kept instead, and without one
+// the snapshot fails rather than dropping or exposing the value.
+func (e *refExtractor) seal(fieldPath, value string) string {
+	if value == "" || secret.IsSealed(value) {
+		return value
+	}
+	sealed, err := secret.Seal(value)
+	if err == nil {
+		if e.sealed != nil {
+			e.sealed[fieldPath] = sealed
+		}
+		return sealed
+	}
+	if last, ok := e.sealed[fieldPath]; ok {
+		log.Printf("unable to seal secret at %s, keeping its last sealed value: %s", fieldPath, err)
+		return last
+	}
+	if e.err == nil {
+		e.err = fmt.Errorf("unable to seal secret at %s: %w", fieldPath, err)
+	}
+	return ""
+}
+
+// openSecrets decrypts the sealed secret fields in the value behind rv,
+// walking struct fields, pointers, interfaces, slices, arrays and maps the
+// way extractRefs does. It returns the sealed values it found by path,
+// relative to basePath.
+func openSecrets(basePath string, rv reflect.Value) map[string]string {
+	o := &secretOpener{
+		sealed:  make(map[string]string),
+		visited: make(map[uintptr]bool),
+	}
+	o.open(basePath, rv)
+	return o.sealed
+}
+
+type secretOpener struct {
+	sealed  map[string]string
+	visited map[uintptr]bool
+}
+
+// open decrypts the secrets in rv, which must be settable for them to be
+// replaced, or a pointer, interface or map holding them.
+func (o *secretOpener) open(fieldPath string, rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() || o.visited[rv.Pointer()] {
+			return
+		}
+		o.visited[rv.Pointer()] = true
+		defer delete(o.visited, rv.Pointer())
+		o.open(fieldPath, rv.Elem())
+	case reflect.Interface:
+		if rv.IsNil() {
+			return
+		}
+		elem := rv.Elem()
+		if elem.Kind() == reflect.Ptr || !rv.CanSet() {
+			o.open(fieldPath, elem)
+			return
+		}
+		// values in interfaces aren't settable, so open a copy
+		cp := reflect.New(elem.Type()).Elem()
+		cp.Set(elem)
+		o.open(fieldPath, cp)
+		rv.Set(cp)
+	case reflect.Struct:
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fv := rv.Field(i)
+			path := joinPointer(fieldPath, field.Name)
+			if isSecretField(field) && fv.Kind() == reflect.String {
+				o.openField(path, fv)
+				continue
+			}
+			o.open(path, fv)
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			return
+		}
+		for _, key := range rv.MapKeys() {
+			// map values aren't settable, so open a copy and put it back
+			v := rv.MapIndex(key)
+			cp := reflect.New(v.Type()).Elem()
+			cp.Set(v)
+			o.open(joinPointer(fieldPath, fmt.Sprint(key.Interface())), cp)
+			rv.SetMapIndex(key, cp)
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < rv.Len(); i++ {
+			o.open(joinPointer(fieldPath, strconv.Itoa(i)), rv.Index(i))
+		}
+	}
+}
+
+func (o *secretOpener) openField(fieldPath string, fv reflect.Value) {
+	if !secret.IsSealed(fv.String()) {
+		return
+	}
+	o.sealed[fieldPath] = fv.String()
+	if !fv.CanSet() {
+		return
+	}
+	plain, err := secret.Open(fv.String())
+	if err != nil {
+		log.Printf("unable to open secret at %s: %s", fieldPath, err)
+		return
+	}
+	fv.SetString(plain)
 }
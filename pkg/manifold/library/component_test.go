@@ -1,9 +1,16 @@
 package library
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/misc/secret"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,3 +49,236 @@ func TestComponent(t *testing.T) {
 		assert.Equal(t, "error", err.Error())
 	})
 }
+
+type refTarget struct {
+	Name string
+}
+
+func (c *refTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+type refNested struct {
+	Target *refTarget
+	Label  string
+}
+
+type refComponent struct {
+	Handler  http.Handler
+	Handlers []http.Handler
+	Targets  map[string]*refTarget
+	Nested   refNested
+	Inline   *refNested
+	Values   map[string]interface{}
+}
+
+func TestSnapshotRefs(t *testing.T) {
+	root := object.New("::root")
+	src := object.New("src")
+	dst1 := object.New("dst1")
+	dst2 := object.New("dst2")
+	root.AppendChild(src)
+	root.AppendChild(dst1)
+	root.AppendChild(dst2)
+
+	t1 := &refTarget{Name: "t1"}
+	t2 := &refTarget{Name: "t2"}
+	dst1.AppendComponent(newComponent("refTarget", t1, ""))
+	dst2.AppendComponent(newComponent("refTarget", t2, ""))
+
+	v := &refComponent{
+		Handler:  t1,
+		Handlers: []http.Handler{t1, t2},
+		Targets:  map[string]*refTarget{"a/b": t2},
+		Nested:   refNested{Target: t1, Label: "nested"},
+		Inline:   &refNested{Label: "inline"},
+		Values:   map[string]interface{}{"port": 8080},
+	}
+	src.AppendComponent(newComponent("refComponent", v, ""))
+
+	snapshot := src.Component("refComponent").Snapshot()
+	refs := make(map[string]string)
+	for _, ref := range snapshot.Refs {
+		assert.Equal(t, src.ID(), ref.ObjectID)
+		refs[ref.Path] = ref.TargetID
+	}
+	assert.Equal(t, map[string]string{
+		"refComponent/Handler":       dst1.ID(),
+		"refComponent/Handlers/0":    dst1.ID(),
+		"refComponent/Handlers/1":    dst2.ID(),
+		"refComponent/Targets/a~1b":  dst2.ID(),
+		"refComponent/Nested/Target": dst1.ID(),
+	}, refs)
+
+	value := snapshot.Value.(map[string]interface{})
+	assert.Nil(t, value["Handler"])
+	assert.Equal(t, []interface{}{nil, nil}, value["Handlers"])
+	assert.Equal(t, map[string]interface{}{"a/b": nil}, value["Targets"])
+	assert.Equal(t, map[string]interface{}{"Target": nil, "Label": "nested"}, value["Nested"])
+	// structs with no references inside are kept as they are
+	assert.Equal(t, refNested{Label: "inline"}, value["Inline"])
+	assert.Equal(t, map[string]interface{}{"port": 8080}, value["Values"])
+
+	com := src.Component("refComponent")
+	assert.Equal(t, reflect.TypeOf((*http.Handler)(nil)).Elem(), com.FieldType("Handlers/1"))
+	assert.Equal(t, reflect.TypeOf(t1), com.FieldType("Targets/a~1b"))
+	assert.Equal(t, reflect.TypeOf(t1), com.FieldType("Nested/Target"))
+}
+
+type secretComponent struct {
+	Username string
+	Password string `tractor:"secret"`
+	Accounts []secretAccount
+	Tokens   map[string]secretAccount
+}
+
+type secretAccount struct {
+	Token string `tractor:"secret"`
+}
+
+func TestSecretFields(t *testing.T) {
+	key, err := secret.GenerateKey()
+	assert.NoError(t, err)
+	secret.SetKey(key)
+	defer secret.SetKey(nil)
+
+	root := object.New("::root")
+	obj := object.New("obj")
+	root.AppendChild(obj)
+	obj.AppendComponent(newComponent("secretComponent", &secretComponent{
+		Username: "admin",
+		Password: "hunter2",
+		Accounts: []secretAccount{{Token: "a"}},
+		Tokens:   map[string]secretAccount{"b": {Token: "b"}},
+	}, ""))
+
+	snapshot := obj.Component("secretComponent").Snapshot()
+	assert.NoError(t, snapshot.Err)
+	value := snapshot.Value.(map[string]interface{})
+	assert.Equal(t, "admin", value["Username"])
+	sealed := value["Password"].(string)
+	assert.True(t, secret.IsSealed(sealed))
+	sealedA := value["Accounts"].([]interface{})[0].(map[string]interface{})["Token"].(string)
+	assert.True(t, secret.IsSealed(sealedA))
+	sealedB := value["Tokens"].(map[string]interface{})["b"].(map[string]interface{})["Token"].(string)
+	assert.True(t, secret.IsSealed(sealedB))
+
+	v := &secretComponent{
+		Username: "admin",
+		Password: sealed,
+		Accounts: []secretAccount{{Token: sealedA}},
+		Tokens:   map[string]secretAccount{"b": {Token: sealedB}},
+	}
+	found := openSecrets("secretComponent", reflect.ValueOf(v))
+	assert.Equal(t, "hunter2", v.Password)
+	assert.Equal(t, "a", v.Accounts[0].Token)
+	assert.Equal(t, "b", v.Tokens["b"].Token)
+	assert.Equal(t, map[string]string{
+		"secretComponent/Password":         sealed,
+		"secretComponent/Accounts/0/Token": sealedA,
+		"secretComponent/Tokens/b/Token":   sealedB,
+	}, found)
+
+	assert.True(t, IsSecretPath(obj.Component("secretComponent"), "Password"))
+	assert.False(t, IsSecretPath(obj.Component("secretComponent"), "Username"))
+
+	t.Run("without a key", func(t *testing.T) {
+		secret.SetKey(nil)
+		defer secret.SetKey(key)
+
+		// secrets that can't be opened stay sealed and are saved as they were
+		v := &secretComponent{Password: sealed}
+		openSecrets("secretComponent", reflect.ValueOf(v))
+		assert.Equal(t, sealed, v.Password)
+
+		// changed secrets keep their last sealed value
+		obj.Component("secretComponent").SetField("Password", "changed")
+		snapshot := obj.Component("secretComponent").Snapshot()
+		assert.NoError(t, snapshot.Err)
+		assert.Equal(t, sealed, snapshot.Value.(map[string]interface{})["Password"])
+
+		// and secrets never sealed fail the snapshot instead of being dropped
+		other := object.New("other")
+		root.AppendChild(other)
+		other.AppendComponent(newComponent("secretComponent", &secretComponent{Password: "hunter2"}, ""))
+		snapshot = other.Component("secretComponent").Snapshot()
+		assert.Error(t, snapshot.Err)
+		assert.Error(t, other.Snapshot().Err())
+	})
+}
+
+// valueVersion encodes itself as a "major.minor" string.
+type valueVersion struct {
+	Major, Minor int
+}
+
+func (v valueVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%d.%d", v.Major, v.Minor))
+}
+
+func (v *valueVersion) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	_, err := fmt.Sscanf(s, "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+type valueRelease struct {
+	Version valueVersion
+	Target  *refTarget
+}
+
+type valueComponent struct {
+	Dur     time.Duration
+	When    time.Time
+	Release valueRelease
+	Latest  valueRelease
+}
+
+func TestSnapshotValues(t *testing.T) {
+	Register(&valueComponent{}, "", "")
+
+	root := object.New("::root")
+	obj := object.New("obj")
+	dst := object.New("dst")
+	root.AppendChild(obj)
+	root.AppendChild(dst)
+	target := &refTarget{Name: "target"}
+	dst.AppendComponent(newComponent("refTarget", target, ""))
+
+	when := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	v := &valueComponent{
+		Dur:     time.Second,
+		When:    when,
+		Release: valueRelease{Version: valueVersion{1, 2}, Target: target},
+		Latest:  valueRelease{Version: valueVersion{1, 3}},
+	}
+	obj.AppendComponent(newComponent("valueComponent", v, ""))
+
+	snapshot := obj.Component("valueComponent").Snapshot()
+	assert.NoError(t, snapshot.Err)
+	value := snapshot.Value.(map[string]interface{})
+	assert.Equal(t, when, value["When"])
+	// only structs with references inside are rebuilt
+	assert.Equal(t, map[string]interface{}{"Version": valueVersion{1, 2}, "Target": nil}, value["Release"])
+	assert.Equal(t, valueRelease{Version: valueVersion{1, 3}}, value["Latest"])
+
+	b, err := json.Marshal(snapshot.Value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Dur": 1000000000,
+		"When": "2020-01-02T15:04:05Z",
+		"Release": {"Version": "1.2", "Target": null},
+		"Latest": {"Version": "1.3", "Target": null}
+	}`, string(b))
+
+	var saved interface{}
+	assert.NoError(t, json.Unmarshal(b, &saved))
+	loaded := newComponent("valueComponent", saved, "").Pointer().(*valueComponent)
+	assert.Equal(t, &valueComponent{
+		Dur:     time.Second,
+		When:    when,
+		Release: valueRelease{Version: valueVersion{1, 2}},
+		Latest:  valueRelease{Version: valueVersion{1, 3}},
+	}, loaded)
+}
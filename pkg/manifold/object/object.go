@@ -2,6 +2,7 @@ package object
 
 import (
 	"errors"
+	"os"
 	"path"
 	"reflect"
 	"strings"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/manifold/tractor/pkg/manifold"
 	"github.com/manifold/tractor/pkg/misc/debouncer"
+	"github.com/manifold/tractor/pkg/misc/logging"
+	"github.com/manifold/tractor/pkg/misc/logging/std"
 	"github.com/manifold/tractor/pkg/misc/notify"
 	"github.com/manifold/tractor/pkg/misc/registry"
 	"github.com/rs/xid"
@@ -21,8 +24,28 @@ func defaultPreloader(o manifold.Object) []interface{} {
 	return []interface{}{o}
 }
 
+// LoggerProvider returns the logger for a component of an object. Components
+// that implement ComponentLogger are given theirs when added to an object.
+var LoggerProvider func(o manifold.Object, com manifold.Component) logging.Logger
+
+func defaultLoggerProvider(o manifold.Object, com manifold.Component) logging.Logger {
+	return std.NewLogger("", os.Stderr).With("component", com.Name())
+}
+
 func init() {
 	RegistryPreloader = defaultPreloader
+	LoggerProvider = defaultLoggerProvider
+}
+
+// ComponentLogger is implemented by components that log.
+type ComponentLogger interface {
+	SetLogger(l logging.Logger)
+}
+
+func (o *object) setLogger(com manifold.Component) {
+	if l, ok := com.Pointer().(ComponentLogger); ok {
+		l.SetLogger(LoggerProvider(o, com))
+	}
 }
 
 func newObject(name string) *object {
@@ -12,6 +12,7 @@ func (o *object) AppendComponent(com manifold.Component) {
 	com.SetContainer(o)
 	o.UpdateRegistry()
 	o.registry.Populate(com.Pointer())
+	o.setLogger(com)
 	notify.Send(o, manifold.ObjectChange{
 		Object: o,
 		Path:   "::Components",
@@ -38,6 +39,7 @@ func (o *object) InsertComponentAt(idx int, com manifold.Component) {
 	com.SetContainer(o)
 	o.UpdateRegistry()
 	o.registry.Populate(com.Pointer())
+	o.setLogger(com)
 	notify.Send(o, manifold.ObjectChange{
 		Object: o,
 		Path:   "::Components",
@@ -78,17 +78,38 @@ func (b *Buffer) Write(by []byte) (int, error) {
 	return n, err
 }
 
+// Bytes returns a copy of the data in the circular buffer.
+func (b *Buffer) Bytes() []byte {
+	b.muBuf.Lock()
+	defer b.muBuf.Unlock()
+	by := b.buf.Bytes()
+	return append(by[:0:0], by...)
+}
+
 // Pipe returns a new pipe reader that reads data from this buffer. Closing the
 // pipe reader will release it from the buffer too.
 func (b *Buffer) Pipe() io.ReadCloser {
+	return b.pipe(true)
+}
+
+// Tail returns a new pipe reader like Pipe, but that only reads data written
+// after it is returned.
+func (b *Buffer) Tail() io.ReadCloser {
+	return b.pipe(false)
+}
+
+func (b *Buffer) pipe(history bool) io.ReadCloser {
 	pr, pw := io.Pipe()
 
 	b.muPipe.Lock()
-	b.muBuf.Lock()
-	by := b.buf.Bytes()
-	b.muBuf.Unlock()
+	var cp []byte
+	if history {
+		b.muBuf.Lock()
+		by := b.buf.Bytes()
+		b.muBuf.Unlock()
+		cp = append(by[:0:0], by...)
+	}
 
-	cp := append(by[:0:0], by...)
 	pr2 := &pipeReader{
 		Reader: io.MultiReader(bytes.NewBuffer(cp), pr),
 		pr:     pr,
@@ -41,17 +41,20 @@ func TestBuffer(t *testing.T) {
 
 	pr3 := buf.Pipe()
 	ch3 := readAll(t, pr3)
+	ch4 := readAll(t, buf.Tail())
 
 	buf.Write([]byte("ef"))
 
 	numPipes, sizeSeen = buf.Status()
-	assert.Equal(t, 3, numPipes)
+	assert.Equal(t, 4, numPipes)
 	assert.Equal(t, int64(6), sizeSeen)
+	assert.Equal(t, "def", string(buf.Bytes()))
 
 	buf.Close()
 	assert.Equal(t, "abcdef", string(<-ch1))
 	assert.Equal(t, "abcdef", string(<-ch2))
 	assert.Equal(t, "bcdef", string(<-ch3))
+	assert.Equal(t, "ef", string(<-ch4))
 }
 
 func readAll(t *testing.T, r io.Reader) chan []byte {
@@ -0,0 +1,152 @@
+// Package gobuild parses the output of go build and go vet into structured
+// diagnostics, tagged with the object owning the package they are in.
+package gobuild
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tools that produce diagnostics. Compile diagnostics are errors that fail
+// the build, vet diagnostics are warnings.
+const (
+	Compile = "compile"
+	Vet     = "vet"
+)
+
+// ObjectDir is the directory of a workspace holding the packages owned by
+// objects, each named by the ID of its object.
+const ObjectDir = "pkg/obj/"
+
+// Diagnostic is a problem reported by a tool. File is relative to the
+// workspace and slash separated. Diagnostics without a position, such as
+// go.mod errors, only have a Message.
+type Diagnostic struct {
+	Tool    string `json:"tool" msgpack:"tool"`
+	File    string `json:"file,omitempty" msgpack:"file"`
+	Line    int    `json:"line,omitempty" msgpack:"line"`
+	Column  int    `json:"column,omitempty" msgpack:"column"`
+	Message string `json:"message" msgpack:"message"`
+	// Object is the ID of the object owning the package of File, if any.
+	Object string `json:"object,omitempty" msgpack:"object"`
+}
+
+// Result is the outcome of building a workspace.
+type Result struct {
+	Time        time.Time     `json:"time" msgpack:"time"`
+	Duration    time.Duration `json:"duration" msgpack:"duration"`
+	OK          bool          `json:"ok" msgpack:"ok"`
+	Diagnostics []Diagnostic  `json:"diagnostics" msgpack:"diagnostics"`
+}
+
+// Errors returns the compile diagnostics of the result.
+func (r *Result) Errors() []Diagnostic {
+	var diags []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Tool == Compile {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+var position = regexp.MustCompile(`^(.+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// Parse returns the diagnostics in the output of a tool run in dir.
+func Parse(tool, dir string, output []byte) []Diagnostic {
+	diags := []Diagnostic{}
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.TrimSpace(line) == "", strings.HasPrefix(line, "# "):
+			// package headers
+			continue
+		case strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "  "):
+			// continues the message above
+			if n := len(diags); n > 0 {
+				diags[n-1].Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		line = strings.TrimPrefix(line, "vet: ")
+		if strings.HasSuffix(line, ": too many errors") {
+			continue
+		}
+		m := position.FindStringSubmatch(line)
+		if m == nil {
+			diags = append(diags, Diagnostic{Tool: tool, Message: line})
+			continue
+		}
+		d := Diagnostic{
+			Tool:    tool,
+			File:    relPath(dir, m[1]),
+			Message: m[4],
+		}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		d.Object = objectID(d.File)
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+func relPath(dir, file string) string {
+	if filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(dir, file); err == nil {
+			file = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(file))
+}
+
+// objectID returns the object owning the package a workspace file is in.
+func objectID(file string) string {
+	if !strings.HasPrefix(file, ObjectDir) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(file, ObjectDir), "/", 2)
+	if len(parts) < 2 {
+		// files directly in pkg/obj, like import.go
+		return ""
+	}
+	return parts[0]
+}
+
+// Load reads a result saved with Save.
+func Load(path string) (*Result, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Save writes the result to path, replacing it atomically.
+func (r *Result) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
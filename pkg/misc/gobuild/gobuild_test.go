@@ -0,0 +1,72 @@
+package gobuild_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manifold/tractor/pkg/misc/gobuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	dir := "/home/user/ws"
+	output := "# workspace/pkg/obj/bq2m3k\n" +
+		"pkg/obj/bq2m3k/delegate.go:12:5: undefined: foo\n" +
+		"/home/user/ws/workspace.go:7:2: imported and not used: \"fmt\"\n" +
+		"pkg/obj/import.go:3: syntax error: unexpected newline\n" +
+		"pkg/obj/bq2m3k/delegate.go:20:2: cannot use x (type int) as type string in assignment:\n" +
+		"\tint does not implement string\n" +
+		"pkg/obj/bq2m3k/delegate.go:30:1: too many errors\n" +
+		"go: finding module for package example.com/missing\n"
+
+	diags := gobuild.Parse(gobuild.Compile, dir, []byte(output))
+	require.Len(t, diags, 5)
+	assert.Equal(t, gobuild.Diagnostic{
+		Tool:    gobuild.Compile,
+		File:    "pkg/obj/bq2m3k/delegate.go",
+		Line:    12,
+		Column:  5,
+		Message: "undefined: foo",
+		Object:  "bq2m3k",
+	}, diags[0])
+	assert.Equal(t, "workspace.go", diags[1].File)
+	assert.Empty(t, diags[1].Object)
+	assert.Equal(t, 3, diags[2].Line)
+	assert.Equal(t, 0, diags[2].Column)
+	assert.Empty(t, diags[2].Object)
+	assert.Equal(t, "cannot use x (type int) as type string in assignment:\nint does not implement string", diags[3].Message)
+	assert.Equal(t, gobuild.Diagnostic{
+		Tool:    gobuild.Compile,
+		Message: "go: finding module for package example.com/missing",
+	}, diags[4])
+
+	vet := gobuild.Parse(gobuild.Vet, dir, []byte("# workspace/pkg/obj/x1\nvet: ./pkg/obj/x1/x.go:4:2: unreachable code\n"))
+	require.Len(t, vet, 1)
+	assert.Equal(t, "pkg/obj/x1/x.go", vet[0].File)
+	assert.Equal(t, "x1", vet[0].Object)
+
+	assert.Empty(t, gobuild.Parse(gobuild.Compile, dir, nil))
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-misc-gobuild-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ws.build.json")
+	r := &gobuild.Result{
+		Time: time.Now().UTC().Truncate(time.Second),
+		Diagnostics: []gobuild.Diagnostic{
+			{Tool: gobuild.Compile, File: "pkg/obj/a/a.go", Line: 1, Message: "bad", Object: "a"},
+			{Tool: gobuild.Vet, File: "workspace.go", Line: 2, Message: "meh"},
+		},
+	}
+	require.NoError(t, r.Save(path))
+	loaded, err := gobuild.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, r, loaded)
+	assert.Len(t, loaded.Errors(), 1)
+}
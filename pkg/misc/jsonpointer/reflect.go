@@ -196,6 +196,12 @@ func parseJSONTagName(tag string) string {
 	return tag
 }
 
+// Escape encodes a single reference token so it can be joined into a
+// pointer, replacing `~` with `~0` and `/` with `~1`.
+func Escape(s string) string {
+	return string(escape(s, nil))
+}
+
 func encodePointer(p []string) string {
 	out := make([]rune, 0, 64)
 
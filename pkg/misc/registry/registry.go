@@ -152,12 +152,18 @@ func isNilOrZero(v reflect.Value, t reflect.Type) bool {
 // of the reflect.Value. Remember to use reflect.Indirect on rv after.
 func (r *Registry) ValueTo(rv reflect.Value) {
 	for _, e := range r.Entries() {
-		if rv.Elem().Type().Kind() == reflect.Struct {
+		switch rv.Elem().Type().Kind() {
+		case reflect.Struct:
 			if e.Value.Elem().Type().AssignableTo(rv.Elem().Type()) {
 				rv.Elem().Set(e.Value.Elem())
 				return
 			}
-		} else {
+		case reflect.Ptr:
+			if e.Value.Type().AssignableTo(rv.Elem().Type()) {
+				rv.Elem().Set(e.Value)
+				return
+			}
+		default:
 			if e.Value.Type().Implements(rv.Elem().Type()) {
 				rv.Elem().Set(e.Value)
 				return
@@ -42,6 +42,10 @@ func TestRegistry(t *testing.T) {
 	vv := reflect.New(e.Type)
 	r.ValueTo(vv)
 	assert.Equal(t, v.Name, reflect.Indirect(vv).Interface().(namedStruct).Name)
+
+	pv := reflect.New(e.RefType)
+	r.ValueTo(pv)
+	assert.Equal(t, &v, reflect.Indirect(pv).Interface())
 }
 
 func TestAssignableTo(t *testing.T) {
@@ -0,0 +1,655 @@
+// Package repl evaluates lines of Go against a set of variables. It supports
+// expressions, calls, field and index access, and assignments, using
+// reflection instead of compiling, so there are no type declarations,
+// literals of composite types or control flow.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// REPL reads lines, evaluates them and prints the results.
+type REPL struct {
+	// Prompt is written before reading each line.
+	Prompt string
+	// Around, if set, is called to evaluate each line so callers can hold
+	// locks or update variables for the duration.
+	Around func(eval func())
+
+	print func(v interface{})
+	vars  map[string]reflect.Value
+}
+
+// NewREPL returns a REPL that calls print with the value of each line that
+// is an expression.
+func NewREPL(print func(v interface{})) *REPL {
+	return &REPL{
+		print: print,
+		vars:  make(map[string]reflect.Value),
+	}
+}
+
+// Set sets a variable.
+func (r *REPL) Set(name string, v interface{}) {
+	r.vars[name] = reflect.ValueOf(v)
+}
+
+// Run sets vars and evaluates lines from in until it is closed. Errors are
+// written to out and do not stop the loop.
+func (r *REPL) Run(in io.Reader, out io.Writer, vars map[string]interface{}) error {
+	for name, v := range vars {
+		r.Set(name, v)
+	}
+	lines := bufio.NewScanner(in)
+	for {
+		if r.Prompt != "" {
+			fmt.Fprint(out, r.Prompt)
+		}
+		if !lines.Scan() {
+			return lines.Err()
+		}
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		var v reflect.Value
+		var err error
+		eval := func() { v, err = r.evalLine(line) }
+		if r.Around != nil {
+			r.Around(eval)
+		} else {
+			eval()
+		}
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+			continue
+		}
+		if v.IsValid() {
+			r.print(v.Interface())
+		}
+	}
+}
+
+// Eval evaluates a line and returns its value, or nil if it has none.
+func (r *REPL) Eval(line string) (interface{}, error) {
+	v, err := r.evalLine(line)
+	if err != nil || !v.IsValid() {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+func (r *REPL) evalLine(line string) (v reflect.Value, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package repl\nfunc _() {\n"+line+"\n}", 0)
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		return reflect.Value{}, fmt.Errorf("syntax error: %s", list[0].Msg)
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body.List
+	for _, stmt := range body {
+		if v, err = r.stmt(stmt); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return v, nil
+}
+
+func (r *REPL) stmt(stmt ast.Stmt) (reflect.Value, error) {
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		return r.eval(s.X)
+	case *ast.AssignStmt:
+		if len(s.Lhs) != 1 || len(s.Rhs) != 1 {
+			return reflect.Value{}, fmt.Errorf("only single assignments are supported")
+		}
+		v, err := r.eval(s.Rhs[0])
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		switch s.Tok {
+		case token.DEFINE:
+			id, ok := s.Lhs[0].(*ast.Ident)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("non-name on left side of :=")
+			}
+			r.vars[id.Name] = v
+		case token.ASSIGN:
+			if err := r.assign(s.Lhs[0], v); err != nil {
+				return reflect.Value{}, err
+			}
+		default:
+			return reflect.Value{}, fmt.Errorf("unsupported assignment: %s", s.Tok)
+		}
+		return reflect.Value{}, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported statement: %T", stmt)
+}
+
+func (r *REPL) assign(lhs ast.Expr, v reflect.Value) error {
+	switch e := lhs.(type) {
+	case *ast.Ident:
+		if _, ok := r.vars[e.Name]; !ok {
+			return fmt.Errorf("undefined: %s", e.Name)
+		}
+		r.vars[e.Name] = v
+		return nil
+	case *ast.IndexExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return err
+		}
+		x = indirect(x)
+		if x.Kind() == reflect.Map {
+			key, err := r.eval(e.Index)
+			if err != nil {
+				return err
+			}
+			if key, err = convert(key, x.Type().Key()); err != nil {
+				return err
+			}
+			if v, err = convert(v, x.Type().Elem()); err != nil {
+				return err
+			}
+			x.SetMapIndex(key, v)
+			return nil
+		}
+	}
+	target, err := r.eval(lhs)
+	if err != nil {
+		return err
+	}
+	if !target.CanSet() {
+		return fmt.Errorf("cannot assign to %s", exprString(lhs))
+	}
+	if v, err = convert(v, target.Type()); err != nil {
+		return err
+	}
+	target.Set(v)
+	return nil
+}
+
+func (r *REPL) eval(expr ast.Expr) (reflect.Value, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch e.Name {
+		case "nil":
+			return reflect.Value{}, nil
+		case "true", "false":
+			return reflect.ValueOf(e.Name == "true"), nil
+		}
+		v, ok := r.vars[e.Name]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("undefined: %s", e.Name)
+		}
+		return v, nil
+	case *ast.BasicLit:
+		return literal(e)
+	case *ast.ParenExpr:
+		return r.eval(e.X)
+	case *ast.StarExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		x = elem(x)
+		if x.Kind() != reflect.Ptr || x.IsNil() {
+			return reflect.Value{}, fmt.Errorf("cannot dereference %s", exprString(e.X))
+		}
+		return x.Elem(), nil
+	case *ast.SelectorExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return selector(x, e.Sel.Name, exprString(e.X))
+	case *ast.IndexExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		idx, err := r.eval(e.Index)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return index(x, idx)
+	case *ast.CallExpr:
+		if id, ok := e.Fun.(*ast.Ident); ok && id.Name == "len" && len(e.Args) == 1 {
+			if _, defined := r.vars["len"]; !defined {
+				x, err := r.eval(e.Args[0])
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				x = indirect(x)
+				switch x.Kind() {
+				case reflect.Array, reflect.Slice, reflect.Map, reflect.String, reflect.Chan:
+					return reflect.ValueOf(x.Len()), nil
+				}
+				return reflect.Value{}, fmt.Errorf("invalid argument for len: %s", exprString(e.Args[0]))
+			}
+		}
+		fn, err := r.eval(e.Fun)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		args := make([]reflect.Value, len(e.Args))
+		for i, arg := range e.Args {
+			if args[i], err = r.eval(arg); err != nil {
+				return reflect.Value{}, err
+			}
+		}
+		return call(fn, args, exprString(e.Fun))
+	case *ast.UnaryExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return unary(e.Op, x)
+	case *ast.BinaryExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if e.Op == token.LAND || e.Op == token.LOR {
+			if elem(x).Kind() != reflect.Bool {
+				return reflect.Value{}, fmt.Errorf("operator %s not defined on %s", e.Op, typeName(x))
+			}
+			if elem(x).Bool() == (e.Op == token.LOR) {
+				return elem(x), nil
+			}
+		}
+		y, err := r.eval(e.Y)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return binary(e.Op, x, y)
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported expression: %s", exprString(expr))
+}
+
+func literal(lit *ast.BasicLit) (reflect.Value, error) {
+	switch lit.Kind {
+	case token.INT:
+		i, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(int(i)), nil
+	case token.FLOAT:
+		f, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(f), nil
+	case token.STRING:
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(s), nil
+	case token.CHAR:
+		s, _, _, err := strconv.UnquoteChar(lit.Value[1:len(lit.Value)-1], '\'')
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(s), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported literal: %s", lit.Value)
+}
+
+// selector returns the method, field or string keyed map entry name of x,
+// looking through interfaces and pointers.
+func selector(x reflect.Value, name, expr string) (reflect.Value, error) {
+	for x.IsValid() {
+		if m := x.MethodByName(name); m.IsValid() {
+			return m, nil
+		}
+		switch x.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if x.IsNil() {
+				return reflect.Value{}, fmt.Errorf("%s is nil", expr)
+			}
+			x = x.Elem()
+			continue
+		case reflect.Struct:
+			if f, ok := x.Type().FieldByName(name); ok && f.PkgPath == "" {
+				return x.FieldByIndex(f.Index), nil
+			}
+			if x.CanAddr() {
+				if m := x.Addr().MethodByName(name); m.IsValid() {
+					return m, nil
+				}
+			}
+		case reflect.Map:
+			if x.Type().Key().Kind() == reflect.String {
+				if v := x.MapIndex(reflect.ValueOf(name).Convert(x.Type().Key())); v.IsValid() {
+					return v, nil
+				}
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("%s has no field or method %s", expr, name)
+	}
+	return reflect.Value{}, fmt.Errorf("%s is nil", expr)
+}
+
+func index(x, idx reflect.Value) (reflect.Value, error) {
+	x = indirect(x)
+	switch x.Kind() {
+	case reflect.Map:
+		key, err := convert(idx, x.Type().Key())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := x.MapIndex(key)
+		if !v.IsValid() {
+			return reflect.Zero(x.Type().Elem()), nil
+		}
+		return v, nil
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, ok := toInt(idx)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("index must be an integer, got %s", typeName(idx))
+		}
+		if i < 0 || int(i) >= x.Len() {
+			return reflect.Value{}, fmt.Errorf("index out of range [%d] with length %d", i, x.Len())
+		}
+		return x.Index(int(i)), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot index %s", typeName(x))
+}
+
+// call calls fn with args converted to its parameter types. A trailing error
+// result is returned as the error, and several other results as a slice.
+func call(fn reflect.Value, args []reflect.Value, expr string) (reflect.Value, error) {
+	fn = elem(fn)
+	if fn.Kind() != reflect.Func {
+		return reflect.Value{}, fmt.Errorf("cannot call non-function %s", expr)
+	}
+	if fn.IsNil() {
+		return reflect.Value{}, fmt.Errorf("%s is nil", expr)
+	}
+	t := fn.Type()
+	if len(args) < t.NumIn()-1 || (!t.IsVariadic() && len(args) != t.NumIn()) {
+		return reflect.Value{}, fmt.Errorf("wrong number of arguments to %s: want %d, got %d", expr, t.NumIn(), len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		pt := t.In(min(i, t.NumIn()-1))
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			pt = pt.Elem()
+		}
+		v, err := convert(arg, pt)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("argument %d to %s: %s", i+1, expr, err)
+		}
+		in[i] = v
+	}
+	out := fn.Call(in)
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if !out[n-1].IsNil() {
+			return reflect.Value{}, out[n-1].Interface().(error)
+		}
+		out = out[:n-1]
+	}
+	switch len(out) {
+	case 0:
+		return reflect.Value{}, nil
+	case 1:
+		return out[0], nil
+	}
+	results := make([]interface{}, len(out))
+	for i, v := range out {
+		results[i] = v.Interface()
+	}
+	return reflect.ValueOf(results), nil
+}
+
+func unary(op token.Token, x reflect.Value) (reflect.Value, error) {
+	switch op {
+	case token.AND:
+		if !x.CanAddr() {
+			return reflect.Value{}, fmt.Errorf("cannot take address of %s", typeName(x))
+		}
+		return x.Addr(), nil
+	case token.NOT:
+		if x = elem(x); x.Kind() == reflect.Bool {
+			return reflect.ValueOf(!x.Bool()), nil
+		}
+	case token.SUB:
+		if i, ok := toInt(x); ok {
+			return reflect.ValueOf(int(-i)), nil
+		}
+		if f, ok := toFloat(x); ok {
+			return reflect.ValueOf(-f), nil
+		}
+	case token.ADD:
+		if _, ok := toFloat(x); ok {
+			return x, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("operator %s not defined on %s", op, typeName(x))
+}
+
+func binary(op token.Token, x, y reflect.Value) (reflect.Value, error) {
+	ex, ey := elem(x), elem(y)
+	if op == token.LAND || op == token.LOR {
+		if ey.Kind() != reflect.Bool {
+			return reflect.Value{}, fmt.Errorf("operator %s not defined on %s", op, typeName(y))
+		}
+		return ey, nil
+	}
+	if xi, ok := toInt(ex); ok {
+		if yi, ok := toInt(ey); ok {
+			return intOp(op, xi, yi)
+		}
+	}
+	if xf, ok := toFloat(ex); ok {
+		if yf, ok := toFloat(ey); ok {
+			return floatOp(op, xf, yf)
+		}
+	}
+	if ex.Kind() == reflect.String && ey.Kind() == reflect.String {
+		return stringOp(op, ex.String(), ey.String())
+	}
+	if op == token.EQL || op == token.NEQ {
+		eq := !ex.IsValid() && !ey.IsValid()
+		switch {
+		case !ex.IsValid():
+			eq = isNil(ey)
+		case !ey.IsValid():
+			eq = isNil(ex)
+		case ex.Type().Comparable() && ey.Type().Comparable():
+			eq = ex.Interface() == ey.Interface()
+		}
+		return reflect.ValueOf(eq == (op == token.EQL)), nil
+	}
+	return reflect.Value{}, fmt.Errorf("operator %s not defined on %s and %s", op, typeName(x), typeName(y))
+}
+
+func intOp(op token.Token, x, y int64) (reflect.Value, error) {
+	switch op {
+	case token.ADD:
+		return reflect.ValueOf(int(x + y)), nil
+	case token.SUB:
+		return reflect.ValueOf(int(x - y)), nil
+	case token.MUL:
+		return reflect.ValueOf(int(x * y)), nil
+	case token.QUO, token.REM:
+		if y == 0 {
+			return reflect.Value{}, fmt.Errorf("division by zero")
+		}
+		if op == token.QUO {
+			return reflect.ValueOf(int(x / y)), nil
+		}
+		return reflect.ValueOf(int(x % y)), nil
+	}
+	return compare(op, x < y, x == y)
+}
+
+func floatOp(op token.Token, x, y float64) (reflect.Value, error) {
+	switch op {
+	case token.ADD:
+		return reflect.ValueOf(x + y), nil
+	case token.SUB:
+		return reflect.ValueOf(x - y), nil
+	case token.MUL:
+		return reflect.ValueOf(x * y), nil
+	case token.QUO:
+		return reflect.ValueOf(x / y), nil
+	}
+	return compare(op, x < y, x == y)
+}
+
+func stringOp(op token.Token, x, y string) (reflect.Value, error) {
+	if op == token.ADD {
+		return reflect.ValueOf(x + y), nil
+	}
+	return compare(op, x < y, x == y)
+}
+
+func compare(op token.Token, less, equal bool) (reflect.Value, error) {
+	switch op {
+	case token.EQL:
+		return reflect.ValueOf(equal), nil
+	case token.NEQ:
+		return reflect.ValueOf(!equal), nil
+	case token.LSS:
+		return reflect.ValueOf(less), nil
+	case token.LEQ:
+		return reflect.ValueOf(less || equal), nil
+	case token.GTR:
+		return reflect.ValueOf(!less && !equal), nil
+	case token.GEQ:
+		return reflect.ValueOf(!less), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported operator: %s", op)
+}
+
+// convert returns v as a value of type t. Numbers convert to other number
+// types and nil to the zero value of types that can be nil.
+func convert(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if !v.IsValid() {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use nil as %s", t)
+	}
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if ev := elem(v); ev.IsValid() && ev.Type().AssignableTo(t) {
+		return ev, nil
+	}
+	if isNumber(v.Kind()) && isNumber(t.Kind()) {
+		return v.Convert(t), nil
+	}
+	if v.Kind() == reflect.String && t.Kind() == reflect.String {
+		return v.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", v.Type(), t)
+}
+
+// elem returns the value in an interface.
+func elem(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirect returns the value in an interface or behind pointers.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func toInt(v reflect.Value) (int64, bool) {
+	v = elem(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func toFloat(v reflect.Value) (float64, bool) {
+	v = elem(v)
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func typeName(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.CallExpr:
+		return exprString(e.Fun) + "(...)"
+	case *ast.IndexExpr:
+		return exprString(e.X) + "[...]"
+	case *ast.BasicLit:
+		return e.Value
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func min(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type server struct {
+	Addr    string
+	Port    int
+	Headers map[string]string
+	Tags    []string
+}
+
+func (s *server) URL() string {
+	return fmt.Sprintf("http://%s:%d", s.Addr, s.Port)
+}
+
+func (s *server) Restart(force bool) error {
+	if !force {
+		return errors.New("not forced")
+	}
+	return nil
+}
+
+func (s *server) Sum(n ...int) int {
+	total := 0
+	for _, i := range n {
+		total += i
+	}
+	return total
+}
+
+func TestEval(t *testing.T) {
+	srv := &server{Addr: "localhost", Port: 80, Headers: map[string]string{"X": "1"}, Tags: []string{"a", "b"}}
+	r := NewREPL(nil)
+	r.Set("srv", srv)
+
+	for expr, want := range map[string]interface{}{
+		`1 + 2*3`:              7,
+		`"a" + "b"`:            "ab",
+		`1.5 * 2`:              3.0,
+		`srv.Addr`:             "localhost",
+		`srv.Port > 10`:        true,
+		`srv.URL()`:            "http://localhost:80",
+		`srv.Headers["X"]`:     "1",
+		`srv.Headers.X`:        "1",
+		`srv.Tags[1]`:          "b",
+		`len(srv.Tags)`:        2,
+		`srv.Sum(1, 2, 3)`:     6,
+		`!false && srv != nil`: true,
+	} {
+		v, err := r.Eval(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, v, expr)
+	}
+
+	v, err := r.Eval(`srv.Restart(true)`)
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	_, err = r.Eval(`srv.Restart(false)`)
+	assert.EqualError(t, err, "not forced")
+
+	_, err = r.Eval(`srv.Port = 8080`)
+	require.NoError(t, err)
+	assert.Equal(t, 8080, srv.Port)
+	_, err = r.Eval(`srv.Headers["Y"] = "2"`)
+	require.NoError(t, err)
+	assert.Equal(t, "2", srv.Headers["Y"])
+	_, err = r.Eval(`addr := srv.Addr + ":x"`)
+	require.NoError(t, err)
+	v, err = r.Eval(`addr`)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:x", v)
+
+	for _, bad := range []string{`missing`, `srv.Nope`, `srv.Tags[5]`, `srv.Port = "x"`, `func(`, `srv.URL(1)`} {
+		_, err := r.Eval(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var printed []interface{}
+	r := NewREPL(func(v interface{}) {
+		printed = append(printed, v)
+	})
+	r.Prompt = "> "
+	var out bytes.Buffer
+	in := strings.NewReader("x := n * 2\nx\nbogus\n")
+	require.NoError(t, r.Run(in, &out, map[string]interface{}{"n": 21}))
+	assert.Equal(t, []interface{}{42}, printed)
+	assert.Contains(t, out.String(), "error: undefined: bogus")
+}
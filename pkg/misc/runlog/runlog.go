@@ -0,0 +1,399 @@
+// Package runlog keeps the console output of a restarting process in
+// rotating log files. Each line is stored with the time it was written and
+// the run it belongs to, between markers written when runs start and end,
+// so output can be replayed from a time or a run after the process, or the
+// process keeping the log, has restarted.
+//
+// Lines are written as
+//
+//	2020-01-30T15:04:05.123456789Z 3 | output of run 3
+//	2020-01-30T15:04:06Z 3 # exited with code 1
+//
+// to the log file, which is rotated to path.1, path.2 and so on.
+package runlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used by Open.
+const (
+	DefaultMaxSize  = 10 * 1024 * 1024
+	DefaultMaxFiles = 5
+	DefaultMaxAge   = 7 * 24 * time.Hour
+)
+
+// maxLine is the longest line kept whole. Longer output without a newline
+// is split.
+const maxLine = 64 * 1024
+
+const (
+	kindOutput = "|"
+	kindMarker = "#"
+)
+
+// Entry is a line of output, or a marker of a run starting or ending.
+type Entry struct {
+	Time time.Time
+	Run  int
+	// Marker is set on entries written by StartRun and EndRun, whose Text
+	// says what happened to the run.
+	Marker bool
+	Text   string
+}
+
+// String returns the output line, or a line describing the marker.
+func (e Entry) String() string {
+	if e.Marker {
+		return fmt.Sprintf("--- run %d %s at %s", e.Run, e.Text, e.Time.Local().Format(time.RFC3339))
+	}
+	return e.Text
+}
+
+// Query selects entries to replay. The zero Query selects everything kept.
+type Query struct {
+	// Since skips entries written before it.
+	Since time.Time
+	// Run selects the entries of a run. Negative runs count back from the
+	// last run, so -1 is the run before it.
+	Run int
+}
+
+// Log writes output to a rotating log file. Writes are buffered until a
+// line is complete.
+type Log struct {
+	Path string
+	// MaxSize is the size at which the log file is rotated.
+	MaxSize int64
+	// MaxFiles is how many rotated files are kept.
+	MaxFiles int
+	// MaxAge is how long a log file is written to before it is rotated, and
+	// how long rotated files are kept after they were last written.
+	MaxAge time.Duration
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+	run     int
+	partial []byte
+}
+
+// Open opens the log at path, continuing the run numbers of its files.
+// Zero limits get the defaults.
+func Open(path string, maxSize int64, maxFiles int, maxAge time.Duration) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		Path:     path,
+		MaxSize:  maxSize,
+		MaxFiles: maxFiles,
+		MaxAge:   maxAge,
+	}
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultMaxSize
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultMaxFiles
+	}
+	if l.MaxAge <= 0 {
+		l.MaxAge = DefaultMaxAge
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	l.removeOld()
+	files := l.files()
+	for i := len(files) - 1; i >= 0; i-- {
+		entries, err := readFile(files[i])
+		if err != nil {
+			l.f.Close()
+			return nil, err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		if files[i] == l.Path {
+			l.created = entries[0].Time
+		}
+		l.run = entries[len(entries)-1].Run
+		break
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = fi.Size()
+	l.created = time.Now()
+	return nil
+}
+
+// Run returns the number of the last run started.
+func (l *Log) Run() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.run
+}
+
+// StartRun marks the start of a new run and returns its number.
+func (l *Log) StartRun() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flush()
+	l.run++
+	return l.run, l.write(kindMarker, "started")
+}
+
+// EndRun marks the end of the run, with how it ended.
+func (l *Log) EndRun(how string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flush()
+	return l.write(kindMarker, how)
+}
+
+// Write writes the complete lines of p to the log, keeping the rest until
+// the line is completed.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partial = append(l.partial, p...)
+	var err error
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if werr := l.writeOutput(l.partial[:i]); werr != nil && err == nil {
+			err = werr
+		}
+		l.partial = l.partial[i+1:]
+	}
+	if len(l.partial) >= maxLine {
+		if werr := l.flush(); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if len(l.partial) == 0 {
+		// don't keep a large array around for the next line
+		l.partial = nil
+	}
+	return len(p), err
+}
+
+// flush writes an incomplete line.
+func (l *Log) flush() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	err := l.writeOutput(l.partial)
+	l.partial = nil
+	return err
+}
+
+// writeOutput writes a line of output, split into lines of up to maxLine.
+func (l *Log) writeOutput(line []byte) error {
+	for len(line) > maxLine {
+		if err := l.write(kindOutput, string(line[:maxLine])); err != nil {
+			return err
+		}
+		line = line[maxLine:]
+	}
+	return l.write(kindOutput, string(line))
+}
+
+func (l *Log) write(kind, text string) error {
+	now := time.Now()
+	if l.size > 0 && (l.size >= l.MaxSize || now.Sub(l.created) >= l.MaxAge) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	line := fmt.Sprintf("%s %d %s %s\n", now.UTC().Format(time.RFC3339Nano), l.run, kind, strings.TrimSuffix(text, "\r"))
+	n, err := l.f.WriteString(line)
+	if l.size == 0 {
+		l.created = now
+	}
+	l.size += int64(n)
+	return err
+}
+
+// rotate moves the log file to path.1, shifting rotated files up and
+// removing those past MaxFiles.
+func (l *Log) rotate() error {
+	l.f.Close()
+	os.Remove(l.rotated(l.MaxFiles))
+	for n := l.MaxFiles - 1; n > 0; n-- {
+		os.Rename(l.rotated(n), l.rotated(n+1))
+	}
+	os.Rename(l.Path, l.rotated(1))
+	l.removeOld()
+	return l.open()
+}
+
+func (l *Log) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", l.Path, n)
+}
+
+// removeOld removes rotated files last written more than MaxAge ago.
+func (l *Log) removeOld() {
+	for n := 1; n <= l.MaxFiles; n++ {
+		fi, err := os.Stat(l.rotated(n))
+		if err == nil && time.Since(fi.ModTime()) > l.MaxAge {
+			os.Remove(l.rotated(n))
+		}
+	}
+}
+
+// files returns the log files that exist, oldest first.
+func (l *Log) files() []string {
+	var files []string
+	for n := l.MaxFiles; n > 0; n-- {
+		if _, err := os.Stat(l.rotated(n)); err == nil {
+			files = append(files, l.rotated(n))
+		}
+	}
+	return append(files, l.Path)
+}
+
+// Replay returns the entries selected by q, oldest first. An incomplete
+// last line isn't included.
+func (l *Log) Replay(q Query) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	run := q.Run
+	if run < 0 {
+		run = l.run + run
+		if run < 1 {
+			return nil, fmt.Errorf("there is no run %d before run %d", -q.Run, l.run)
+		}
+	}
+	var selected []Entry
+	for _, file := range l.files() {
+		if !q.Since.IsZero() {
+			if fi, err := os.Stat(file); err == nil && fi.ModTime().Before(q.Since) {
+				continue
+			}
+		}
+		entries, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Time.Before(q.Since) || (run != 0 && e.Run != run) {
+				continue
+			}
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
+
+// Close writes an incomplete line and closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flush()
+	return l.f.Close()
+}
+
+// Format returns entries as lines of text.
+func Format(entries []Entry) []byte {
+	var b bytes.Buffer
+	for _, e := range entries {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Rename moves the log files at path to newPath.
+func Rename(path, newPath string) error {
+	for _, file := range append(rotatedFiles(path), path) {
+		err := os.Rename(file, newPath+strings.TrimPrefix(file, path))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the log files at path.
+func Remove(path string) {
+	for _, file := range append(rotatedFiles(path), path) {
+		os.Remove(file)
+	}
+}
+
+// rotatedFiles returns the rotated files of the log at path, but not those
+// of other logs named like them, such as path.1x.log.
+func rotatedFiles(path string) []string {
+	matches, _ := filepath.Glob(path + ".[0-9]*")
+	var files []string
+	for _, file := range matches {
+		if _, err := strconv.Atoi(strings.TrimPrefix(file, path+".")); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func readFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	lines := bufio.NewScanner(f)
+	lines.Buffer(make([]byte, 4096), maxLine*2)
+	for lines.Scan() {
+		if e, ok := parseLine(lines.Text()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, lines.Err()
+}
+
+func parseLine(line string) (Entry, bool) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 4 || (parts[2] != kindOutput && parts[2] != kindMarker) {
+		return Entry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return Entry{}, false
+	}
+	run, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{
+		Time:   t,
+		Run:    run,
+		Marker: parts[2] == kindMarker,
+		Text:   parts[3],
+	}, true
+}
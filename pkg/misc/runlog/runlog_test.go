@@ -0,0 +1,127 @@
+package runlog_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manifold/tractor/pkg/misc/runlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func texts(entries []runlog.Entry) []string {
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, strings.SplitN(e.String(), " at ", 2)[0])
+	}
+	return lines
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-misc-runlog-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs", "ws.log")
+
+	l, err := runlog.Open(path, 0, 0, 0)
+	require.NoError(t, err)
+	run, err := l.StartRun()
+	require.NoError(t, err)
+	assert.Equal(t, 1, run)
+	fmt.Fprint(l, "hello\nwor")
+	fmt.Fprint(l, "ld\r\nno newline")
+	require.NoError(t, l.EndRun("exited with code 1"))
+
+	between := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	l.StartRun()
+	fmt.Fprintln(l, "second run")
+	require.NoError(t, l.Close())
+
+	// runs continue after reopening
+	l, err = runlog.Open(path, 0, 0, 0)
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, 2, l.Run())
+	l.StartRun()
+	fmt.Fprintln(l, "third run")
+
+	all, err := l.Replay(runlog.Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"--- run 1 started",
+		"hello",
+		"world",
+		"no newline",
+		"--- run 1 exited with code 1",
+		"--- run 2 started",
+		"second run",
+		"--- run 3 started",
+		"third run",
+	}, texts(all))
+
+	previous, err := l.Replay(runlog.Query{Run: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--- run 2 started", "second run"}, texts(previous))
+
+	first, err := l.Replay(runlog.Query{Run: 1})
+	require.NoError(t, err)
+	assert.Len(t, first, 5)
+
+	since, err := l.Replay(runlog.Query{Since: between})
+	require.NoError(t, err)
+	assert.Equal(t, "--- run 2 started", texts(since)[0])
+
+	_, err = l.Replay(runlog.Query{Run: -3})
+	assert.Error(t, err)
+
+	assert.Equal(t, "hello\nworld\n", string(runlog.Format(all[1:3])))
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-misc-runlog-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ws.log")
+
+	l, err := runlog.Open(path, 200, 2, 0)
+	require.NoError(t, err)
+	l.StartRun()
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(l, "line %d\n", i)
+	}
+	fmt.Fprint(l, strings.Repeat("x", 100*1024)+"\n")
+	require.NoError(t, l.Close())
+
+	files, err := filepath.Glob(path + "*")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{path, path + ".1", path + ".2"}, files)
+
+	l, err = runlog.Open(path, 200, 2, 0)
+	require.NoError(t, err)
+	entries, err := l.Replay(runlog.Query{})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	// the oldest lines were rotated away, long lines are split
+	require.NotEmpty(t, entries)
+	assert.NotEqual(t, "--- run 1 started", texts(entries)[0])
+	assert.Equal(t, 100*1024-64*1024, len(entries[len(entries)-1].Text))
+
+	// the log of a workspace named ws.log.1x isn't a rotated file
+	other := path + ".1x.log"
+	require.NoError(t, ioutil.WriteFile(other, nil, 0644))
+
+	newPath := filepath.Join(dir, "renamed.log")
+	require.NoError(t, runlog.Rename(path, newPath))
+	files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	assert.ElementsMatch(t, []string{newPath, newPath + ".1", newPath + ".2", other}, files)
+
+	runlog.Remove(newPath)
+	files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{other}, files)
+}
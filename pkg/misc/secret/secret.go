@@ -0,0 +1,186 @@
+// Package secret encrypts values so they can be kept at rest without exposing
+// them, such as credentials stored in a workspace image. Values are sealed with
+// AES-GCM using a per-workspace key that is held by the agent and handed to the
+// workspace daemon through the environment.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvKey is the environment variable used to pass a key to a daemon.
+	EnvKey = "TRACTOR_SECRET_KEY"
+
+	// EnvToken is the environment variable used to pass the token clients
+	// must present to a workspace daemon.
+	EnvToken = "TRACTOR_WORKSPACE_TOKEN"
+
+	// KeySize is the size of a key in bytes (AES-256).
+	KeySize = 32
+
+	prefix = "secret:"
+)
+
+var (
+	ErrNoKey      = errors.New("no secret key")
+	ErrInvalidKey = errors.New("invalid secret key")
+	ErrMalformed  = errors.New("malformed secret")
+)
+
+// Key is a symmetric key used to seal and open secrets.
+type Key []byte
+
+// GenerateKey returns a new random key.
+func GenerateKey() (Key, error) {
+	k := make(Key, KeySize)
+	if _, err := io.ReadFull(rand.Reader, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// ParseKey decodes a hex encoded key.
+func ParseKey(s string) (Key, error) {
+	k, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(k) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return Key(k), nil
+}
+
+// LoadKeyFile reads a hex encoded key from the file at path. If the file does
+// not exist, a new key is generated and written there with owner-only
+// permissions.
+func LoadKeyFile(path string) (Key, error) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		return ParseKey(string(b))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	k, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(k.String()+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadTokenFile is like LoadKeyFile, but returns the hex encoded key for
+// use as a bearer token.
+func LoadTokenFile(path string) (string, error) {
+	k, err := LoadKeyFile(path)
+	if err != nil {
+		return "", err
+	}
+	return k.String(), nil
+}
+
+// KeyFromEnv returns the key set in the EnvKey environment variable. It
+// returns ErrNoKey if it is not set.
+func KeyFromEnv() (Key, error) {
+	s := os.Getenv(EnvKey)
+	if s == "" {
+		return nil, ErrNoKey
+	}
+	return ParseKey(s)
+}
+
+// String returns the hex encoding of the key.
+func (k Key) String() string {
+	return hex.EncodeToString(k)
+}
+
+// Seal encrypts plaintext and returns it in a form that can be identified
+// with IsSealed.
+func (k Key) Seal(plaintext string) (string, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts a value returned by Seal.
+func (k Key) Open(sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return "", ErrMalformed
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed[len(prefix):])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	gcm, err := k.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(b) < gcm.NonceSize() {
+		return "", ErrMalformed
+	}
+	out, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (k Key) aead() (cipher.AEAD, error) {
+	if len(k) == 0 {
+		return nil, ErrNoKey
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsSealed returns true if the value looks like it was returned by Seal.
+func IsSealed(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+var (
+	defaultKey Key
+	mu         sync.RWMutex
+)
+
+// SetKey sets the key used by the package-level Seal and Open.
+func SetKey(k Key) {
+	mu.Lock()
+	defaultKey = k
+	mu.Unlock()
+}
+
+// Seal encrypts plaintext with the key set by SetKey.
+func Seal(plaintext string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultKey.Seal(plaintext)
+}
+
+// Open decrypts a sealed value with the key set by SetKey.
+func Open(sealed string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultKey.Open(sealed)
+}
@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	k, err := GenerateKey()
+	require.NoError(t, err)
+
+	sealed, err := k.Seal("hunter2")
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "hunter2")
+
+	plain, err := k.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plain)
+
+	other, _ := GenerateKey()
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+
+	_, err = k.Open("hunter2")
+	assert.Equal(t, ErrMalformed, err)
+
+	_, err = Key(nil).Seal("hunter2")
+	assert.Equal(t, ErrNoKey, err)
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-secret-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key")
+	k1, err := LoadKeyFile(path)
+	require.NoError(t, err)
+	assert.Len(t, k1, KeySize)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	k2, err := LoadKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, k1, k2)
+}
@@ -2,6 +2,7 @@ package subcmd
 
 import (
 	"errors"
+	"math/rand"
 	"os"
 	"os/exec"
 	"sync"
@@ -20,8 +21,67 @@ const (
 	StatusStarted  Status = "Started"
 	StatusExited   Status = "Exited"
 	StatusStopped  Status = "Stopped"
+	// StatusCrashLooping is set instead of restarting a command that keeps
+	// failing soon after starting.
+	StatusCrashLooping Status = "CrashLooping"
 )
 
+// RestartPolicy decides whether a command is restarted when it exits on its
+// own. Restarts asked for with Restart always happen.
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartNever     RestartPolicy = "never"
+	// RestartUnlessExitCode restarts a command that exits cleanly or is
+	// killed by a signal, but not one that exits with a non-zero code. It
+	// is the policy of New.
+	RestartUnlessExitCode RestartPolicy = "unless-exit-code"
+)
+
+// Defaults used by New.
+const (
+	DefaultCrashLoopLimit  = 5
+	DefaultCrashLoopWindow = 10 * time.Second
+	DefaultStopTimeout     = 3 * time.Second
+)
+
+// DefaultBackoff is the Backoff used by New.
+var DefaultBackoff = Backoff{
+	Min:    100 * time.Millisecond,
+	Max:    30 * time.Second,
+	Jitter: 0.2,
+}
+
+// Backoff delays restarts after consecutive failures, starting at Min and
+// doubling up to Max. A random fraction of up to Jitter of the delay is
+// added so commands failing together don't restart in lockstep.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// Delay returns the delay before restarting after the given number of
+// consecutive failures. There is no delay without failures.
+func (b Backoff) Delay(failures int) time.Duration {
+	if failures <= 0 || b.Min <= 0 {
+		return 0
+	}
+	d := b.Min
+	for i := 1; i < failures && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter > 0 {
+		d += time.Duration(rand.Float64() * b.Jitter * float64(d))
+	}
+	return d
+}
+
 var (
 	ErrStarted    = errors.New("already started")
 	ErrStarting   = errors.New("already starting")
@@ -58,6 +118,19 @@ type Subcmd struct {
 	Setup       func(*exec.Cmd) error
 	maxRestarts int
 
+	// Policy decides whether the command is restarted when it exits.
+	Policy RestartPolicy
+	// Backoff delays restarts after failures.
+	Backoff Backoff
+	// CrashLoopLimit is how many consecutive failures within CrashLoopWindow
+	// of starting make the command crash looping, after which it isn't
+	// restarted until started again. Zero disables detection.
+	CrashLoopLimit  int
+	CrashLoopWindow time.Duration
+	// StopTimeout is how long the command has to exit after SIGINT before
+	// it is sent SIGKILL.
+	StopTimeout time.Duration
+
 	Log logging.DebugLogger
 
 	Started chan *exec.Cmd
@@ -70,6 +143,9 @@ type Subcmd struct {
 	lastErr    error
 	lastStatus int
 	restarts   int
+	failures   int
+	restarting bool
+	pending    *time.Timer
 
 	waitCh chan error
 
@@ -84,9 +160,14 @@ type Subcmd struct {
 
 func New(name string, arg ...string) *Subcmd {
 	return &Subcmd{
-		Cmd:         exec.Command(name, arg...),
-		maxRestarts: -1,
-		status:      StatusStopped,
+		Cmd:             exec.Command(name, arg...),
+		maxRestarts:     -1,
+		status:          StatusStopped,
+		Policy:          RestartUnlessExitCode,
+		Backoff:         DefaultBackoff,
+		CrashLoopLimit:  DefaultCrashLoopLimit,
+		CrashLoopWindow: DefaultCrashLoopWindow,
+		StopTimeout:     DefaultStopTimeout,
 	}
 }
 
@@ -113,6 +194,7 @@ func (sc *Subcmd) Start() error {
 	if sc.Status() == StatusStarting || sc.Status() == StatusStarted {
 		return ErrStarted
 	}
+	sc.resetRestarts()
 	return sc.start()
 }
 
@@ -121,19 +203,103 @@ func (sc *Subcmd) Restart() error {
 		return ErrStarting
 	}
 	if !Running(sc) {
+		sc.resetRestarts()
 		return sc.start()
 	}
+	sc.restartMu.Lock()
+	sc.restarting = true
+	sc.restartMu.Unlock()
 	return sc.terminate()
 }
 
 func (sc *Subcmd) Stop() error {
 	if !Running(sc) {
+		// stopped while waiting to restart, or after giving up on it
+		if sc.resetRestarts() || sc.Status() == StatusCrashLooping {
+			sc.setStatus(StatusStopped)
+			return nil
+		}
 		return ErrNotRunning
 	}
 	sc.setStatus(StatusStopped)
 	return sc.terminate()
 }
 
+// resetRestarts cancels a pending restart and forgets past failures. It
+// returns whether a restart was pending.
+func (sc *Subcmd) resetRestarts() bool {
+	sc.restartMu.Lock()
+	defer sc.restartMu.Unlock()
+	sc.failures = 0
+	if sc.pending == nil {
+		return false
+	}
+	sc.pending.Stop()
+	sc.pending = nil
+	return true
+}
+
+// nextRestart decides whether to restart after the command exited, having
+// run for the given duration, and how long to wait first. The command
+// failed if it exited with a non-zero code or was killed by a signal.
+func (sc *Subcmd) nextRestart(failed, signaled bool, ran time.Duration) (time.Duration, Status, bool) {
+	sc.restartMu.Lock()
+	defer sc.restartMu.Unlock()
+	if sc.restarting {
+		sc.restarting = false
+		return 0, "", true
+	}
+	if failed && ran < sc.CrashLoopWindow {
+		sc.failures++
+	} else {
+		sc.failures = 0
+	}
+	switch {
+	case sc.Policy == RestartNever, sc.Policy == RestartOnFailure && !failed,
+		sc.Policy == RestartUnlessExitCode && failed && !signaled:
+		return 0, "", false
+	case sc.maxRestarts >= 0 && sc.restarts >= sc.maxRestarts:
+		return 0, "", false
+	case sc.CrashLoopLimit > 0 && sc.failures >= sc.CrashLoopLimit:
+		return 0, StatusCrashLooping, false
+	}
+	sc.restarts++
+	return sc.Backoff.Delay(sc.failures), "", true
+}
+
+// scheduleRestart starts the command again after the delay unless it is
+// stopped or started in the meantime.
+func (sc *Subcmd) scheduleRestart(delay time.Duration) {
+	restart := func() {
+		if sc.Status() == StatusStopped || Running(sc) {
+			return
+		}
+		if err := sc.start(); err != nil {
+			logging.Debug(sc.Log, "restart failed: ", err)
+		}
+	}
+	if delay == 0 {
+		restart()
+		return
+	}
+	logging.Debug(sc.Log, "restarting in ", delay)
+	sc.restartMu.Lock()
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		sc.restartMu.Lock()
+		current := sc.pending == timer
+		if current {
+			sc.pending = nil
+		}
+		sc.restartMu.Unlock()
+		if current {
+			restart()
+		}
+	})
+	sc.pending = timer
+	sc.restartMu.Unlock()
+}
+
 func (sc *Subcmd) Signal(sig os.Signal) {
 	sc.pidMu.Lock()
 	sc.current.Process.Signal(sig)
@@ -150,7 +316,7 @@ func (sc *Subcmd) terminate() error {
 	sc.pidMu.Unlock()
 	logging.Debug(sc.Log, "sending SIGINT to PID ", pid)
 	syscall.Kill(-pid, syscall.SIGINT)
-	timeout := time.After(3 * time.Second) // TODO: configurable
+	timeout := time.After(sc.StopTimeout)
 	for {
 		select {
 		case <-timeout:
@@ -206,6 +372,30 @@ func (sc *Subcmd) ExitStatus() int {
 	return sc.lastStatus
 }
 
+// ExitSignal returns the signal that killed the command the last time it
+// exited, or nil if it exited on its own.
+func (sc *Subcmd) ExitSignal() os.Signal {
+	sc.lastMu.Lock()
+	defer sc.lastMu.Unlock()
+	if exiterr, ok := sc.lastErr.(*exec.ExitError); ok {
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return status.Signal()
+		}
+	}
+	return nil
+}
+
+// PID returns the process ID of the current or last run of the command, or
+// 0 if it hasn't started.
+func (sc *Subcmd) PID() int {
+	sc.pidMu.Lock()
+	defer sc.pidMu.Unlock()
+	if sc.current == nil || sc.current.Process == nil {
+		return 0
+	}
+	return sc.current.Process.Pid
+}
+
 func (sc *Subcmd) start() (err error) {
 	startErr := make(chan error)
 	go func() {
@@ -248,6 +438,7 @@ func (sc *Subcmd) start() (err error) {
 			return
 		}
 
+		started := time.Now()
 		sc.setStatus(StatusStarted)
 		if sc.Started != nil {
 			sc.Started <- sc.current
@@ -256,6 +447,8 @@ func (sc *Subcmd) start() (err error) {
 		sc.lastMu.Lock()
 		sc.lastErr = sc.current.Wait()
 		sc.lastStatus = exitStatus(sc.lastErr)
+		failed := sc.lastErr != nil
+		signaled := failed && sc.lastStatus == -1
 		sc.lastMu.Unlock()
 		if sc.Status() != StatusStopped {
 			sc.setStatus(StatusExited)
@@ -267,29 +460,18 @@ func (sc *Subcmd) start() (err error) {
 			sc.waitCh = nil
 		}
 		sc.waitMu.Unlock()
-
-		if sc.lastErr != nil && sc.lastStatus != -1 { // was not SIGKILLED
-			sc.runMu.Unlock()
-			return
-		}
 		sc.runMu.Unlock()
 
-		sc.restartMu.Lock()
-		if sc.maxRestarts >= 0 && sc.restarts >= sc.maxRestarts {
-			sc.restartMu.Unlock()
+		if sc.Status() == StatusStopped {
 			return
 		}
-		sc.restartMu.Unlock()
-
-		if sc.Status() != StatusStopped {
-			if err := sc.start(); err != nil {
-				panic(err)
-			}
-			sc.restartMu.Lock()
-			sc.restarts++
-			sc.restartMu.Unlock()
+		delay, status, ok := sc.nextRestart(failed, signaled, time.Since(started))
+		if status != "" {
+			sc.setStatus(status)
+		}
+		if ok {
+			sc.scheduleRestart(delay)
 		}
-
 	}()
 	return <-startErr
 }
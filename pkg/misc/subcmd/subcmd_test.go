@@ -3,6 +3,7 @@ package subcmd
 import (
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -87,6 +88,8 @@ func TestLRPNonZero(t *testing.T) {
 	assert.Equal(t, StatusStarted, <-status)
 	assert.Equal(t, StatusExited, <-status)
 	assert.Equal(t, 1, cmd.ExitStatus())
+	// exiting with a code isn't restarted by default
+	assertNoStatus(t, status)
 }
 
 func TestLRPStartStop(t *testing.T) {
@@ -153,3 +156,90 @@ func TestLRPMaxRestarts(t *testing.T) {
 	assert.Equal(t, StatusExited, <-status)
 	assert.False(t, Running(cmd))
 }
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+	assert.Equal(t, time.Duration(0), b.Delay(0))
+	for i, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		assert.Equal(t, want*time.Millisecond, b.Delay(i+1))
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := b.Delay(2)
+		assert.True(t, d >= 200*time.Millisecond && d <= 300*time.Millisecond, d)
+	}
+}
+
+func TestRestartAlways(t *testing.T) {
+	status, cmd := setupCmd(false, "echo")
+	cmd.Policy = RestartAlways
+	cmd.SetMaxRestarts(1)
+
+	assert.Nil(t, cmd.Start())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, StatusStarting, <-status)
+		assert.Equal(t, StatusStarted, <-status)
+		assert.Equal(t, StatusExited, <-status)
+	}
+	assertNoStatus(t, status)
+}
+
+func TestRestartNever(t *testing.T) {
+	status, cmd := setupCmd(true, "sh", "-c", "exit 1")
+	cmd.Policy = RestartNever
+
+	assert.Nil(t, cmd.Start())
+	assert.Equal(t, StatusStarting, <-status)
+	assert.Equal(t, StatusStarted, <-status)
+	assert.Equal(t, StatusExited, <-status)
+	assertNoStatus(t, status)
+}
+
+func TestCrashLooping(t *testing.T) {
+	status, cmd := setupCmd(true, "sh", "-c", "exit 1")
+	cmd.Policy = RestartOnFailure
+	cmd.Backoff = Backoff{}
+	cmd.CrashLoopLimit = 3
+
+	for run := 0; run < 2; run++ {
+		assert.Nil(t, cmd.Start())
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, StatusStarting, <-status)
+			assert.Equal(t, StatusStarted, <-status)
+			assert.Equal(t, StatusExited, <-status)
+		}
+		assert.Equal(t, StatusCrashLooping, <-status)
+		assertNoStatus(t, status)
+		assert.False(t, Running(cmd))
+	}
+
+	assert.Nil(t, cmd.Stop())
+	assert.Equal(t, StatusStopped, <-status)
+	assert.Equal(t, ErrNotRunning, cmd.Stop())
+}
+
+func TestStopPendingRestart(t *testing.T) {
+	status, cmd := setupCmd(true, "sh", "-c", "exit 1")
+	cmd.Policy = RestartOnFailure
+	cmd.Backoff = Backoff{Min: time.Hour}
+
+	assert.Nil(t, cmd.Start())
+	assert.Equal(t, StatusStarting, <-status)
+	assert.Equal(t, StatusStarted, <-status)
+	assert.Equal(t, StatusExited, <-status)
+
+	// let the restart be scheduled
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, cmd.Stop())
+	assert.Equal(t, StatusStopped, <-status)
+	assert.Equal(t, ErrNotRunning, cmd.Stop())
+}
+
+func assertNoStatus(t *testing.T, status chan Status) {
+	select {
+	case s := <-status:
+		assert.Fail(t, "unexpected status", s)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -8,7 +8,7 @@ import (
 
 type SingleUserBasicAuth struct {
 	Username string
-	Password string
+	Password string `tractor:"secret"`
 }
 
 func (c *SingleUserBasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -1,10 +1,10 @@
 package http
 
 import (
-	"log"
 	"net"
 	"net/http"
 
+	"github.com/manifold/tractor/pkg/misc/logging"
 	"github.com/manifold/tractor/pkg/workspace/view"
 	"github.com/urfave/negroni"
 )
@@ -14,7 +14,12 @@ type Server struct {
 	Handler  http.Handler `com:"singleton"`
 	// Middleware []negroni.Handler `com:"extpoint"`
 
-	s *http.Server
+	s   *http.Server
+	log logging.Logger `hash:"ignore"`
+}
+
+func (c *Server) SetLogger(l logging.Logger) {
+	c.log = l
 }
 
 func (c *Server) InspectorButtons() []view.Button {
@@ -24,7 +29,7 @@ func (c *Server) InspectorButtons() []view.Button {
 }
 
 func (c *Server) Serve() {
-	log.Println("starting http server")
+	c.log.Info("starting http server")
 	n := negroni.New()
 	// for _, handler := range c.Middleware {
 	// 	n.Use(handler)
@@ -34,8 +39,8 @@ func (c *Server) Serve() {
 		Handler: n,
 	}
 	go func() {
-		if err := c.s.Serve(c.Listener); err != nil {
-			log.Fatal(err)
+		if err := c.s.Serve(c.Listener); err != nil && err != http.ErrServerClosed {
+			c.log.Error(err)
 		}
 	}()
 }
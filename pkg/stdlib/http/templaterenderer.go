@@ -3,12 +3,19 @@ package http
 import (
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
+
+	"github.com/manifold/tractor/pkg/misc/logging"
 )
 
 type TemplateRenderer struct {
 	Template fmt.Stringer
+
+	log logging.Logger `hash:"ignore"`
+}
+
+func (c *TemplateRenderer) SetLogger(l logging.Logger) {
+	c.log = l
 }
 
 func (c *TemplateRenderer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -17,12 +24,13 @@ func (c *TemplateRenderer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	t, err := template.New("").Parse(c.Template.String())
 	if err != nil {
-		log.Println(err)
+		c.log.Error(err)
+		return
 	}
 	err = t.Execute(w, map[string]interface{}{
 		"Request": r,
 	})
 	if err != nil {
-		log.Println(err)
+		c.log.Error(err)
 	}
 }
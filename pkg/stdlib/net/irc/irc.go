@@ -2,11 +2,11 @@ package irc
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"reflect"
 
 	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/logging"
 	ircx "github.com/nickvanw/ircx/v2"
 	"gopkg.in/sorcix/irc.v2"
 )
@@ -16,19 +16,28 @@ type Handler interface {
 }
 
 type IRCClient struct {
-	Server string
-	Nick   string
-	User   string
-	pass   string
+	Server   string
+	Nick     string
+	User     string
+	Password string `tractor:"secret"`
 
 	Handler Handler `com:"singleton"`
 
 	bot *ircx.Bot
+	log logging.Logger `hash:"ignore"`
+}
+
+func (c *IRCClient) SetLogger(l logging.Logger) {
+	c.log = l
 }
 
 func (c *IRCClient) Initialize() error {
-	c.pass = os.Getenv("TWITCH_IRC_TOKEN")
-	c.bot = ircx.WithLogin(c.Server, c.Nick, c.User, c.pass)
+	pass := c.Password
+	if pass == "" {
+		// deprecated: set Password instead
+		pass = os.Getenv("TWITCH_IRC_TOKEN")
+	}
+	c.bot = ircx.WithLogin(c.Server, c.Nick, c.User, pass)
 	if err := c.bot.Connect(); err != nil {
 		return err
 	}
@@ -41,7 +50,7 @@ func (c *IRCClient) Initialize() error {
 
 func (c *IRCClient) OnRegisterConnect(s ircx.Sender, m *irc.Message) {
 	channel := fmt.Sprintf("#%s", c.Nick)
-	log.Print("Connected, joining ", channel, " ...")
+	c.log.Info("Connected, joining ", channel, " ...")
 	s.Send(&irc.Message{
 		Command: irc.JOIN,
 		Params:  []string{channel},
@@ -49,7 +58,7 @@ func (c *IRCClient) OnRegisterConnect(s ircx.Sender, m *irc.Message) {
 }
 
 func (c *IRCClient) OnMsgHandler(s ircx.Sender, m *irc.Message) {
-	log.Print(m)
+	c.log.Debug(m)
 	if c.Handler != nil {
 		c.Handler.HandleMessage(s, m)
 	}
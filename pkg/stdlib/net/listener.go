@@ -1,23 +1,38 @@
 package net
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net"
+
+	"github.com/manifold/tractor/pkg/misc/logging"
 )
 
 type TCPListener struct {
 	Address string
 
-	l net.Listener
+	l   net.Listener
+	err error          // why listening failed
+	log logging.Logger `hash:"ignore"`
+}
+
+var errNotListening = errors.New("tcp listener is not enabled")
+
+func (c *TCPListener) SetLogger(l logging.Logger) {
+	c.log = l
 }
 
 func (c *TCPListener) ComponentEnable() {
-	log.Printf("tcp listener at %s\n", c.Address)
+	c.log.Infof("tcp listener at %s", c.Address)
 	var err error
 	c.l, err = net.Listen("tcp", c.Address)
 	if err != nil {
-		log.Fatal(err)
+		// Accept returns the error, ending whatever is serving on it
+		c.err = fmt.Errorf("tcp listener at %s: %w", c.Address, err)
+		c.log.Error(err)
+		return
 	}
+	c.err = nil
 }
 
 func (c *TCPListener) ComponentDisable() {
@@ -27,13 +42,35 @@ func (c *TCPListener) ComponentDisable() {
 }
 
 func (c *TCPListener) Accept() (net.Conn, error) {
+	if c.l == nil {
+		return nil, c.failure()
+	}
 	return c.l.Accept()
 }
 
 func (c *TCPListener) Close() error {
+	if c.l == nil {
+		return nil
+	}
 	return c.l.Close()
 }
 
+// Addr returns the address listened on, or the configured address if
+// listening failed.
 func (c *TCPListener) Addr() net.Addr {
+	if c.l == nil {
+		addr, err := net.ResolveTCPAddr("tcp", c.Address)
+		if err != nil {
+			return &net.TCPAddr{}
+		}
+		return addr
+	}
 	return c.l.Addr()
 }
+
+func (c *TCPListener) failure() error {
+	if c.err != nil {
+		return c.err
+	}
+	return errNotListening
+}
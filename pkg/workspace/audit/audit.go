@@ -0,0 +1,184 @@
+// Package audit keeps an append-only log of changes made to a workspace and
+// who made them, stored as JSON lines in the workspace directory.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manifold/tractor/pkg/manifold"
+)
+
+// Filename is the name of the audit log in a workspace directory.
+const Filename = "audit.log"
+
+// Redacted replaces values of secret fields.
+const Redacted = "[redacted]"
+
+// Entry is a single audit record. Entries with a Method record an RPC call,
+// entries with a Field record an object change. Changes made during a call
+// have the same Caller and Method as the call.
+type Entry struct {
+	Time   time.Time   `json:"time" msgpack:"time"`
+	Caller string      `json:"caller,omitempty" msgpack:"caller"`
+	Method string      `json:"method,omitempty" msgpack:"method"`
+	Path   string      `json:"path,omitempty" msgpack:"path"`
+	Field  string      `json:"field,omitempty" msgpack:"field"`
+	Old    interface{} `json:"old,omitempty" msgpack:"old"`
+	New    interface{} `json:"new,omitempty" msgpack:"new"`
+	Error  string      `json:"error,omitempty" msgpack:"error"`
+}
+
+// Query selects entries. Zero values match everything. Path matches entries
+// for the object at the path and its descendants.
+type Query struct {
+	Since time.Time
+	Until time.Time
+	Path  string
+	Limit int
+}
+
+// Match returns whether the entry is selected by the query.
+func (q Query) Match(e Entry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.Path != "" {
+		p := strings.TrimSuffix(q.Path, "/")
+		if e.Path != p && !strings.HasPrefix(e.Path, p+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// Log is an append-only audit log file.
+type Log struct {
+	path string
+	f    *os.File
+	mu   sync.Mutex
+}
+
+// Open opens the audit log at path for appending, creating it if needed.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Append writes an entry to the log, setting its time if it is zero.
+func (l *Log) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(append(b, '\n'))
+	return err
+}
+
+// Query returns the entries selected by q in the order they were written.
+// If q has a Limit, the most recent entries up to the limit are returned.
+func (l *Log) Query(q Query) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// skip a line torn by a crash rather than failing the query
+			continue
+		}
+		if q.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Value returns a version of a change value that can be logged. Objects and
+// components become their path and name, and values that are not plain data
+// become their type name.
+func Value(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case manifold.Object:
+		return vv.Path()
+	case manifold.Component:
+		return vv.Name()
+	case []manifold.Object:
+		paths := make([]string, len(vv))
+		for i, obj := range vv {
+			paths[i] = obj.Path()
+		}
+		return paths
+	case []manifold.Component:
+		names := make([]string, len(vv))
+		for i, com := range vv {
+			names[i] = com.Name()
+		}
+		return names
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if isPlain(rv.Type().Elem().Kind()) {
+			return v
+		}
+	case reflect.Map:
+		if isPlain(rv.Type().Key().Kind()) && isPlain(rv.Type().Elem().Kind()) {
+			return v
+		}
+	default:
+		if isPlain(rv.Kind()) {
+			return v
+		}
+	}
+	return rv.Type().String()
+}
+
+func isPlain(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-workspace-audit-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	defer l.Close()
+
+	start := time.Now()
+	require.NoError(t, l.Append(Entry{Time: start, Caller: "owner", Method: "setValue", Path: "/System"}))
+	require.NoError(t, l.Append(Entry{Time: start.Add(time.Second), Path: "/System/Sandbox", Field: "Server/Addr", Old: ":80", New: ":8080"}))
+	require.NoError(t, l.Append(Entry{Time: start.Add(2 * time.Second), Path: "/Other", Field: "::Name"}))
+
+	all, err := l.Query(Query{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, ":8080", all[1].New)
+
+	system, err := l.Query(Query{Path: "/System"})
+	require.NoError(t, err)
+	assert.Len(t, system, 2)
+
+	recent, err := l.Query(Query{Since: start.Add(500 * time.Millisecond)})
+	require.NoError(t, err)
+	assert.Len(t, recent, 2)
+
+	early, err := l.Query(Query{Until: start.Add(500 * time.Millisecond)})
+	require.NoError(t, err)
+	assert.Len(t, early, 1)
+
+	last, err := l.Query(Query{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, last, 1)
+	assert.Equal(t, "/Other", last[0].Path)
+}
+
+func TestValue(t *testing.T) {
+	root := object.New("::root")
+	obj := object.New("obj")
+	root.AppendChild(obj)
+
+	assert.Nil(t, Value(nil))
+	assert.Equal(t, "hello", Value("hello"))
+	assert.Equal(t, 42, Value(42))
+	assert.Equal(t, []string{"a"}, Value([]string{"a"}))
+	assert.Equal(t, "/obj", Value(obj))
+	assert.Equal(t, "*os.File", Value(os.Stdout))
+}
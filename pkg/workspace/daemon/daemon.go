@@ -5,19 +5,32 @@ import (
 	"flag"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/manifold/tractor/pkg/manifold"
 	"github.com/manifold/tractor/pkg/manifold/object"
 	"github.com/manifold/tractor/pkg/misc/daemon"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
+	"github.com/manifold/tractor/pkg/misc/logging"
 	"github.com/manifold/tractor/pkg/misc/logging/std"
+	"github.com/manifold/tractor/pkg/misc/secret"
 	"github.com/manifold/tractor/pkg/stdlib"
+	"github.com/manifold/tractor/pkg/workspace/audit"
+	"github.com/manifold/tractor/pkg/workspace/logs"
 	"github.com/manifold/tractor/pkg/workspace/rpc"
 	"github.com/manifold/tractor/pkg/workspace/state"
 )
 
 var (
-	addr  = flag.String("addr", "localhost:4243", "server listener address")
-	proto = flag.String("proto", "websocket", "server listener protocol")
+	addr    = flag.String("addr", "localhost:4243", "server listener address")
+	proto   = flag.String("proto", "websocket", "server listener protocol")
+	tlsCert = flag.String("tls-cert", "", "certificate file to serve websocket over TLS")
+	tlsKey  = flag.String("tls-key", "", "key file for -tls-cert")
+	origins = flag.String("origins", "http://localhost:3000", "comma separated browser origins allowed over websocket")
+	grants  = flag.String("grants", "", "JSON file of additional client credentials and their permissions")
+	gateway = flag.String("gateway", "", "address to serve the HTTP JSON gateway on, such as localhost:4244")
+	build   = flag.String("build", "", "JSON file of the last build result of the workspace")
 )
 
 func init() {
@@ -27,14 +40,57 @@ func init() {
 func Run() {
 	flag.Parse()
 	logger := std.NewLogger("", os.Stdout)
+	if key, err := secret.KeyFromEnv(); err == nil {
+		secret.SetKey(key)
+		// keep the key from leaking to components and subprocesses
+		os.Unsetenv(secret.EnvKey)
+	} else if err != secret.ErrNoKey {
+		fatal(err)
+	} else {
+		logger.Info("[workspace] no secret key, secret fields will not be saved")
+	}
+	token := os.Getenv(secret.EnvToken)
+	os.Unsetenv(secret.EnvToken)
+	if token == "" && (*proto == "websocket" || *gateway != "") {
+		logger.Info("[workspace] no token, websocket and gateway clients will not be authenticated")
+	}
+	wd, err := os.Getwd()
+	fatal(err)
+	var grantList []*rpc.Grant
+	if *grants != "" {
+		grantList, err = rpc.LoadGrants(*grants)
+		fatal(err)
+	}
+	var buildResult *gobuild.Result
+	if *build != "" {
+		if buildResult, err = gobuild.Load(*build); err != nil && !os.IsNotExist(err) {
+			logger.Info("[workspace] unable to load build result:", err)
+		}
+	}
+	auditLog, err := audit.Open(filepath.Join(wd, audit.Filename))
+	fatal(err)
+	logStore := logs.NewStore(logs.DefaultBufferSize)
+	logStore.Output = os.Stdout
 	rpcSvc := &rpc.Service{
-		Protocol:   *proto,
-		ListenAddr: *addr,
-		Log:        logger,
+		Protocol:    *proto,
+		ListenAddr:  *addr,
+		Token:       token,
+		Grants:      grantList,
+		Audit:       auditLog,
+		Logs:        logStore,
+		GatewayAddr: *gateway,
+		Build:       buildResult,
+		TLSCertFile: *tlsCert,
+		TLSKeyFile:  *tlsKey,
+		Origins:     strings.Split(*origins, ","),
+		Log:         logger,
 	}
 	object.RegistryPreloader = func(o manifold.Object) []interface{} {
 		return []interface{}{o, rpcSvc}
 	}
+	object.LoggerProvider = func(o manifold.Object, com manifold.Component) logging.Logger {
+		return logStore.Logger(o, com.Name())
+	}
 	dm := daemon.New([]daemon.Service{
 		&state.Service{
 			Log: logger,
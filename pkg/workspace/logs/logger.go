@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/logging"
+)
+
+// Logger returns a logger for a component of an object that records entries
+// in the store. The object path is looked up as entries are logged so it
+// stays current if the object is renamed or moved.
+func (s *Store) Logger(obj manifold.Object, component string) logging.Logger {
+	return &logger{
+		store:     s,
+		obj:       obj,
+		component: component,
+	}
+}
+
+type logger struct {
+	store     *Store
+	obj       manifold.Object
+	component string
+	fields    map[string]interface{}
+}
+
+func (l *logger) log(level, msg string, keysAndValues []interface{}) {
+	e := Entry{
+		Time:      time.Now(),
+		Level:     level,
+		Path:      l.obj.Path(),
+		Component: l.component,
+		Message:   strings.Trim(msg, "\n "),
+		Fields:    mergeFields(l.fields, keysAndValues),
+	}
+	l.store.Append(l.obj, e)
+}
+
+// mergeFields returns fields with the key-value pairs added, or nil if
+// there are none. Non-string keys are ignored.
+func mergeFields(fields map[string]interface{}, keysAndValues []interface{}) map[string]interface{} {
+	if len(fields) == 0 && len(keysAndValues) < 2 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(fields)+len(keysAndValues)/2)
+	for k, v := range fields {
+		m[k] = v
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if key, ok := keysAndValues[i].(string); ok {
+			m[key] = keysAndValues[i+1]
+		}
+	}
+	return m
+}
+
+func (l *logger) With(args ...interface{}) logging.Logger {
+	return &logger{
+		store:     l.store,
+		obj:       l.obj,
+		component: l.component,
+		fields:    mergeFields(l.fields, args),
+	}
+}
+
+func (l *logger) Debug(args ...interface{}) {
+	l.log(Debug, fmt.Sprint(args...), nil)
+}
+
+func (l *logger) Debugf(template string, args ...interface{}) {
+	l.log(Debug, fmt.Sprintf(template, args...), nil)
+}
+
+func (l *logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log(Debug, msg, keysAndValues)
+}
+
+func (l *logger) Info(args ...interface{}) {
+	l.log(Info, fmt.Sprint(args...), nil)
+}
+
+func (l *logger) Infof(template string, args ...interface{}) {
+	l.log(Info, fmt.Sprintf(template, args...), nil)
+}
+
+func (l *logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.log(Info, msg, keysAndValues)
+}
+
+func (l *logger) Error(args ...interface{}) {
+	l.log(Error, fmt.Sprint(args...), nil)
+}
+
+func (l *logger) Errorf(template string, args ...interface{}) {
+	l.log(Error, fmt.Sprintf(template, args...), nil)
+}
+
+func (l *logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log(Error, msg, keysAndValues)
+}
@@ -0,0 +1,241 @@
+// Package logs captures what components log, tagged with the path of their
+// object and their component name. Recent entries are kept in a ring buffer
+// per object and can be streamed as they are logged.
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/buffer"
+)
+
+// Levels of entries, lowest first.
+const (
+	Debug = "debug"
+	Info  = "info"
+	Error = "error"
+)
+
+var levels = map[string]int{
+	Debug: 0,
+	Info:  1,
+	Error: 2,
+}
+
+// ValidLevel returns whether level is a known level. The empty level is
+// valid and includes everything.
+func ValidLevel(level string) bool {
+	_, ok := levels[level]
+	return ok || level == ""
+}
+
+// DefaultBufferSize is the size of the ring buffer kept for each object.
+const DefaultBufferSize = 64 * 1024
+
+// subscriptionSize is how many entries a subscriber can fall behind by
+// before entries are dropped for it.
+const subscriptionSize = 256
+
+// Entry is something a component logged.
+type Entry struct {
+	Time      time.Time              `json:"time" msgpack:"time"`
+	Level     string                 `json:"level" msgpack:"level"`
+	Path      string                 `json:"path" msgpack:"path"`
+	Component string                 `json:"component" msgpack:"component"`
+	Message   string                 `json:"message" msgpack:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty" msgpack:"fields"`
+}
+
+// Filter selects entries. Path matches entries of the object at the path
+// and its descendants, and Level entries at or above the level. Zero values
+// match everything.
+type Filter struct {
+	Path  string
+	Level string
+}
+
+// Match returns whether the entry is selected by the filter.
+func (f Filter) Match(e Entry) bool {
+	if f.Level != "" && levels[e.Level] < levels[f.Level] {
+		return false
+	}
+	if f.Path != "" && f.Path != "/" {
+		p := strings.TrimSuffix(f.Path, "/")
+		if e.Path != p && !strings.HasPrefix(e.Path, p+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscription receives entries as they are logged. Entries are dropped
+// rather than holding up components if the subscriber falls behind.
+type Subscription struct {
+	C      <-chan Entry
+	c      chan Entry
+	filter Filter
+}
+
+// Store keeps the entries of the objects in a tree.
+type Store struct {
+	// Output, if set, also gets each entry as a line of text.
+	Output io.Writer
+
+	size int64
+	bufs map[string]*buffer.Buffer
+	subs map[*Subscription]bool
+	mu   sync.Mutex
+}
+
+// NewStore returns a Store keeping up to size bytes of entries per object.
+func NewStore(size int64) *Store {
+	return &Store{
+		size: size,
+		bufs: make(map[string]*buffer.Buffer),
+		subs: make(map[*Subscription]bool),
+	}
+}
+
+// Append records an entry for an object.
+func (s *Store) Append(obj manifold.Object, e Entry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("logs:", err)
+		return
+	}
+	s.mu.Lock()
+	buf, ok := s.bufs[obj.ID()]
+	if !ok {
+		if buf, err = buffer.NewBuffer(s.size); err != nil {
+			s.mu.Unlock()
+			log.Println("logs:", err)
+			return
+		}
+		s.bufs[obj.ID()] = buf
+	}
+	buf.Write(append(b, '\n'))
+	for sub := range s.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	if s.Output != nil {
+		fmt.Fprintf(s.Output, "%s [%s %s] %s %s\n",
+			e.Time.Format("2006/01/02 15:04:05"), e.Path, e.Component, strings.ToUpper(e.Level), e.Message)
+	}
+}
+
+// Entries returns the entries kept for the objects in the tree at root
+// that match the level of the filter, oldest first.
+func (s *Store) Entries(root manifold.Object, level string) []Entry {
+	s.mu.Lock()
+	kept := s.kept(root)
+	s.mu.Unlock()
+	return s.parse(kept, level)
+}
+
+// SubscribeEntries is like Subscribe, but also returns the entries kept for
+// the objects in the tree at root that match the level of the filter, like
+// Entries. They are read as the subscription starts, so every entry is either
+// returned or sent to the subscription, but not both.
+func (s *Store) SubscribeEntries(root manifold.Object, filter Filter) (*Subscription, []Entry) {
+	sub := newSubscription(filter)
+	s.mu.Lock()
+	kept := s.kept(root)
+	s.subs[sub] = true
+	s.mu.Unlock()
+	return sub, s.parse(kept, filter.Level)
+}
+
+// kept returns the contents of the buffers of the objects in the tree at
+// root. Must be called with s.mu held.
+func (s *Store) kept(root manifold.Object) [][]byte {
+	var kept [][]byte
+	manifold.Walk(root, func(n manifold.Object) {
+		if buf, ok := s.bufs[n.ID()]; ok {
+			kept = append(kept, buf.Bytes())
+		}
+	})
+	return kept
+}
+
+// parse returns the entries in the buffer contents that match the level,
+// oldest first.
+func (s *Store) parse(kept [][]byte, level string) []Entry {
+	filter := Filter{Level: level}
+	entries := []Entry{}
+	for _, b := range kept {
+		lines := bufio.NewScanner(bytes.NewReader(b))
+		lines.Buffer(nil, int(s.size))
+		for lines.Scan() {
+			var e Entry
+			if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+				// the oldest line is cut short once the buffer wraps
+				continue
+			}
+			if filter.Match(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// Forget drops the entries of objects no longer in the tree at root.
+func (s *Store) Forget(root manifold.Object) {
+	seen := make(map[string]bool)
+	manifold.Walk(root, func(n manifold.Object) {
+		seen[n.ID()] = true
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.bufs {
+		if !seen[id] {
+			delete(s.bufs, id)
+		}
+	}
+}
+
+// Subscribe returns a subscription to entries matching the filter. It must
+// be closed with Unsubscribe.
+func (s *Store) Subscribe(filter Filter) *Subscription {
+	sub := newSubscription(filter)
+	s.mu.Lock()
+	s.subs[sub] = true
+	s.mu.Unlock()
+	return sub
+}
+
+func newSubscription(filter Filter) *Subscription {
+	c := make(chan Entry, subscriptionSize)
+	return &Subscription{C: c, c: c, filter: filter}
+}
+
+// Unsubscribe stops a subscription and closes its channel.
+func (s *Store) Unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[sub] {
+		delete(s.subs, sub)
+		close(sub.c)
+	}
+}
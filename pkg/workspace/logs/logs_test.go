@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	root := object.New("::root")
+	web := object.New("Web")
+	api := object.New("API")
+	root.AppendChild(web)
+	web.AppendChild(api)
+
+	var out bytes.Buffer
+	s := NewStore(1024)
+	s.Output = &out
+	sub := s.Subscribe(Filter{Path: "/Web/API", Level: Info})
+	defer s.Unsubscribe(sub)
+
+	s.Logger(web, "http.Server").Info("starting http server")
+	s.Logger(api, "net.TCPListener").With("addr", ":80").Debugw("accepted")
+	s.Logger(api, "net.TCPListener").Errorf("listen: %s", "address in use")
+
+	all := s.Entries(root, "")
+	require.Len(t, all, 3)
+	assert.Equal(t, "/Web", all[0].Path)
+	assert.Equal(t, "http.Server", all[0].Component)
+	assert.Equal(t, map[string]interface{}{"addr": ":80"}, all[1].Fields)
+	assert.Len(t, s.Entries(api, ""), 2)
+	errs := s.Entries(root, Error)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "listen: address in use", errs[0].Message)
+
+	e := <-sub.C
+	assert.Equal(t, Error, e.Level)
+	assert.Empty(t, sub.C)
+	assert.Contains(t, out.String(), "[/Web http.Server] INFO starting http server")
+
+	// the oldest entries are dropped once the buffer is full
+	for i := 0; i < 20; i++ {
+		s.Logger(web, "http.Server").Info("request")
+	}
+	entries := s.Entries(web, "")
+	assert.True(t, len(entries) < 20)
+	assert.Equal(t, "request", entries[len(entries)-1].Message)
+	for _, e := range entries {
+		assert.NotEqual(t, "starting http server", e.Message)
+	}
+	// the entries of other objects are kept
+	assert.Len(t, s.Entries(api, ""), 2)
+
+	web.RemoveChild(api)
+	s.Forget(root)
+	assert.Empty(t, s.Entries(api, ""))
+}
+
+func TestSubscribeEntries(t *testing.T) {
+	root := object.New("::root")
+	a := object.New("A")
+	b := object.New("B")
+	root.AppendChild(a)
+	root.AppendChild(b)
+
+	now := time.Now()
+	s := NewStore(1024)
+	s.Append(a, Entry{Time: now, Path: "/A", Level: Info, Message: "before"})
+	sub, history := s.SubscribeEntries(root, Filter{})
+	defer s.Unsubscribe(sub)
+	require.Len(t, history, 1)
+	assert.Equal(t, "before", history[0].Message)
+
+	// entries are sent whatever their time, like after the clock steps back
+	s.Append(b, Entry{Time: now.Add(-time.Second), Path: "/B", Level: Info, Message: "earlier"})
+	s.Append(a, Entry{Time: now, Path: "/A", Level: Info, Message: "same time"})
+	assert.Equal(t, "earlier", (<-sub.C).Message)
+	assert.Equal(t, "same time", (<-sub.C).Message)
+	assert.Empty(t, sub.C)
+}
+
+func TestFilter(t *testing.T) {
+	e := Entry{Path: "/Web/API", Level: Info}
+	assert.True(t, Filter{}.Match(e))
+	assert.True(t, Filter{Path: "/"}.Match(e))
+	assert.True(t, Filter{Path: "/Web/"}.Match(e))
+	assert.False(t, Filter{Path: "/We"}.Match(e))
+	assert.True(t, Filter{Level: Debug}.Match(e))
+	assert.False(t, Filter{Level: Error}.Match(e))
+	assert.True(t, ValidLevel(""))
+	assert.False(t, ValidLevel("warn"))
+}
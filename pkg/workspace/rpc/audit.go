@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/workspace/audit"
+)
+
+type AuditParams struct {
+	Since time.Time
+	Until time.Time
+	Path  string
+	Limit int
+}
+
+// callerName identifies a caller in the audit log by the grant it
+// authenticated with.
+func (s *Service) callerName(caller qrpc.Caller) string {
+	if !s.authRequired() {
+		return "local"
+	}
+	if g := s.grant(caller); g != nil {
+		return g.Name
+	}
+	return "unauthenticated"
+}
+
+// beginAudit records that a mutating call is in progress so object changes
+// made while handling it are attributed to its caller, which relies on
+// mutating calls being handled one at a time. The returned func records the
+// call itself and must be called when the call is done.
+func (s *Service) beginAudit(caller qrpc.Caller, method string, resp *responder) func() {
+	call := &audit.Entry{
+		Time:   time.Now(),
+		Caller: s.callerName(caller),
+		Method: method,
+	}
+	s.callMu.Lock()
+	s.call = call
+	s.callMu.Unlock()
+	return func() {
+		s.callMu.Lock()
+		s.call = nil
+		s.callMu.Unlock()
+		if resp.err != nil {
+			call.Error = resp.err.Error()
+		}
+		if err := s.Audit.Append(*call); err != nil {
+			log.Println("audit:", err)
+		}
+	}
+}
+
+// auditChange records an object change, attributed to the call in progress
+// if there is one. Values of secret fields are redacted.
+func (s *Service) auditChange(change manifold.ObjectChange) {
+	e := audit.Entry{
+		Time:  time.Now(),
+		Path:  change.Object.Path(),
+		Field: change.Path,
+		Old:   audit.Value(change.Old),
+		New:   audit.Value(change.New),
+	}
+	if parts := strings.SplitN(change.Path, "/", 2); len(parts) == 2 {
+		if com := change.Object.Component(parts[0]); com != nil && library.IsSecretPath(com, parts[1]) {
+			e.Old, e.New = audit.Redacted, audit.Redacted
+		}
+	}
+	s.callMu.Lock()
+	if s.call != nil {
+		e.Caller = s.call.Caller
+		e.Method = s.call.Method
+		if s.call.Path == "" {
+			s.call.Path = e.Path
+		}
+	}
+	s.callMu.Unlock()
+	if err := s.Audit.Append(e); err != nil {
+		log.Println("audit:", err)
+	}
+}
+
+// AuditLog returns audit entries selected by time range and path.
+func (s *Service) AuditLog() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params AuditParams
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		if s.Audit == nil {
+			r.Return(Errorf(NotFound, "audit log is not enabled"))
+			return
+		}
+		entries, err := s.Audit.Query(audit.Query{
+			Since: params.Since,
+			Until: params.Until,
+			Path:  params.Path,
+			Limit: params.Limit,
+		})
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(entries)
+	}
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"crypto/subtle"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+)
+
+// AuthResult describes the grant a client authenticated with.
+type AuthResult struct {
+	Name        string
+	Permissions []string
+	Paths       []string
+}
+
+func (s *Service) authRequired() bool {
+	return s.Token != "" || len(s.Grants) > 0
+}
+
+// findGrant returns the grant for a token, or nil if there is none.
+func (s *Service) findGrant(token string) *Grant {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 {
+		return ownerGrant(s.Token)
+	}
+	for _, g := range s.Grants {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) == 1 {
+			return g
+		}
+	}
+	return nil
+}
+
+// Authenticate checks a token issued by the agent for this workspace, or
+// one from its grants, and allows the caller what its grant permits.
+func (s *Service) Authenticate() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var token string
+		if err := decode(c, &token); err != nil {
+			r.Return(err)
+			return
+		}
+		g := ownerGrant("")
+		if s.authRequired() {
+			g = s.findGrant(token)
+		}
+		if g == nil {
+			r.Return(Errorf(Unauthenticated, "invalid token"))
+			return
+		}
+		s.mu.Lock()
+		s.authed[c.Caller] = g
+		s.mu.Unlock()
+		r.Return(AuthResult{
+			Name:        g.Name,
+			Permissions: splitPermissions(g.Permission()),
+			Paths:       g.Paths,
+		})
+	}
+}
+
+func splitPermissions(p Permission) []string {
+	var names []string
+	for _, name := range []string{"read", "write", "execute"} {
+		if p&permissionNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,200 @@
+package rpc
+
+import (
+	"strings"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/mitchellh/mapstructure"
+)
+
+// BatchOp is one operation of a batch. Op is the name of the handler it
+// does the work of and Params are the params that handler takes. If Ref is
+// set, later ops can refer to the object the op created or changed as
+// "$<Ref>": as the whole value of an ID or ParentID param, or as the start
+// of a Path or RefValue param, such as "$server/http.Server/Addr".
+type BatchOp struct {
+	Op     string
+	Ref    string
+	Params map[string]interface{}
+}
+
+type BatchParams struct {
+	Ops []BatchOp
+}
+
+// BatchResult maps the Ref of each op that had one to the ID of its object.
+type BatchResult struct {
+	Refs map[string]string
+}
+
+// Batch applies a list of operations in order as one change. If any of them
+// fails, the ones before it are undone and the error says which failed.
+// Clients get a single view update for the whole batch.
+func (s *Service) Batch() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params BatchParams
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		refs, err := s.batch(c.Caller, params.Ops)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		result := BatchResult{Refs: make(map[string]string)}
+		for ref, obj := range refs {
+			result.Refs[ref] = obj.ID()
+		}
+		r.Return(result)
+	}
+}
+
+// batch applies ops with view updates held until they are done.
+func (s *Service) batch(caller qrpc.Caller, ops []BatchOp) (map[string]manifold.Object, error) {
+	s.mu.Lock()
+	s.batching = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.batching = false
+		s.mu.Unlock()
+		s.updateView()
+	}()
+	return s.applyBatch(caller, ops)
+}
+
+// applyBatch applies ops in order, rolling back all of them if one fails,
+// and returns the objects of the ops that had a Ref.
+func (s *Service) applyBatch(caller qrpc.Caller, ops []BatchOp) (map[string]manifold.Object, error) {
+	t := &txn{}
+	defer func() {
+		if p := recover(); p != nil {
+			t.rollback()
+			panic(p)
+		}
+	}()
+	refs := make(map[string]manifold.Object)
+	for i, op := range ops {
+		obj, err := s.batchOp(t, caller, op, refs)
+		if err != nil {
+			t.rollback()
+			return nil, batchError(i, op, err)
+		}
+		if op.Ref != "" {
+			refs[op.Ref] = obj
+		}
+	}
+	t.commit()
+	return refs, nil
+}
+
+func (s *Service) batchOp(t *txn, caller qrpc.Caller, op BatchOp, refs map[string]manifold.Object) (manifold.Object, error) {
+	if op.Ref != "" {
+		if _, ok := refs[op.Ref]; ok {
+			return nil, Errorf(InvalidArgument, "ref already used: %s", op.Ref)
+		}
+	}
+	p, err := resolveRefs(op.Params, refs)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "appendNode":
+		var params AppendNodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.appendNode(t, caller, params)
+	case "deleteNode":
+		var params NodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.deleteNode(t, caller, params.ID)
+	case "updateNode":
+		var params NodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.updateNode(t, caller, params)
+	case "moveNode":
+		var params MoveNodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.moveNode(t, caller, params)
+	case "reparentNode":
+		var params ReparentNodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.reparentNode(t, caller, params)
+	case "appendComponent":
+		var params AppendNodeParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.appendComponent(t, caller, params)
+	case "removeComponent":
+		var params RemoveComponentParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.removeComponent(t, caller, params)
+	case "setValue":
+		var params SetValueParams
+		if err := decodeOp(p, &params); err != nil {
+			return nil, err
+		}
+		return s.setValue(t, caller, params)
+	}
+	return nil, Errorf(InvalidArgument, "unsupported batch op: %q", op.Op)
+}
+
+func decodeOp(params map[string]interface{}, v interface{}) error {
+	if err := mapstructure.Decode(params, v); err != nil {
+		return Errorf(InvalidArgument, "unable to decode params: %s", err)
+	}
+	return nil
+}
+
+// resolveRefs returns a copy of params with references to objects of earlier
+// ops replaced by their current ID or path.
+func resolveRefs(params map[string]interface{}, refs map[string]manifold.Object) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		resolved[k] = v
+		str, ok := v.(string)
+		if !ok || !strings.HasPrefix(str, "$") {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case "id", "parentid":
+			obj, ok := refs[str[1:]]
+			if !ok {
+				return nil, Errorf(InvalidArgument, "unknown ref: %s", str)
+			}
+			resolved[k] = obj.ID()
+		case "path", "refvalue":
+			parts := strings.SplitN(str[1:], "/", 2)
+			obj, ok := refs[parts[0]]
+			if !ok {
+				return nil, Errorf(InvalidArgument, "unknown ref: $%s", parts[0])
+			}
+			path := obj.Path()
+			if len(parts) == 2 {
+				path = path + "/" + parts[1]
+			}
+			resolved[k] = path
+		}
+	}
+	return resolved, nil
+}
+
+// batchError says which op of a batch failed, keeping the code of err.
+func batchError(idx int, op BatchOp, err error) error {
+	e := asError(err)
+	return Errorf(e.Code, "op %d (%s): %s", idx, op.Op, e.Message)
+}
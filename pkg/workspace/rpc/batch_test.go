@@ -0,0 +1,57 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/workspace/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchOps(t *testing.T) {
+	root := object.New("::root")
+	existing := object.New("Existing")
+	root.AppendChild(existing)
+	s := &Service{State: &state.Service{Root: root}}
+
+	ops := []BatchOp{
+		{Op: "appendNode", Ref: "parent", Params: map[string]interface{}{"Name": "Parent"}},
+		{Op: "appendNode", Ref: "child", Params: map[string]interface{}{"ID": "$parent", "Name": "Child"}},
+		{Op: "updateNode", Params: map[string]interface{}{"ID": "$child", "Name": "Renamed"}},
+		{Op: "moveNode", Params: map[string]interface{}{"ID": "$parent", "Index": 0}},
+		{Op: "deleteNode", Params: map[string]interface{}{"ID": existing.ID()}},
+	}
+	failing := append(ops[:len(ops):len(ops)], BatchOp{Op: "appendNode", Params: map[string]interface{}{"ID": "$nope", "Name": "X"}})
+	_, err := s.applyBatch(nil, failing)
+	require.Error(t, err)
+	assert.Equal(t, InvalidArgument, ErrorCode(err))
+	require.Len(t, root.Children(), 1)
+	assert.Equal(t, existing, root.ChildAt(0))
+
+	refs, err := s.applyBatch(nil, ops)
+	require.NoError(t, err)
+	assert.Len(t, refs, 2)
+	require.Len(t, root.Children(), 1)
+	assert.Equal(t, "Parent", root.ChildAt(0).Name())
+	assert.NotNil(t, root.FindChild("Parent/Renamed"))
+}
+
+func TestResolveRefs(t *testing.T) {
+	root := object.New("::root")
+	obj := object.New("Server")
+	root.AppendChild(obj)
+	refs := map[string]manifold.Object{"server": obj}
+
+	params := map[string]interface{}{"ID": "$server", "Path": "$server/http.Server/Addr", "Value": "$literal"}
+	resolved, err := resolveRefs(params, refs)
+	require.NoError(t, err)
+	assert.Equal(t, obj.ID(), resolved["ID"])
+	assert.Equal(t, "/Server/http.Server/Addr", resolved["Path"])
+	assert.Equal(t, "$literal", resolved["Value"])
+	assert.Equal(t, "$server", params["ID"])
+
+	_, err = resolveRefs(map[string]interface{}{"ID": "$missing"}, refs)
+	assert.Error(t, err)
+}
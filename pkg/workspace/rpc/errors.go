@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+)
+
+// Code classifies an error returned by a workspace RPC handler.
+type Code string
+
+const (
+	NotFound         Code = "NotFound"
+	InvalidArgument  Code = "InvalidArgument"
+	TypeMismatch     Code = "TypeMismatch"
+	Conflict         Code = "Conflict"
+	Unauthenticated  Code = "Unauthenticated"
+	PermissionDenied Code = "PermissionDenied"
+	Internal         Code = "Internal"
+)
+
+var codes = []Code{NotFound, InvalidArgument, TypeMismatch, Conflict, Unauthenticated, PermissionDenied, Internal}
+
+// Error is an error with a code. Errors only cross the wire as strings, so
+// it is encoded as "<code>: <message>" and can be recovered with ErrorCode.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Errorf returns an Error with the given code and formatted message.
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// ErrorCode returns the code of an error returned from a call, Internal if
+// it has none, or an empty Code if err is nil.
+func ErrorCode(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	for _, code := range codes {
+		if strings.HasPrefix(err.Error(), string(code)+": ") {
+			return code
+		}
+	}
+	return Internal
+}
+
+// asError returns err as an Error, with the Internal code if it has none.
+func asError(err error) *Error {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Code: Internal, Message: err.Error()}
+	}
+	return e
+}
+
+// responder tracks whether a handler has responded to its call, and with
+// what error.
+type responder struct {
+	qrpc.Responder
+	done bool
+	err  error
+}
+
+func (r *responder) Return(v interface{}) error {
+	r.done = true
+	if err, ok := v.(error); ok {
+		e := asError(err)
+		r.err = e
+		v = e
+	}
+	return r.Responder.Return(v)
+}
+
+func (r *responder) Hijack(v interface{}) (mux.Channel, error) {
+	r.done = true
+	return r.Responder.Hijack(v)
+}
+
+// handle registers a handler wrapped with handler.
+func (s *Service) handle(name string, h func(qrpc.Responder, *qrpc.Call)) {
+	s.api.HandleFunc(name, s.handler(name, h))
+}
+
+// handler wraps a handler so it always responds to its call. Panics are
+// recovered and returned as Internal errors, and handlers that return
+// without responding get a nil response. Callers must authenticate first
+// if the service has credentials, and have the permission for the handler.
+// Calls that change the workspace are handled one at a time, so batches
+// apply atomically, and are recorded in the audit log, including denied ones.
+func (s *Service) handler(name string, h func(qrpc.Responder, *qrpc.Call)) func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		resp := &responder{Responder: r}
+		// the repl is long running and serializes each line it evaluates
+		if name != "repl" {
+			defer s.beginCall(c.Caller, name, resp)()
+		}
+		if name != "authenticate" {
+			if err := s.authorize(c.Caller, handlerPermissions[name], nil); err != nil {
+				resp.Return(err)
+				return
+			}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("rpc %s: panic: %v\n%s", name, p, debug.Stack())
+				if !resp.done {
+					resp.Return(Errorf(Internal, "%s: %v", name, p))
+				}
+				return
+			}
+			if !resp.done {
+				resp.Return(nil)
+			}
+		}()
+		h(resp, c)
+	}
+}
+
+// beginCall serializes calls to handlers that change the workspace and
+// records them in the audit log if there is one. The returned func must be
+// called when the call is done.
+func (s *Service) beginCall(caller qrpc.Caller, name string, resp *responder) func() {
+	if handlerPermissions[name]&(Write|Execute) == 0 {
+		return func() {}
+	}
+	s.writeMu.Lock()
+	end := func() {}
+	if s.Audit != nil {
+		end = s.beginAudit(caller, name, resp)
+	}
+	return func() {
+		end()
+		s.writeMu.Unlock()
+	}
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code Code
+	}{
+		{nil, ""},
+		{Errorf(NotFound, "unable to find node: %s", "x"), NotFound},
+		{fmt.Errorf("batch op 1: %w", Errorf(Conflict, "name taken")), Conflict},
+		{errors.New("PermissionDenied: write not permitted"), PermissionDenied},
+		{errors.New("TypeMismatch:missing space"), Internal},
+		{errors.New("boom"), Internal},
+	} {
+		assert.Equal(t, tt.code, ErrorCode(tt.err), "%v", tt.err)
+	}
+}
+
+func TestErrorWire(t *testing.T) {
+	for _, code := range codes {
+		sent := Errorf(code, "something about %s", code)
+		// errors cross the wire as their string
+		received := errors.New(sent.Error())
+		assert.Equal(t, code, ErrorCode(received))
+		assert.Equal(t, sent.Error(), received.Error())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		h       func(qrpc.Responder, *qrpc.Call)
+		v       interface{}
+		code    Code
+		returns int
+	}{
+		{
+			name:    "responds",
+			h:       func(r qrpc.Responder, c *qrpc.Call) { r.Return("ok") },
+			v:       "ok",
+			returns: 1,
+		},
+		{
+			name:    "no response",
+			h:       func(r qrpc.Responder, c *qrpc.Call) {},
+			returns: 1,
+		},
+		{
+			name:    "plain error",
+			h:       func(r qrpc.Responder, c *qrpc.Call) { r.Return(errors.New("boom")) },
+			code:    Internal,
+			returns: 1,
+		},
+		{
+			name:    "coded error",
+			h:       func(r qrpc.Responder, c *qrpc.Call) { r.Return(Errorf(NotFound, "nope")) },
+			code:    NotFound,
+			returns: 1,
+		},
+		{
+			name:    "panic",
+			h:       func(r qrpc.Responder, c *qrpc.Call) { panic("oops") },
+			code:    Internal,
+			returns: 1,
+		},
+		{
+			name: "panic after responding",
+			h: func(r qrpc.Responder, c *qrpc.Call) {
+				r.Return("ok")
+				panic("oops")
+			},
+			v:       "ok",
+			returns: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService()
+			r := &testResponder{}
+			s.handler("search", tt.h)(r, &qrpc.Call{Caller: newTestCaller()})
+			assert.Equal(t, tt.returns, r.returns)
+			if tt.code == "" {
+				assert.Equal(t, tt.v, r.v)
+				return
+			}
+			err, ok := r.v.(*Error)
+			require.True(t, ok, "%#v", r.v)
+			assert.Equal(t, tt.code, err.Code)
+		})
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s := newTestService()
+		s.Token = "secret"
+		r := &testResponder{}
+		called := false
+		s.handler("search", func(qrpc.Responder, *qrpc.Call) { called = true })(r, &qrpc.Call{Caller: newTestCaller()})
+		assert.False(t, called)
+		assert.Equal(t, Unauthenticated, ErrorCode(r.v.(error)))
+	})
+}
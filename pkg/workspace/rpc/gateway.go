@@ -0,0 +1,386 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/workspace/view"
+)
+
+// Gateway returns an HTTP handler that serves part of the workspace RPC API
+// as JSON for scripts and tools that don't speak qrpc:
+//
+//	GET  /tree            the view state
+//	GET  /objects/{path}  a snapshot of the node at path
+//	GET  /fields/{path}   the value of a field, such as /fields/Server/http.Server/Addr
+//	PUT  /fields/{path}   sets a field to the JSON value in the body
+//	POST /methods/{path}  calls a component method
+//	POST /rpc/{op}        applies a batch op, or a batch, with JSON params
+//	GET  /search?q=...    objects matching a search query
+//	GET  /events          server-sent events of the view state and patches
+//	GET  /logs            server-sent events of component logs, by path and level
+//
+// Clients authenticate with a workspace or grant token as a Bearer token, or
+// as the token query parameter where they can't set headers. Errors are
+// returned as {"code": ..., "error": ...} with a matching HTTP status.
+func (s *Service) Gateway() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tree", s.gatewayTree)
+	mux.HandleFunc("/objects/", s.gatewayObject)
+	mux.HandleFunc("/fields/", s.gatewayField)
+	mux.HandleFunc("/methods/", s.gatewayMethod)
+	mux.HandleFunc("/rpc/", s.gatewayRPC)
+	mux.HandleFunc("/search", s.gatewaySearch)
+	mux.HandleFunc("/events", s.gatewayEvents)
+	mux.HandleFunc("/logs", s.gatewayLogs)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkOrigin(r.Header.Get("Origin"), s.Origins); err != nil {
+			writeError(w, Errorf(PermissionDenied, "%s", err))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// gatewayCaller stands in for a qrpc caller so gateway requests are
+// authorized, audited and sent view changes like qrpc clients.
+type gatewayCaller struct {
+	events chan gatewayEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+type gatewayEvent struct {
+	name string
+	data interface{}
+}
+
+// Call queues an event for a client streaming events. A client that falls
+// behind is disconnected rather than holding up others, and can reconnect.
+func (c *gatewayCaller) Call(path string, args, reply interface{}) (*qrpc.Response, error) {
+	if c.events == nil {
+		return nil, fmt.Errorf("gateway client is not streaming events")
+	}
+	select {
+	case c.events <- gatewayEvent{name: path, data: args}:
+		return nil, nil
+	default:
+		c.once.Do(func() { close(c.done) })
+		return nil, fmt.Errorf("gateway client fell behind")
+	}
+}
+
+// gatewayCaller returns a caller for a request, authenticated with the
+// token it presents. It must be released with releaseCaller.
+func (s *Service) gatewayCaller(r *http.Request) (*gatewayCaller, error) {
+	caller := &gatewayCaller{}
+	if !s.authRequired() {
+		return caller, nil
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	g := s.findGrant(token)
+	if g == nil {
+		return nil, Errorf(Unauthenticated, "missing or invalid token")
+	}
+	s.mu.Lock()
+	s.authed[caller] = g
+	s.mu.Unlock()
+	return caller, nil
+}
+
+func (s *Service) releaseCaller(caller *gatewayCaller) {
+	s.mu.Lock()
+	s.dropClient(caller)
+	s.mu.Unlock()
+}
+
+// gatewayCall runs f like a call to the named handler: authorized for the
+// handler's permission, serialized if it changes the workspace, audited, and
+// with panics returned as Internal errors.
+func (s *Service) gatewayCall(r *http.Request, name string, f func(caller qrpc.Caller) (interface{}, error)) (v interface{}, err error) {
+	caller, err := s.gatewayCaller(r)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseCaller(caller)
+	resp := &responder{}
+	defer s.beginCall(caller, name, resp)()
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("gateway %s: panic: %v\n%s", name, p, debug.Stack())
+			err = Errorf(Internal, "%s: %v", name, p)
+		}
+		if err != nil {
+			resp.err = asError(err)
+		}
+	}()
+	if err := s.authorize(caller, handlerPermissions[name], nil); err != nil {
+		return nil, err
+	}
+	return f(caller)
+}
+
+func (s *Service) gatewayTree(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	v, err := s.gatewayCall(r, "resync", func(qrpc.Caller) (interface{}, error) {
+		s.updateView()
+		return s.viewState.Copy(), nil
+	})
+	writeResult(w, v, err)
+}
+
+func (s *Service) gatewayObject(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/objects")
+	v, err := s.gatewayCall(r, "exportNode", func(qrpc.Caller) (interface{}, error) {
+		if path == "/" {
+			return s.State.Root.Snapshot(), nil
+		}
+		n, err := s.findPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return n.Snapshot(), nil
+	})
+	writeResult(w, v, err)
+}
+
+func (s *Service) gatewayField(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/fields")
+	switch r.Method {
+	case http.MethodGet:
+		v, err := s.gatewayCall(r, "exportNode", func(qrpc.Caller) (interface{}, error) {
+			n, localPath, err := s.findLocal(path)
+			if err != nil {
+				return nil, err
+			}
+			parts := strings.SplitN(localPath, "/", 2)
+			com := n.Component(parts[0])
+			if com == nil || len(parts) < 2 {
+				return nil, Errorf(NotFound, "unable to find field: %s", path)
+			}
+			v, _, err := com.GetField(parts[1])
+			if err != nil {
+				return nil, Errorf(NotFound, "%s", err)
+			}
+			if library.IsSecretPath(com, parts[1]) {
+				return view.SecretMask, nil
+			}
+			return v, nil
+		})
+		writeResult(w, v, err)
+	case http.MethodPut:
+		var value interface{}
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			writeError(w, Errorf(InvalidArgument, "unable to decode body: %s", err))
+			return
+		}
+		_, err := s.gatewayCall(r, "setValue", func(caller qrpc.Caller) (interface{}, error) {
+			t := &txn{}
+			if _, err := s.setValue(t, caller, SetValueParams{Path: path, Value: value}); err != nil {
+				return nil, err
+			}
+			t.commit()
+			s.updateView()
+			return nil, nil
+		})
+		writeResult(w, nil, err)
+	default:
+		allowMethod(w, r, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (s *Service) gatewayMethod(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/methods")
+	_, err := s.gatewayCall(r, "callMethod", func(caller qrpc.Caller) (interface{}, error) {
+		err := s.callMethod(caller, path)
+		s.updateView()
+		return nil, err
+	})
+	writeResult(w, nil, err)
+}
+
+// gatewayOpResult is the node a single op created or changed.
+type gatewayOpResult struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+func (s *Service) gatewayRPC(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	op := strings.TrimPrefix(r.URL.Path, "/rpc/")
+	if op == "batch" {
+		var params BatchParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeError(w, Errorf(InvalidArgument, "unable to decode body: %s", err))
+			return
+		}
+		v, err := s.gatewayCall(r, op, func(caller qrpc.Caller) (interface{}, error) {
+			refs, err := s.batch(caller, params.Ops)
+			if err != nil {
+				return nil, err
+			}
+			result := BatchResult{Refs: make(map[string]string)}
+			for ref, obj := range refs {
+				result.Refs[ref] = obj.ID()
+			}
+			return result, nil
+		})
+		writeResult(w, v, err)
+		return
+	}
+	if _, ok := handlerPermissions[op]; !ok {
+		writeError(w, Errorf(NotFound, "unknown op: %s", op))
+		return
+	}
+	params := make(map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, Errorf(InvalidArgument, "unable to decode body: %s", err))
+		return
+	}
+	v, err := s.gatewayCall(r, op, func(caller qrpc.Caller) (interface{}, error) {
+		refs, err := s.batch(caller, []BatchOp{{Op: op, Ref: "result", Params: params}})
+		if err != nil {
+			return nil, err
+		}
+		obj := refs["result"]
+		return gatewayOpResult{ID: obj.ID(), Path: obj.Path()}, nil
+	})
+	writeResult(w, v, err)
+}
+
+// gatewayEvents streams the view state as a "state" event, then patches to
+// it as "patch" events, like the qrpc subscribe call.
+func (s *Service) gatewayEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, Errorf(Internal, "streaming is not supported"))
+		return
+	}
+	caller, err := s.gatewayCaller(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.releaseCaller(caller)
+	if err := s.authorize(caller, handlerPermissions["subscribe"], nil); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	caller.events = make(chan gatewayEvent, 64)
+	caller.done = make(chan struct{})
+	s.updateView()
+	s.mu.Lock()
+	cl := s.client(caller)
+	state := s.clientState(cl)
+	cl.subscribed = true
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := writeEvent(w, "state", state); err != nil {
+		return
+	}
+	flusher.Flush()
+	for {
+		select {
+		case e := <-caller.events:
+			if err := writeEvent(w, e.name, e.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-caller.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Println("gateway:", err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{
+		"code":  string(InvalidArgument),
+		"error": fmt.Sprintf("method %s not allowed", r.Method),
+	})
+	return false
+}
+
+func writeResult(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+var statusCodes = map[Code]int{
+	NotFound:         http.StatusNotFound,
+	InvalidArgument:  http.StatusBadRequest,
+	TypeMismatch:     http.StatusBadRequest,
+	Conflict:         http.StatusConflict,
+	Unauthenticated:  http.StatusUnauthorized,
+	PermissionDenied: http.StatusForbidden,
+	Internal:         http.StatusInternalServerError,
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := asError(err)
+	writeJSON(w, statusCodes[e.Code], map[string]string{
+		"code":  string(e.Code),
+		"error": e.Message,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(map[string]string{"code": string(Internal), "error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/workspace/view"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gatewayRequest(t *testing.T, h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayAuth(t *testing.T) {
+	s := newTestService()
+	s.Token = "owner"
+	s.Grants = []*Grant{{Name: "viewer", Token: "viewer", Permissions: []string{"read"}}}
+	require.NoError(t, s.Grants[0].parse())
+	s.Origins = []string{"http://studio"}
+	h := s.Gateway()
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+		code   Code
+	}{
+		{"no token", "GET", "/tree", "", http.StatusUnauthorized, Unauthenticated},
+		{"wrong token", "GET", "/tree", "nope", http.StatusUnauthorized, Unauthenticated},
+		{"owner", "GET", "/tree", "owner", http.StatusOK, ""},
+		{"query token", "GET", "/tree?token=owner", "", http.StatusOK, ""},
+		{"grant", "GET", "/tree", "viewer", http.StatusOK, ""},
+		{"grant denied", "POST", "/rpc/appendNode", "viewer", http.StatusForbidden, PermissionDenied},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := gatewayRequest(t, h, tt.method, tt.target, tt.token, `{"Name": "b"}`)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				var body map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, string(tt.code), body["code"])
+			}
+		})
+	}
+	assert.Nil(t, s.State.Root.FindChild("b"))
+	assert.Empty(t, s.authed)
+
+	t.Run("origin", func(t *testing.T) {
+		for origin, status := range map[string]int{
+			"http://studio":      http.StatusOK,
+			"http://example.com": http.StatusForbidden,
+		} {
+			r := httptest.NewRequest("GET", "/tree", nil)
+			r.Header.Set("Authorization", "Bearer owner")
+			r.Header.Set("Origin", origin)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, status, w.Code, origin)
+		}
+	})
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	s := newTestService()
+	h := s.Gateway()
+
+	w := gatewayRequest(t, h, "GET", "/tree", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var state view.State
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.Equal(t, []string{"/a"}, state.Hierarchy)
+
+	w = gatewayRequest(t, h, "GET", "/objects/a", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"a"`)
+	w = gatewayRequest(t, h, "GET", "/objects/missing", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = gatewayRequest(t, h, "POST", "/rpc/appendNode", "", `{"Name": "b"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result gatewayOpResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "/b", result.Path)
+	assert.NotNil(t, s.State.Root.FindChild("b"))
+
+	w = gatewayRequest(t, h, "POST", "/rpc/nope", "", `{}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = gatewayRequest(t, h, "POST", "/rpc/appendNode", "", `not json`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = gatewayRequest(t, h, "POST", "/tree", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+	w = gatewayRequest(t, h, "DELETE", "/fields/a/x", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PUT", w.Header().Get("Allow"))
+}
+
+func TestGatewayEvents(t *testing.T) {
+	s := newTestService()
+	server := httptest.NewServer(s.Gateway())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := bufio.NewReader(resp.Body)
+	next := func() (string, string) {
+		var name, data string
+		for {
+			line, err := events.ReadString('\n')
+			require.NoError(t, err)
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			case line == "\n":
+				return name, data
+			}
+		}
+	}
+
+	name, data := next()
+	assert.Equal(t, "state", name)
+	var state view.State
+	require.NoError(t, json.Unmarshal([]byte(data), &state))
+	assert.Equal(t, []string{"/a"}, state.Hierarchy)
+
+	s.mu.Lock()
+	s.flush([]view.PatchOp{{Op: "replace", Path: "/hierarchy"}})
+	s.mu.Unlock()
+	name, data = next()
+	assert.Equal(t, "patch", name)
+	var patch view.Patch
+	require.NoError(t, json.Unmarshal([]byte(data), &patch))
+	assert.Equal(t, uint64(1), patch.Seq)
+	require.Len(t, patch.Ops, 1)
+	assert.Equal(t, "/hierarchy", patch.Ops[0].Path)
+}
@@ -1,14 +1,12 @@
 package rpc
 
 import (
-	"fmt"
-	"path/filepath"
+	"bytes"
 	"reflect"
 	"strings"
 
 	qrpc "github.com/manifold/qtalk/golang/rpc"
-	"github.com/manifold/tractor/pkg/manifold/library"
-	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
 )
 
 type AppendNodeParams struct {
@@ -39,11 +37,37 @@ type DelegateParams struct {
 	Contents string
 }
 
+type ExpandNodeParams struct {
+	ID       string
+	Expanded bool
+}
+
 type MoveNodeParams struct {
 	ID    string
 	Index int
 }
 
+// ReparentNodeParams moves a node under the node with ParentID, or the root
+// if it is empty, at Index among its children. An Index past the last child
+// appends.
+type ReparentNodeParams struct {
+	ID       string
+	ParentID string
+	Index    int
+}
+
+type ImportNodeParams struct {
+	ID     string
+	Bundle []byte
+}
+
+type ImportNodeResult struct {
+	ID      string
+	Path    string
+	Missing []string
+	Pending []string
+}
+
 func (s *Service) Reload() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		s.updateView()
@@ -51,42 +75,19 @@ func (s *Service) Reload() func(qrpc.Responder, *qrpc.Call) {
 	}
 }
 
-// api.HandleFunc("repl", func(r qrpc.Responder, c *qrpc.Call) {
-// 	var params DelegateParams
-// 	_ = c.Decode(&params)
-// 	// ^^ TODO: make sure this isn't necessary before hijacking
-// 	ch, err := r.Hijack(nil)
-// 	if err != nil {
-// 		log.Println(err)
-// 	}
-// 	repl := repl.NewREPL(func(v interface{}) {
-// 		fmt.Fprintf(ch, "%s\n", v)
-// 	})
-// 	repl.Run(ch, ch, map[string]interface{}{
-// 		"Root": root,
-// 	})
-// })
-
 func (s *Service) RemoveComponent() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params RemoveComponentParams
-		err := c.Decode(&params)
-		if err != nil {
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindID(params.ID)
-		if n == nil {
-			r.Return(fmt.Errorf("unable to find node: %s", params.ID))
+		t := &txn{}
+		if _, err := s.removeComponent(t, c.Caller, params); err != nil {
+			r.Return(err)
 			return
 		}
-		com := n.Component(params.Component)
-		n.RemoveComponent(com)
-		if com.ID() == n.ID() {
-			if err := s.State.Image.DestroyObjectPackage(n); err != nil {
-				fmt.Println(err)
-			}
-		}
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
@@ -95,23 +96,28 @@ func (s *Service) RemoveComponent() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) ReloadComponent() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params RemoveComponentParams
-		err := c.Decode(&params)
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		n, err := s.findID(params.ID)
 		if err != nil {
 			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindID(params.ID)
-		if n == nil {
-			r.Return(fmt.Errorf("unable to find node: %s", params.ID))
+		if err := s.authorize(c.Caller, Execute, n); err != nil {
+			r.Return(err)
 			return
 		}
 		com := n.Component(params.Component)
-		if com != nil {
-			if err := com.Reload(); err != nil {
-				r.Return(err)
-				return
-			}
-		}		
+		if com == nil {
+			r.Return(Errorf(NotFound, "unable to find component %q on node: %s", params.Component, params.ID))
+			return
+		}
+		if err := com.Reload(); err != nil {
+			r.Return(err)
+			return
+		}
 		n.UpdateRegistry()
 		s.updateView()
 		r.Return(nil)
@@ -121,77 +127,182 @@ func (s *Service) ReloadComponent() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) AddDelegate() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params NodeParams
-		err := c.Decode(&params)
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		obj, err := s.findID(params.ID)
 		if err != nil {
 			r.Return(err)
 			return
 		}
-		obj := s.State.Root.FindID(params.ID)
-		if obj == nil {
-			r.Return(nil)
+		if err := s.authorize(c.Caller, Write, obj); err != nil {
+			r.Return(err)
 			return
 		}
 		r.Return(s.State.Image.CreateObjectPackage(obj))
 	}
 }
 
+func (s *Service) ExportNode() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var path string
+		if err := decode(c, &path); err != nil {
+			r.Return(err)
+			return
+		}
+		n, err := s.findPath(path)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		if n == s.State.Root {
+			r.Return(Errorf(InvalidArgument, "cannot export the root node"))
+			return
+		}
+		var buf bytes.Buffer
+		if err := s.State.Image.Export(n, &buf); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(buf.Bytes())
+	}
+}
+
+func (s *Service) ImportNode() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params ImportNodeParams
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		if len(params.Bundle) == 0 {
+			r.Return(Errorf(InvalidArgument, "bundle is empty"))
+			return
+		}
+		p, err := s.findParent(params.ID)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		if err := s.authorize(c.Caller, Write, p); err != nil {
+			r.Return(err)
+			return
+		}
+		result, err := s.State.Image.Import(p, bytes.NewReader(params.Bundle))
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		s.updateView()
+		r.Return(ImportNodeResult{
+			ID:      result.Object.ID(),
+			Path:    result.Object.Path(),
+			Missing: result.Missing,
+			Pending: result.Pending,
+		})
+	}
+}
+
 func (s *Service) SelectNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var id string
-		err := c.Decode(&id)
-		if err != nil {
+		if err := decode(c, &id); err != nil {
 			r.Return(err)
 			return
 		}
-		s.viewState.SelectedNode = id
+		if id != "" {
+			if _, err := s.findID(id); err != nil {
+				r.Return(err)
+				return
+			}
+		}
+		s.mu.Lock()
+		sess := s.client(c.Caller).session
+		sess.selectedNode = id
+		s.sessionChanged(sess, "selectedNode", id)
+		s.mu.Unlock()
 		s.updateView()
 		r.Return(nil)
 	}
 }
 
-func (s *Service) UpdateNode() func(qrpc.Responder, *qrpc.Call) {
+func (s *Service) ExpandNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
-		var params NodeParams
-		err := c.Decode(&params)
-		if err != nil {
+		var params ExpandNodeParams
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindID(params.ID)
-		if n == nil {
+		if _, err := s.findID(params.ID); err != nil {
+			r.Return(err)
 			return
 		}
-		if params.Name != nil {
-			n.SetName(*params.Name)
+		s.mu.Lock()
+		sess := s.client(c.Caller).session
+		if params.Expanded {
+			sess.expanded[params.ID] = true
+		} else {
+			delete(sess.expanded, params.ID)
 		}
-		// if params.Active != nil {
-		// 	n.Active = *params.Active
-		// }
+		s.sessionChanged(sess, "expandedNodes", sess.expandedNodes())
+		s.mu.Unlock()
 		s.updateView()
 		r.Return(nil)
 	}
 }
 
-func (s *Service) CallMethod() func(qrpc.Responder, *qrpc.Call) {
+func (s *Service) UpdateNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
-		var path string
-		err := c.Decode(&path)
-		if err != nil {
+		var params NodeParams
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		if path == "" {
+		t := &txn{}
+		if _, err := s.updateNode(t, c.Caller, params); err != nil {
+			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindChild(path)
-		localPath := path[len(n.Path())+1:]
-		// TODO: support args+ret
-		n.CallMethod(localPath, nil, nil)
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
 }
 
+func (s *Service) CallMethod() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var path string
+		if err := decode(c, &path); err != nil {
+			r.Return(err)
+			return
+		}
+		err := s.callMethod(c.Caller, path)
+		s.updateView()
+		r.Return(err)
+	}
+}
+
+func (s *Service) callMethod(caller qrpc.Caller, path string) error {
+	n, localPath, err := s.findLocal(path)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(caller, Execute, n); err != nil {
+		return err
+	}
+	parts := strings.SplitN(localPath, "/", 2)
+	com := n.Component(parts[0])
+	if com == nil || len(parts) < 2 {
+		return Errorf(NotFound, "unable to find method: %s", path)
+	}
+	if !reflect.ValueOf(com.Pointer()).MethodByName(parts[1]).IsValid() {
+		return Errorf(NotFound, "unable to find method: %s", path)
+	}
+	// TODO: support args+ret
+	return n.CallMethod(localPath, nil, nil)
+}
+
 // func (s *Service) SetExpression() func(qrpc.Responder, *qrpc.Call) {
 // 	return func(r qrpc.Responder, c *qrpc.Call) {
 // 		var params SetValueParams
@@ -211,39 +322,16 @@ func (s *Service) CallMethod() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) SetValue() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params SetValueParams
-		err := c.Decode(&params)
-		if err != nil {
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindChild(params.Path)
-		//fmt.Println(n, params)
-		localPath := params.Path[len(n.Path())+1:]
-		switch {
-		case params.IntValue != nil:
-			n.SetField(localPath, *params.IntValue)
-		case params.RefValue != nil:
-			refPath := filepath.Dir(*params.RefValue) // TODO: support subfields
-			refNode := s.State.Root.FindChild(refPath)
-			parts := strings.SplitN(localPath, "/", 2)
-			refType := n.Component(parts[0]).FieldType(parts[1])
-			if refNode != nil {
-				typeSelector := (*params.RefValue)[len(refNode.Path())+1:]
-				c := refNode.Component(typeSelector)
-				if c != nil {
-					n.SetField(localPath, c)
-				} else {
-					// interface reference
-					ptr := reflect.New(refType)
-					refNode.ValueTo(ptr)
-					if ptr.IsValid() {
-						n.SetField(localPath, reflect.Indirect(ptr).Interface())
-					}
-				}
-			}
-		default:
-			n.SetField(localPath, params.Value)
+		t := &txn{}
+		if _, err := s.setValue(t, c.Caller, params); err != nil {
+			r.Return(err)
+			return
 		}
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
@@ -252,20 +340,16 @@ func (s *Service) SetValue() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) AppendComponent() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params AppendNodeParams
-		err := c.Decode(&params)
-		if err != nil {
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		if params.Name == "" {
+		t := &txn{}
+		if _, err := s.appendComponent(t, c.Caller, params); err != nil {
+			r.Return(err)
 			return
 		}
-		p := s.State.Root.FindID(params.ID)
-		if p == nil {
-			p = s.State.Root
-		}
-		v := library.Lookup(params.Name).New()
-		p.AppendComponent(v)
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
@@ -274,15 +358,16 @@ func (s *Service) AppendComponent() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) DeleteNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var id string
-		err := c.Decode(&id)
-		if err != nil {
+		if err := decode(c, &id); err != nil {
 			r.Return(err)
 			return
 		}
-		if id == "" {
+		t := &txn{}
+		if _, err := s.deleteNode(t, c.Caller, id); err != nil {
+			r.Return(err)
 			return
 		}
-		s.State.Root.RemoveID(id)
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
@@ -291,20 +376,16 @@ func (s *Service) DeleteNode() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) AppendNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params AppendNodeParams
-		err := c.Decode(&params)
-		if err != nil {
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		if params.Name == "" {
+		t := &txn{}
+		if _, err := s.appendNode(t, c.Caller, params); err != nil {
+			r.Return(err)
 			return
 		}
-		p := s.State.Root.FindID(params.ID)
-		if p == nil {
-			p = s.State.Root
-		}
-		n := object.New(params.Name)
-		p.AppendChild(n)
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
@@ -313,39 +394,109 @@ func (s *Service) AppendNode() func(qrpc.Responder, *qrpc.Call) {
 func (s *Service) MoveNode() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var params MoveNodeParams
-		err := c.Decode(&params)
-		if err != nil {
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		t := &txn{}
+		if _, err := s.moveNode(t, c.Caller, params); err != nil {
+			r.Return(err)
+			return
+		}
+		t.commit()
+		s.updateView()
+		r.Return(nil)
+	}
+}
+
+func (s *Service) ReparentNode() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params ReparentNodeParams
+		if err := decode(c, &params); err != nil {
 			r.Return(err)
 			return
 		}
-		n := s.State.Root.FindID(params.ID)
-		if n == nil {
+		t := &txn{}
+		if _, err := s.reparentNode(t, c.Caller, params); err != nil {
+			r.Return(err)
 			return
 		}
-		n.SetSiblingIndex(params.Index)
+		t.commit()
 		s.updateView()
 		r.Return(nil)
 	}
 }
 
+// Subscribe sends the full view state to the caller and then patches as it
+// changes. An optional session key lets several connections share selection
+// and expanded nodes.
 func (s *Service) Subscribe() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
-		s.clients[c.Caller] = "state"
+		var key string
+		// the session key is optional, older clients send nothing
+		_ = c.Decode(&key)
 		s.updateView()
+		s.mu.Lock()
+		cl := s.client(c.Caller)
+		s.joinSession(cl, key)
+		// the full state is sent once, after that clients get patches
+		s.queue(c.Caller, cl, "state", s.clientState(cl))
+		cl.subscribed = true
+		s.mu.Unlock()
 		r.Return(nil)
 	}
 }
 
+// Resync returns the full view state for clients that missed a patch.
+// Patches with a Seq up to and including the returned Seq can be dropped.
+func (s *Service) Resync() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		s.updateView()
+		s.mu.Lock()
+		cl, ok := s.clients[c.Caller]
+		if !ok {
+			// reading doesn't make a caller a client
+			cl = &client{session: s.newSession("")}
+		}
+		state := s.clientState(cl)
+		s.mu.Unlock()
+		r.Return(state)
+	}
+}
+
 func (s *Service) SelectProject() func(qrpc.Responder, *qrpc.Call) {
 	return func(r qrpc.Responder, c *qrpc.Call) {
 		var name string
-		err := c.Decode(&name)
-		if err != nil {
+		if err := decode(c, &name); err != nil {
 			r.Return(err)
 			return
 		}
-		s.viewState.CurrentProject = name
+		if name == "" {
+			r.Return(Errorf(InvalidArgument, "project name is required"))
+			return
+		}
+		s.mu.Lock()
+		sess := s.client(c.Caller).session
+		sess.currentProject = name
+		s.sessionChanged(sess, "currentProject", name)
+		s.mu.Unlock()
 		s.updateView()
 		r.Return(nil)
 	}
 }
+
+// SetBuild is called by the agent with the result of each build of the
+// workspace, so clients can show diagnostics on the objects they belong to.
+func (s *Service) SetBuild() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var result gobuild.Result
+		if err := decode(c, &result); err != nil {
+			r.Return(err)
+			return
+		}
+		s.mu.Lock()
+		s.flush(s.viewState.SetBuild(&result))
+		s.mu.Unlock()
+		r.Return(nil)
+	}
+}
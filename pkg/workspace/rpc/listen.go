@@ -0,0 +1,177 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/manifold/qtalk/golang/mux"
+	"golang.org/x/net/websocket"
+)
+
+func (s *Service) listen() (mux.Listener, error) {
+	if s.TLSCertFile != "" && s.Protocol != "websocket" && s.GatewayAddr == "" {
+		return nil, fmt.Errorf("tls is only supported for websocket and the gateway, not %q", s.Protocol)
+	}
+	switch s.Protocol {
+	case "websocket":
+		config, err := s.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		return listenWebsocket(s.ListenAddr, s.Origins, config)
+	case "unix":
+		l, err := mux.ListenUnix(s.ListenAddr)
+		if err != nil {
+			return nil, err
+		}
+		// only the owner, and the agent running as them, may connect
+		if err := os.Chmod(s.ListenAddr, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("cannot connect to %s, unknown protocol %q", s.ListenAddr, s.Protocol)
+}
+
+// trackedListener tells the service when a connection it accepted closes.
+type trackedListener struct {
+	mux.Listener
+	closed func(mux.Session)
+}
+
+func (l *trackedListener) Accept() (mux.Session, error) {
+	sess, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &trackedSession{Session: sess, closed: l.closed}, nil
+}
+
+// trackedSession is a connection that reports when it stops accepting
+// calls, which the qrpc server does until it closes. Callers on it are
+// qrpc clients with the trackedSession as their session.
+type trackedSession struct {
+	mux.Session
+	closed func(mux.Session)
+	once   sync.Once
+}
+
+func (sess *trackedSession) Accept() (mux.Channel, error) {
+	ch, err := sess.Session.Accept()
+	if err != nil {
+		sess.once.Do(func() { sess.closed(sess) })
+	}
+	return ch, err
+}
+
+// tlsConfig returns the TLS config for the service certificate, or nil if
+// there is none.
+func (s *Service) tlsConfig() (*tls.Config, error) {
+	if s.TLSCertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// listenGateway listens for HTTP gateway connections, with TLS if the
+// service has a certificate.
+func (s *Service) listenGateway() (net.Listener, error) {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", s.GatewayAddr)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	return l, nil
+}
+
+// websocketListener accepts qtalk sessions over websocket, optionally with
+// TLS. Handshakes from browser origins that are not allowed are rejected
+// before a session is started.
+type websocketListener struct {
+	net.Listener
+	accepted  chan mux.Session
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func listenWebsocket(addr string, origins []string, config *tls.Config) (*websocketListener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	wl := &websocketListener{
+		Listener: l,
+		accepted: make(chan mux.Session),
+		closed:   make(chan struct{}),
+	}
+	srv := &http.Server{
+		Handler: websocket.Server{
+			Handshake: func(c *websocket.Config, r *http.Request) error {
+				return checkOrigin(r.Header.Get("Origin"), origins)
+			},
+			Handler: func(ws *websocket.Conn) {
+				ws.PayloadType = websocket.BinaryFrame
+				sess := mux.NewSession(context.Background(), ws)
+				select {
+				case wl.accepted <- sess:
+				case <-wl.closed:
+					sess.Close()
+					return
+				}
+				sess.Wait()
+			},
+		},
+	}
+	go srv.Serve(l)
+	return wl, nil
+}
+
+func (l *websocketListener) Accept() (mux.Session, error) {
+	select {
+	case sess := <-l.accepted:
+		return sess, nil
+	case <-l.closed:
+		return nil, io.EOF
+	}
+}
+
+func (l *websocketListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.Listener.Close()
+}
+
+// checkOrigin allows requests without an origin, which don't come from a
+// browser, and requests from one of the allowed origins.
+func checkOrigin(origin string, allowed []string) error {
+	if origin == "" {
+		return nil
+	}
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin not allowed: %s", origin)
+}
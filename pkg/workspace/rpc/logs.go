@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/workspace/logs"
+)
+
+type StreamLogsParams struct {
+	Path  string
+	Level string
+}
+
+// StreamLogs streams what components of the object at Path and its
+// descendants log at Level or above over the hijacked call channel as JSON
+// lines, starting with the recent entries that are kept.
+func (s *Service) StreamLogs() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params StreamLogsParams
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		sub, history, err := s.subscribeLogs(params)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		defer s.Logs.Unsubscribe(sub)
+		ch, err := r.Hijack(nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ch.Close()
+		go func() {
+			// the client closing its end ends the stream
+			io.Copy(ioutil.Discard, ch)
+			s.Logs.Unsubscribe(sub)
+		}()
+
+		enc := json.NewEncoder(ch)
+		for _, e := range history {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		for e := range sub.C {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribeLogs returns a subscription to what the subtree selected by
+// params logs and the entries kept for it so far, none of which are also
+// sent to the subscription. It must be closed with Unsubscribe.
+func (s *Service) subscribeLogs(params StreamLogsParams) (*logs.Subscription, []logs.Entry, error) {
+	if s.Logs == nil {
+		return nil, nil, Errorf(NotFound, "logs are not captured")
+	}
+	if !logs.ValidLevel(params.Level) {
+		return nil, nil, Errorf(InvalidArgument, "unknown level: %s", params.Level)
+	}
+	n := s.State.Root
+	if params.Path != "" && params.Path != "/" {
+		var err error
+		if n, err = s.findPath(params.Path); err != nil {
+			return nil, nil, err
+		}
+	}
+	sub, history := s.Logs.SubscribeEntries(n, logs.Filter{Path: n.Path(), Level: params.Level})
+	return sub, history, nil
+}
+
+// gatewayLogs streams log entries as "log" events, like streamLogs, for the
+// path and level query parameters.
+func (s *Service) gatewayLogs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, Errorf(Internal, "streaming is not supported"))
+		return
+	}
+	caller, err := s.gatewayCaller(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.releaseCaller(caller)
+	if err := s.authorize(caller, handlerPermissions["streamLogs"], nil); err != nil {
+		writeError(w, err)
+		return
+	}
+	sub, history, err := s.subscribeLogs(StreamLogsParams{
+		Path:  r.URL.Query().Get("path"),
+		Level: r.URL.Query().Get("level"),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.Logs.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, e := range history {
+		if err := writeEvent(w, "log", e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case e := <-sub.C:
+			if err := writeEvent(w, "log", e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
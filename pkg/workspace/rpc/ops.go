@@ -0,0 +1,288 @@
+package rpc
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/workspace/view"
+)
+
+// txn collects how to undo the changes ops make so a failed batch can be
+// rolled back, and work that should only happen once the changes are kept.
+type txn struct {
+	undos   []func()
+	commits []func()
+}
+
+func (t *txn) onUndo(f func()) {
+	t.undos = append(t.undos, f)
+}
+
+func (t *txn) onCommit(f func()) {
+	t.commits = append(t.commits, f)
+}
+
+// rollback undoes changes in the reverse order they were made.
+func (t *txn) rollback() {
+	for i := len(t.undos) - 1; i >= 0; i-- {
+		t.undos[i]()
+	}
+	t.undos, t.commits = nil, nil
+}
+
+// commit keeps the changes.
+func (t *txn) commit() {
+	for _, f := range t.commits {
+		f()
+	}
+	t.undos, t.commits = nil, nil
+}
+
+// The ops below validate their params before changing anything, so a failed
+// op leaves nothing to undo. Each returns the object it created or changed.
+
+func (s *Service) appendNode(t *txn, caller qrpc.Caller, params AppendNodeParams) (manifold.Object, error) {
+	if err := validateName(params.Name); err != nil {
+		return nil, err
+	}
+	p, err := s.findParent(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, p); err != nil {
+		return nil, err
+	}
+	if err := checkSibling(p, params.Name); err != nil {
+		return nil, err
+	}
+	n := object.New(params.Name)
+	p.AppendChild(n)
+	t.onUndo(func() { p.RemoveChild(n) })
+	return n, nil
+}
+
+func (s *Service) deleteNode(t *txn, caller qrpc.Caller, id string) (manifold.Object, error) {
+	n, err := s.findID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	if n == s.State.Root {
+		return nil, Errorf(InvalidArgument, "cannot delete the root node")
+	}
+	p, idx := n.Parent(), n.SiblingIndex()
+	p.RemoveChild(n)
+	t.onUndo(func() { p.InsertChildAt(idx, n) })
+	return n, nil
+}
+
+func (s *Service) updateNode(t *txn, caller qrpc.Caller, params NodeParams) (manifold.Object, error) {
+	n, err := s.findID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	if params.Name != nil && *params.Name != n.Name() {
+		if err := validateName(*params.Name); err != nil {
+			return nil, err
+		}
+		if err := checkSibling(n.Parent(), *params.Name); err != nil {
+			return nil, err
+		}
+		old := n.Name()
+		n.SetName(*params.Name)
+		t.onUndo(func() { n.SetName(old) })
+	}
+	// if params.Active != nil {
+	// 	n.Active = *params.Active
+	// }
+	return n, nil
+}
+
+func (s *Service) moveNode(t *txn, caller qrpc.Caller, params MoveNodeParams) (manifold.Object, error) {
+	n, err := s.findID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	old := n.SiblingIndex()
+	if err := n.SetSiblingIndex(params.Index); err != nil {
+		return nil, Errorf(InvalidArgument, "%s", err)
+	}
+	t.onUndo(func() { n.SetSiblingIndex(old) })
+	return n, nil
+}
+
+func (s *Service) reparentNode(t *txn, caller qrpc.Caller, params ReparentNodeParams) (manifold.Object, error) {
+	n, err := s.findID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n == s.State.Root {
+		return nil, Errorf(InvalidArgument, "cannot move the root node")
+	}
+	p, err := s.findParent(params.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, p); err != nil {
+		return nil, err
+	}
+	for a := p; a != nil; a = a.Parent() {
+		if a == n {
+			return nil, Errorf(InvalidArgument, "cannot move %s under itself", n.Path())
+		}
+	}
+	if params.Index < 0 {
+		return nil, Errorf(InvalidArgument, "index must be >= 0, got: %d", params.Index)
+	}
+	old, idx := n.Parent(), n.SiblingIndex()
+	if p != old {
+		if err := checkSibling(p, n.Name()); err != nil {
+			return nil, err
+		}
+	}
+	// components keep pointers to each other, so references survive the move
+	old.RemoveChild(n)
+	p.InsertChildAt(params.Index, n)
+	t.onUndo(func() {
+		p.RemoveChild(n)
+		old.InsertChildAt(idx, n)
+	})
+	return n, nil
+}
+
+func (s *Service) appendComponent(t *txn, caller qrpc.Caller, params AppendNodeParams) (manifold.Object, error) {
+	if params.Name == "" {
+		return nil, Errorf(InvalidArgument, "component name is required")
+	}
+	p, err := s.findParent(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, p); err != nil {
+		return nil, err
+	}
+	rc := library.Lookup(params.Name)
+	if rc == nil {
+		return nil, Errorf(NotFound, "unknown component type: %s", params.Name)
+	}
+	com := rc.New()
+	p.AppendComponent(com)
+	t.onUndo(func() { p.RemoveComponent(com) })
+	return p, nil
+}
+
+func (s *Service) removeComponent(t *txn, caller qrpc.Caller, params RemoveComponentParams) (manifold.Object, error) {
+	n, err := s.findID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	com := n.Component(params.Component)
+	if com == nil {
+		return nil, Errorf(NotFound, "unable to find component %q on node: %s", params.Component, params.ID)
+	}
+	idx := com.Index()
+	n.RemoveComponent(com)
+	t.onUndo(func() { n.InsertComponentAt(idx, com) })
+	if com.ID() == n.ID() {
+		// the package can't be restored, so it is only removed once kept
+		t.onCommit(func() {
+			if err := s.State.Image.DestroyObjectPackage(n); err != nil {
+				fmt.Println(err)
+			}
+		})
+	}
+	return n, nil
+}
+
+func (s *Service) setValue(t *txn, caller qrpc.Caller, params SetValueParams) (manifold.Object, error) {
+	n, localPath, err := s.findLocal(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(caller, Write, n); err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(localPath, "/", 2)
+	com := n.Component(parts[0])
+	if com == nil || len(parts) < 2 {
+		return nil, Errorf(NotFound, "unable to find field: %s", params.Path)
+	}
+	fieldType := com.FieldType(parts[1])
+	if fieldType == nil {
+		return nil, Errorf(NotFound, "unable to find field: %s", params.Path)
+	}
+	var v interface{}
+	switch {
+	case params.IntValue != nil:
+		if v, err = coerceValue(*params.IntValue, fieldType); err != nil {
+			return nil, err
+		}
+	case params.RefValue != nil:
+		if v, err = s.refValue(*params.RefValue, fieldType); err != nil {
+			return nil, err
+		}
+	case params.Value == view.SecretMask:
+		// masked secret sent back unchanged
+		return n, nil
+	default:
+		if v, err = coerceValue(params.Value, fieldType); err != nil {
+			return nil, err
+		}
+	}
+	old, _, err := com.GetField(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := n.SetField(localPath, v); err != nil {
+		return nil, err
+	}
+	t.onUndo(func() { n.SetField(localPath, old) })
+	return n, nil
+}
+
+// refValue returns the value a reference path points to for a field of type
+// fieldType, either a component or a value on the node assignable to it.
+func (s *Service) refValue(ref string, fieldType reflect.Type) (interface{}, error) {
+	refPath := filepath.Dir(ref) // TODO: support subfields
+	refNode := s.State.Root.FindChild(refPath)
+	if refNode == nil {
+		return nil, Errorf(NotFound, "unable to find node: %s", refPath)
+	}
+	typeSelector := ref[len(refNode.Path())+1:]
+	if c := refNode.Component(typeSelector); c != nil {
+		switch {
+		case reflect.TypeOf(c).AssignableTo(fieldType):
+			return c, nil
+		case reflect.TypeOf(c.Pointer()).AssignableTo(fieldType):
+			return c.Pointer(), nil
+		}
+		return nil, Errorf(TypeMismatch, "%s is not assignable to %s", c.Name(), fieldType)
+	}
+	// interface reference
+	ptr := reflect.New(fieldType)
+	refNode.ValueTo(ptr)
+	if reflect.Indirect(ptr).IsZero() {
+		return nil, Errorf(TypeMismatch, "no value assignable to %s on node: %s", fieldType, refPath)
+	}
+	return reflect.Indirect(ptr).Interface(), nil
+}
@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+)
+
+// Permission is a class of operations a client may perform.
+type Permission uint8
+
+const (
+	// Read allows viewing the tree and per-client view state.
+	Read Permission = 1 << iota
+	// Write allows changing objects, components and field values.
+	Write
+	// Execute allows calling methods and reloading components.
+	Execute
+
+	All = Read | Write | Execute
+)
+
+var permissionNames = map[string]Permission{
+	"read":    Read,
+	"write":   Write,
+	"execute": Execute,
+}
+
+func (p Permission) String() string {
+	return strings.Join(splitPermissions(p), ",")
+}
+
+// handlerPermissions classifies handlers by the permission they need.
+// Handlers not listed need no permission beyond authenticating.
+var handlerPermissions = map[string]Permission{
+	"reload":          Read,
+	"subscribe":       Read,
+	"resync":          Read,
+	"selectNode":      Read,
+	"expandNode":      Read,
+	"selectProject":   Read,
+	"exportNode":      Read,
+	"auditLog":        Read,
+	"search":          Read,
+	"streamLogs":      Read,
+	"setValue":        Write,
+	"appendNode":      Write,
+	"deleteNode":      Write,
+	"updateNode":      Write,
+	"moveNode":        Write,
+	"reparentNode":    Write,
+	"appendComponent": Write,
+	"removeComponent": Write,
+	"addDelegate":     Write,
+	"importNode":      Write,
+	"batch":           Write,
+	"callMethod":      Execute,
+	"reloadComponent": Execute,
+	"repl":            All,
+	"setBuild":        All,
+}
+
+// Grant is a credential and what it allows. Paths, if set, limit Write and
+// Execute to the subtrees at those paths, such as /System/Sandbox.
+type Grant struct {
+	Name        string   `json:"name"`
+	Token       string   `json:"token"`
+	Permissions []string `json:"permissions"`
+	Paths       []string `json:"paths"`
+
+	perm Permission
+}
+
+// Permission returns the permissions of the grant.
+func (g *Grant) Permission() Permission {
+	return g.perm
+}
+
+func (g *Grant) parse() error {
+	g.perm = 0
+	for _, name := range g.Permissions {
+		p, ok := permissionNames[name]
+		if !ok {
+			return fmt.Errorf("grant %q: unknown permission %q", g.Name, name)
+		}
+		g.perm |= p
+	}
+	if g.Token == "" {
+		return fmt.Errorf("grant %q: token is required", g.Name)
+	}
+	return nil
+}
+
+// allows returns whether the grant permits p on the object, which may be
+// nil for operations that are not on an object.
+func (g *Grant) allows(p Permission, obj manifold.Object) bool {
+	if g.perm&p != p {
+		return false
+	}
+	if p&(Write|Execute) == 0 || len(g.Paths) == 0 || obj == nil {
+		return true
+	}
+	path := obj.Path()
+	for _, root := range g.Paths {
+		root = strings.TrimSuffix(root, "/")
+		if path == root || strings.HasPrefix(path, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerGrant is the grant for the token the agent issues for the workspace.
+func ownerGrant(token string) *Grant {
+	return &Grant{Name: "owner", Token: token, perm: All}
+}
+
+// LoadGrants reads a JSON list of grants from the file at path. A missing
+// file is not an error and returns no grants.
+func LoadGrants(path string) ([]*Grant, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var grants []*Grant
+	if err := json.Unmarshal(b, &grants); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for _, g := range grants {
+		if err := g.parse(); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return grants, nil
+}
+
+// grant returns the grant a caller authenticated with, or nil.
+func (s *Service) grant(caller qrpc.Caller) *Grant {
+	if !s.authRequired() {
+		return ownerGrant("")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authed[caller]
+}
+
+// authorize returns a PermissionDenied error unless the caller may perform
+// p on the object. Handlers call it for the objects they change.
+func (s *Service) authorize(caller qrpc.Caller, p Permission, obj manifold.Object) error {
+	g := s.grant(caller)
+	if g == nil {
+		return Errorf(Unauthenticated, "call authenticate with a workspace token first")
+	}
+	if !g.allows(p, obj) {
+		if obj != nil {
+			return Errorf(PermissionDenied, "%s not permitted on %s", p, obj.Path())
+		}
+		return Errorf(PermissionDenied, "%s not permitted", p)
+	}
+	return nil
+}
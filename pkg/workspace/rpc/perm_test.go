@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantAllows(t *testing.T) {
+	root := object.New("::root")
+	sys := object.New("System")
+	sandbox := object.New("Sandbox")
+	box := object.New("Box")
+	other := object.New("SandboxOther")
+	root.AppendChild(sys)
+	sys.AppendChild(sandbox)
+	sys.AppendChild(other)
+	sandbox.AppendChild(box)
+
+	viewer := &Grant{Name: "viewer", Token: "v", Permissions: []string{"read"}}
+	require.NoError(t, viewer.parse())
+	assert.True(t, viewer.allows(Read, nil))
+	assert.True(t, viewer.allows(Read, box))
+	assert.False(t, viewer.allows(Write, box))
+	assert.False(t, viewer.allows(Execute, nil))
+
+	sandboxed := &Grant{Name: "sandbox", Token: "s", Permissions: []string{"read", "write"}, Paths: []string{"/System/Sandbox/"}}
+	require.NoError(t, sandboxed.parse())
+	assert.True(t, sandboxed.allows(Read, other))
+	assert.True(t, sandboxed.allows(Write, nil))
+	assert.True(t, sandboxed.allows(Write, sandbox))
+	assert.True(t, sandboxed.allows(Write, box))
+	assert.False(t, sandboxed.allows(Write, other))
+	assert.False(t, sandboxed.allows(Write, sys))
+	assert.False(t, sandboxed.allows(Execute, box))
+
+	assert.True(t, ownerGrant("o").allows(All, other))
+}
+
+func TestLoadGrants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tractor-pkg-workspace-rpc-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "grants.json")
+	grants, err := LoadGrants(path)
+	require.NoError(t, err)
+	assert.Nil(t, grants)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[
+		{"name": "dashboard", "token": "abc", "permissions": ["read"]},
+		{"name": "ops", "token": "def", "permissions": ["read", "execute"]}
+	]`), 0600))
+	grants, err = LoadGrants(path)
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+	assert.Equal(t, Read, grants[0].Permission())
+	assert.Equal(t, Read|Execute, grants[1].Permission())
+	assert.Equal(t, "read,execute", grants[1].Permission().String())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"name": "bad", "token": "x", "permissions": ["admin"]}]`), 0600))
+	_, err = LoadGrants(path)
+	assert.Error(t, err)
+}
+
+// noHijackResponder is a responder whose channel can't be hijacked.
+type noHijackResponder struct {
+	testResponder
+}
+
+func (r *noHijackResponder) Hijack(v interface{}) (mux.Channel, error) {
+	return nil, errors.New("no channel")
+}
+
+func TestREPLPermissions(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		grant *Grant
+		code  Code
+	}{
+		{"owner", ownerGrant("owner"), ""},
+		{"all permissions", &Grant{Name: "admin", Token: "a", Permissions: []string{"read", "write", "execute"}}, ""},
+		{"read only", &Grant{Name: "viewer", Token: "v", Permissions: []string{"read"}}, PermissionDenied},
+		{"without execute", &Grant{Name: "editor", Token: "e", Permissions: []string{"read", "write"}}, PermissionDenied},
+		{"limited to paths", &Grant{Name: "sandbox", Token: "s", Permissions: []string{"read", "write", "execute"}, Paths: []string{"/a"}}, PermissionDenied},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.grant.Name != "owner" {
+				require.NoError(t, tt.grant.parse())
+			}
+			s := newTestService()
+			s.Token = "owner"
+			caller := newTestCaller()
+			s.authed[caller] = tt.grant
+
+			r := &noHijackResponder{}
+			c := &qrpc.Call{Caller: caller, Decoder: json.NewDecoder(strings.NewReader(`""`))}
+			s.handler("repl", s.REPL())(r, c)
+			if tt.code == "" {
+				// allowed, it went on to hijack the channel instead of responding
+				assert.Zero(t, r.returns)
+				return
+			}
+			assert.Equal(t, 1, r.returns)
+			err, ok := r.v.(*Error)
+			require.True(t, ok, "%#v", r.v)
+			assert.Equal(t, tt.code, err.Code)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/repl"
+)
+
+// REPL serves a REPL for Go expressions over the hijacked call channel with
+// Root and Selected, the node selected in the session with the optional key
+// passed to it, in scope. Each line is handled like a mutating call and
+// clients see its changes after it.
+func (s *Service) REPL() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		// the repl can change anything, so it isn't limited to subtrees
+		if g := s.grant(c.Caller); g != nil && len(g.Paths) > 0 {
+			r.Return(Errorf(PermissionDenied, "repl not permitted for grants limited to paths"))
+			return
+		}
+		var key string
+		// without a session key Selected is from the caller's own session
+		_ = c.Decode(&key)
+		ch, err := r.Hijack(nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ch.Close()
+
+		rp := repl.NewREPL(func(v interface{}) {
+			fmt.Fprintf(ch, "%s\n", formatValue(v))
+		})
+		rp.Prompt = "> "
+		rp.Around = func(eval func()) {
+			func() {
+				s.writeMu.Lock()
+				defer s.writeMu.Unlock()
+				if s.Audit != nil {
+					defer s.beginAudit(c.Caller, "repl", &responder{})()
+				}
+				rp.Set("Selected", s.selectedObject(c.Caller, key))
+				eval()
+			}()
+			s.updateView()
+		}
+		fmt.Fprintln(ch, "Root and Selected are in scope.")
+		if err := rp.Run(ch, ch, map[string]interface{}{"Root": s.State.Root}); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// selectedObject returns the node selected in the session with the key, or
+// in the caller's session if the key is empty, or nil.
+func (s *Service) selectedObject(caller qrpc.Caller, key string) manifold.Object {
+	var id string
+	s.mu.Lock()
+	if sess, ok := s.sessions[key]; ok && key != "" {
+		id = sess.selectedNode
+	} else if cl, ok := s.clients[caller]; ok && key == "" {
+		id = cl.session.selectedNode
+	}
+	s.mu.Unlock()
+	if id == "" {
+		return nil
+	}
+	return s.State.Root.FindID(id)
+}
+
+func formatValue(v interface{}) string {
+	switch vv := v.(type) {
+	case manifold.Object:
+		return fmt.Sprintf("Object(%s)", vv.Path())
+	case manifold.Component:
+		return fmt.Sprintf("Component(%s)", vv.Name())
+	case []manifold.Object:
+		paths := make([]string, len(vv))
+		for i, obj := range vv {
+			paths[i] = obj.Path()
+		}
+		return fmt.Sprintf("[%s]", strings.Join(paths, " "))
+	case string:
+		return fmt.Sprintf("%q", vv)
+	case error:
+		return vv.Error()
+	}
+	return fmt.Sprintf("%+v", v)
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/workspace/search"
+)
+
+// defaultSearchLimit is the number of results returned if none is given.
+const defaultSearchLimit = 50
+
+type SearchParams struct {
+	Query string
+	Limit int
+}
+
+// Search returns objects whose names, attributes, component types or field
+// values match every term of the query, best first, with highlighted
+// snippets of the matches.
+func (s *Service) Search() func(qrpc.Responder, *qrpc.Call) {
+	return func(r qrpc.Responder, c *qrpc.Call) {
+		var params SearchParams
+		if err := decode(c, &params); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(s.search(params))
+	}
+}
+
+func (s *Service) search(params SearchParams) []search.Result {
+	// pending changes are indexed before searching
+	s.updateView()
+	if params.Limit <= 0 {
+		params.Limit = defaultSearchLimit
+	}
+	return s.index.Search(params.Query, params.Limit)
+}
+
+func (s *Service) gatewaySearch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	v, err := s.gatewayCall(r, "search", func(qrpc.Caller) (interface{}, error) {
+		params := SearchParams{Query: r.URL.Query().Get("q")}
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				return nil, Errorf(InvalidArgument, "invalid limit: %s", limit)
+			}
+			params.Limit = n
+		}
+		return s.search(params), nil
+	})
+	writeResult(w, v, err)
+}
@@ -3,12 +3,22 @@ package rpc
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/manifold/qtalk/golang/mux"
 	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/debouncer"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
 	"github.com/manifold/tractor/pkg/misc/logging"
+	"github.com/manifold/tractor/pkg/misc/notify"
+	"github.com/manifold/tractor/pkg/workspace/audit"
+	"github.com/manifold/tractor/pkg/workspace/logs"
+	"github.com/manifold/tractor/pkg/workspace/search"
 	"github.com/manifold/tractor/pkg/workspace/state"
 	"github.com/manifold/tractor/pkg/workspace/view"
 )
@@ -17,65 +27,163 @@ type Service struct {
 	Protocol   string
 	ListenAddr string
 
+	// Token is required from clients before any other call if set and
+	// allows everything. Grants are additional, limited credentials.
+	Token  string
+	Grants []*Grant
+	// TLSCertFile and TLSKeyFile enable TLS for the websocket protocol.
+	TLSCertFile string
+	TLSKeyFile  string
+	// Origins are the browser origins allowed to connect over websocket.
+	Origins []string
+	// Audit records mutating calls and object changes if set.
+	Audit *audit.Log
+	// Logs captures what components log if set.
+	Logs *logs.Store
+	// GatewayAddr, if set, is the address to serve the HTTP JSON gateway on.
+	GatewayAddr string
+	// Build is the last build result of the workspace if known. The agent
+	// sends newer results with setBuild.
+	Build *gobuild.Result
+
 	Log   logging.Logger
 	State *state.Service
 
 	viewState *view.State
-	clients   map[qrpc.Caller]string
+	index     *search.Index
+	clients   map[qrpc.Caller]*client
+	sessions  map[string]*session
+	authed    map[qrpc.Caller]*Grant
 	api       qrpc.API
 	l         mux.Listener
+	gl        net.Listener
+
+	changes  []manifold.ObjectChange
+	debounce func(f func())
+	batching bool
+	mu       sync.Mutex
+	writeMu  sync.Mutex
+
+	call   *audit.Entry
+	callMu sync.Mutex
 }
 
 func (s *Service) UpdateView() {
 	s.updateView()
 }
 
+// updateView applies any object changes since the last update to the view
+// state and search index and sends the resulting patch, along with any
+// session changes, to subscribed clients. Changes made during a batch are
+// held until it ends.
 func (s *Service) updateView() {
 	if s.viewState == nil || s.State == nil {
 		return
 	}
-	// TODO: mutex, etc
-	s.viewState.Update(s.State.Root)
-	for client, callback := range s.clients {
-		_, err := client.Call(callback, s.viewState, nil)
-		if err != nil {
-			delete(s.clients, client)
-			log.Println(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batching {
+		return
+	}
+	changes := s.changes
+	s.changes = nil
+	shared := s.viewState.Apply(s.State.Root, changes)
+	s.index.Apply(changes)
+	if s.Logs != nil && removedChildren(changes) {
+		s.Logs.Forget(s.State.Root)
+	}
+	if len(shared) > 0 {
+		s.pruneSessions()
+	}
+	s.flush(shared)
+}
+
+func removedChildren(changes []manifold.ObjectChange) bool {
+	for _, change := range changes {
+		if change.Path == "::Children" && change.Old != nil {
+			return true
 		}
 	}
+	return false
+}
+
+func (s *Service) observeChange(event interface{}) {
+	change, ok := event.(manifold.ObjectChange)
+	if !ok {
+		return
+	}
+	if s.Audit != nil && change.Object != nil {
+		s.auditChange(change)
+	}
+	s.mu.Lock()
+	s.changes = append(s.changes, change)
+	s.mu.Unlock()
+	// changes made outside of RPC handlers still need to reach clients
+	s.debounce(s.updateView)
 }
 
 func (s *Service) InitializeDaemon() (err error) {
-	if s.l, err = muxListenTo(s.Protocol, s.ListenAddr); err != nil {
+	l, err := s.listen()
+	if err != nil {
 		return err
 	}
+	s.l = &trackedListener{Listener: l, closed: s.connectionClosed}
 
-	s.clients = make(map[qrpc.Caller]string)
+	s.clients = make(map[qrpc.Caller]*client)
+	s.sessions = make(map[string]*session)
+	s.authed = make(map[qrpc.Caller]*Grant)
 	s.viewState = view.New(s.State.Root)
+	if s.Build != nil {
+		s.viewState.SetBuild(s.Build)
+	}
+	s.index = search.New(s.State.Root)
+	s.debounce = debouncer.New(50 * time.Millisecond)
+	notify.Observe(s.State.Root, notify.Func(s.observeChange))
 
 	s.api = qrpc.NewAPI()
-	s.api.HandleFunc("reload", s.Reload())
-	s.api.HandleFunc("selectNode", s.SelectNode())
-	s.api.HandleFunc("removeComponent", s.RemoveComponent())
-	s.api.HandleFunc("reloadComponent", s.ReloadComponent())
-	s.api.HandleFunc("selectProject", s.SelectProject())
-	s.api.HandleFunc("moveNode", s.MoveNode())
-	s.api.HandleFunc("subscribe", s.Subscribe())
-	s.api.HandleFunc("appendNode", s.AppendNode())
-	s.api.HandleFunc("deleteNode", s.DeleteNode())
-	s.api.HandleFunc("appendComponent", s.AppendComponent())
-	s.api.HandleFunc("setValue", s.SetValue())
-	// s.api.HandleFunc("setExpression", s.SetExpression())
-	s.api.HandleFunc("callMethod", s.CallMethod())
-	s.api.HandleFunc("updateNode", s.UpdateNode())
-	s.api.HandleFunc("addDelegate", s.AddDelegate())
+	s.handle("authenticate", s.Authenticate())
+	s.handle("reload", s.Reload())
+	s.handle("selectNode", s.SelectNode())
+	s.handle("expandNode", s.ExpandNode())
+	s.handle("removeComponent", s.RemoveComponent())
+	s.handle("reloadComponent", s.ReloadComponent())
+	s.handle("selectProject", s.SelectProject())
+	s.handle("moveNode", s.MoveNode())
+	s.handle("reparentNode", s.ReparentNode())
+	s.handle("subscribe", s.Subscribe())
+	s.handle("resync", s.Resync())
+	s.handle("appendNode", s.AppendNode())
+	s.handle("deleteNode", s.DeleteNode())
+	s.handle("appendComponent", s.AppendComponent())
+	s.handle("setValue", s.SetValue())
+	// s.handle("setExpression", s.SetExpression())
+	s.handle("callMethod", s.CallMethod())
+	s.handle("updateNode", s.UpdateNode())
+	s.handle("addDelegate", s.AddDelegate())
+	s.handle("exportNode", s.ExportNode())
+	s.handle("importNode", s.ImportNode())
+	s.handle("auditLog", s.AuditLog())
+	s.handle("batch", s.Batch())
+	s.handle("repl", s.REPL())
+	s.handle("search", s.Search())
+	s.handle("streamLogs", s.StreamLogs())
+	s.handle("setBuild", s.SetBuild())
 
+	if s.GatewayAddr != "" {
+		if s.gl, err = s.listenGateway(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (s *Service) Serve(ctx context.Context) {
 	server := &qrpc.Server{}
 	s.Log.Infof("[workspace] %s://%s", s.Protocol, s.ListenAddr)
+	if s.gl != nil {
+		s.Log.Infof("[workspace] gateway http://%s", s.GatewayAddr)
+		go http.Serve(s.gl, s.Gateway())
+	}
 	if err := server.Serve(s.l, s.api); err != nil {
 		fmt.Println(err)
 	}
@@ -85,22 +193,25 @@ func (s *Service) Serve(ctx context.Context) {
 }
 
 func (s *Service) TerminateDaemon() error {
-	for client, _ := range s.clients {
-		client.Call("shutdown", nil, nil)
+	var callers []qrpc.Caller
+	s.mu.Lock()
+	for caller, cl := range s.clients {
+		if cl.subscribed {
+			callers = append(callers, caller)
+		}
+	}
+	s.mu.Unlock()
+	for _, caller := range callers {
+		caller.Call("shutdown", nil, nil)
 	}
 	if s.Protocol == "unix" {
 		os.Remove(s.ListenAddr)
 	}
-	return nil
-}
-
-func muxListenTo(proto, addr string) (mux.Listener, error) {
-	switch proto {
-	case "websocket":
-		return mux.ListenWebsocket(addr)
-	case "unix":
-		return mux.ListenUnix(addr)
+	if s.gl != nil {
+		s.gl.Close()
 	}
-
-	return nil, fmt.Errorf("cannot connect to %s, unknown protocol %q", addr, proto)
+	if s.Audit != nil {
+		return s.Audit.Close()
+	}
+	return nil
 }
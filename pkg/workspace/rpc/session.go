@@ -0,0 +1,235 @@
+package rpc
+
+import (
+	"log"
+	"sort"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/workspace/view"
+)
+
+// session is the view state that belongs to a user rather than to the
+// workspace: what they have selected, expanded and which project they are
+// in. Connections subscribing with the same key share a session, so the
+// tree and inspector of one Studio window agree on the selection.
+type session struct {
+	key            string
+	selectedNode   string
+	currentProject string
+	expanded       map[string]bool
+}
+
+func (sess *session) expandedNodes() []string {
+	ids := []string{}
+	for id := range sess.expanded {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// clientQueueSize is how many calls to a client can wait to be sent before
+// more are dropped. Clients notice a dropped patch by its Seq and resync.
+const clientQueueSize = 64
+
+// client is a connection to the workspace and the patches pending for it.
+// Sequence numbers are per client since clients see different session state.
+type client struct {
+	session    *session
+	subscribed bool
+	seq        uint64
+	ops        []view.PatchOp
+	// out holds calls to the client, made in order by send.
+	out chan clientCall
+}
+
+type clientCall struct {
+	method string
+	args   interface{}
+}
+
+// client returns the client for a caller, creating it with its own session
+// if this is the first call from it. Only calls that subscribe or change
+// session state should create clients, which are kept until the caller's
+// connection closes. Must be called with s.mu held.
+func (s *Service) client(caller qrpc.Caller) *client {
+	cl, ok := s.clients[caller]
+	if !ok {
+		cl = &client{session: s.newSession("")}
+		s.clients[caller] = cl
+	}
+	return cl
+}
+
+func (s *Service) newSession(key string) *session {
+	return &session{
+		key:            key,
+		currentProject: s.viewState.CurrentProject,
+		expanded:       make(map[string]bool),
+	}
+}
+
+// joinSession moves a client to the session with the given key, creating
+// it if no other client is using it. Must be called with s.mu held.
+func (s *Service) joinSession(cl *client, key string) {
+	if key == "" || cl.session.key == key {
+		return
+	}
+	old := cl.session
+	sess, ok := s.sessions[key]
+	if !ok {
+		sess = s.newSession(key)
+		s.sessions[key] = sess
+	}
+	cl.session = sess
+	s.releaseSession(old)
+}
+
+// releaseSession forgets a keyed session once no client is using it.
+func (s *Service) releaseSession(sess *session) {
+	if sess.key == "" {
+		return
+	}
+	for _, cl := range s.clients {
+		if cl.session == sess {
+			return
+		}
+	}
+	delete(s.sessions, sess.key)
+}
+
+// connectionClosed forgets the callers on a connection that closed, along
+// with their sessions if no one else is using them.
+func (s *Service) connectionClosed(sess mux.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for caller := range s.authed {
+		if onSession(caller, sess) {
+			delete(s.authed, caller)
+		}
+	}
+	for caller := range s.clients {
+		if onSession(caller, sess) {
+			s.dropClient(caller)
+		}
+	}
+}
+
+func onSession(caller qrpc.Caller, sess mux.Session) bool {
+	c, ok := caller.(*qrpc.Client)
+	return ok && c.Session == sess
+}
+
+// dropClient forgets a caller, usually because calling it failed.
+// Must be called with s.mu held.
+func (s *Service) dropClient(caller qrpc.Caller) {
+	delete(s.authed, caller)
+	cl, ok := s.clients[caller]
+	if !ok {
+		return
+	}
+	delete(s.clients, caller)
+	if cl.out != nil {
+		close(cl.out)
+	}
+	s.releaseSession(cl.session)
+}
+
+// queue queues a call to a client, so a slow client doesn't hold up the
+// service or other clients. Must be called with s.mu held.
+func (s *Service) queue(caller qrpc.Caller, cl *client, method string, args interface{}) {
+	if cl.out == nil {
+		cl.out = make(chan clientCall, clientQueueSize)
+		go s.send(caller, cl, cl.out)
+	}
+	select {
+	case cl.out <- clientCall{method: method, args: args}:
+	default:
+		log.Printf("dropping %s call to a client that fell behind", method)
+	}
+}
+
+// send makes the calls queued for a client until it is dropped, dropping it
+// if a call fails.
+func (s *Service) send(caller qrpc.Caller, cl *client, out chan clientCall) {
+	for call := range out {
+		if _, err := caller.Call(call.method, call.args, nil); err != nil {
+			log.Println(err)
+			s.mu.Lock()
+			if s.clients[caller] == cl {
+				s.dropClient(caller)
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// sessionChanged queues a patch op for every subscribed client of a session.
+// Must be called with s.mu held.
+func (s *Service) sessionChanged(sess *session, key string, value interface{}) {
+	op := view.PatchOp{Op: "replace", Path: "/" + key, Value: value}
+	for _, cl := range s.clients {
+		if cl.session == sess && cl.subscribed {
+			cl.ops = append(cl.ops, op)
+		}
+	}
+}
+
+// pruneSessions clears selected and expanded nodes that are no longer in
+// the tree. Must be called with s.mu held.
+func (s *Service) pruneSessions() {
+	seen := make(map[*session]bool)
+	for _, cl := range s.clients {
+		sess := cl.session
+		if seen[sess] {
+			continue
+		}
+		seen[sess] = true
+		if sess.selectedNode != "" && !s.viewState.HasNode(sess.selectedNode) {
+			sess.selectedNode = ""
+			s.sessionChanged(sess, "selectedNode", "")
+		}
+		pruned := false
+		for id := range sess.expanded {
+			if !s.viewState.HasNode(id) {
+				delete(sess.expanded, id)
+				pruned = true
+			}
+		}
+		if pruned {
+			s.sessionChanged(sess, "expandedNodes", sess.expandedNodes())
+		}
+	}
+}
+
+// flush queues pending shared and session ops for subscribed clients as one
+// patch each. Must be called with s.mu held.
+func (s *Service) flush(shared []view.PatchOp) {
+	for caller, cl := range s.clients {
+		if !cl.subscribed {
+			continue
+		}
+		ops := append(shared[:len(shared):len(shared)], cl.ops...)
+		cl.ops = nil
+		if len(ops) == 0 {
+			continue
+		}
+		cl.seq++
+		s.queue(caller, cl, "patch", view.Patch{Seq: cl.seq, Ops: ops})
+	}
+}
+
+// clientState returns the full view state as a client sees it. Pending ops
+// for the client are dropped since the state already includes them.
+// Must be called with s.mu held.
+func (s *Service) clientState(cl *client) *view.State {
+	state := s.viewState.Copy()
+	state.SelectedNode = cl.session.selectedNode
+	state.CurrentProject = cl.session.currentProject
+	state.ExpandedNodes = cl.session.expandedNodes()
+	state.Seq = cl.seq
+	cl.ops = nil
+	return state
+}
@@ -0,0 +1,191 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/manifold/qtalk/golang/mux"
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/manifold/tractor/pkg/workspace/search"
+	"github.com/manifold/tractor/pkg/workspace/state"
+	"github.com/manifold/tractor/pkg/workspace/view"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService() *Service {
+	root := object.New("::root")
+	root.AppendChild(object.New("a"))
+	return &Service{
+		State:     &state.Service{Root: root},
+		viewState: view.New(root),
+		index:     search.New(root),
+		clients:   make(map[qrpc.Caller]*client),
+		sessions:  make(map[string]*session),
+		authed:    make(map[qrpc.Caller]*Grant),
+	}
+}
+
+// testCaller records the calls made to it and fails them with err.
+type testCaller struct {
+	calls chan string
+	err   error
+}
+
+func newTestCaller() *testCaller {
+	return &testCaller{calls: make(chan string, clientQueueSize)}
+}
+
+func (c *testCaller) Call(path string, args, reply interface{}) (*qrpc.Response, error) {
+	if p, ok := args.(view.Patch); ok {
+		path = fmt.Sprintf("%s %d", path, p.Seq)
+	}
+	c.calls <- path
+	return nil, c.err
+}
+
+func (c *testCaller) next(t *testing.T) string {
+	select {
+	case call := <-c.calls:
+		return call
+	case <-time.After(time.Second):
+		require.FailNow(t, "no call made")
+		return ""
+	}
+}
+
+// testResponder keeps the value a handler returns and how many times it
+// responded.
+type testResponder struct {
+	qrpc.Responder
+	v       interface{}
+	returns int
+}
+
+func (r *testResponder) Return(v interface{}) error {
+	r.v = v
+	r.returns++
+	return nil
+}
+
+// testSession is a connection that has closed.
+type testSession struct {
+	mux.Session
+}
+
+func (sess *testSession) Accept() (mux.Channel, error) {
+	return nil, errors.New("closed")
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestService()
+	a, b := newTestCaller(), newTestCaller()
+
+	s.mu.Lock()
+	clA, clB := s.client(a), s.client(b)
+	assert.True(t, clA.session != clB.session)
+	s.joinSession(clA, "window")
+	s.joinSession(clB, "window")
+	assert.True(t, clA.session == clB.session)
+	assert.Len(t, s.sessions, 1)
+
+	s.dropClient(a)
+	assert.Len(t, s.sessions, 1)
+	s.dropClient(b)
+	assert.Empty(t, s.sessions)
+	assert.Empty(t, s.clients)
+	s.mu.Unlock()
+}
+
+func TestSelectedObject(t *testing.T) {
+	s := newTestService()
+	s.State.Root.AppendChild(object.New("b"))
+	a := s.State.Root.FindChild("a")
+	b := s.State.Root.FindChild("b")
+	window, other, repl := newTestCaller(), newTestCaller(), newTestCaller()
+
+	s.mu.Lock()
+	s.joinSession(s.client(window), "window")
+	s.client(window).session.selectedNode = a.ID()
+	s.client(other).session.selectedNode = b.ID()
+	s.mu.Unlock()
+
+	// each session has its own selection, not the last one made
+	assert.Equal(t, a, s.selectedObject(repl, "window"))
+	assert.Equal(t, b, s.selectedObject(other, ""))
+	assert.Nil(t, s.selectedObject(repl, ""))
+	assert.Nil(t, s.selectedObject(repl, "missing"))
+}
+
+func TestFlush(t *testing.T) {
+	s := newTestService()
+	subscriber, other, failing := newTestCaller(), newTestCaller(), newTestCaller()
+	failing.err = errors.New("gone")
+
+	s.mu.Lock()
+	s.client(subscriber).subscribed = true
+	s.client(other)
+	s.client(failing).subscribed = true
+	ops := []view.PatchOp{{Op: "replace", Path: "/hierarchy"}}
+	s.flush(ops)
+	s.flush(nil)
+	s.flush(ops)
+	s.mu.Unlock()
+
+	assert.Equal(t, "patch 1", subscriber.next(t))
+	assert.Equal(t, "patch 2", subscriber.next(t))
+	assert.Equal(t, "patch 1", failing.next(t))
+	assert.Empty(t, other.calls)
+
+	// a client is dropped once calling it fails
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		_, ok := s.clients[failing]
+		n := len(s.clients)
+		s.mu.Unlock()
+		if !ok {
+			assert.Equal(t, 2, n)
+			break
+		}
+		require.True(t, i < 100, "failing client was not dropped")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectionClosed(t *testing.T) {
+	s := newTestService()
+	closed := &trackedSession{Session: &testSession{}, closed: s.connectionClosed}
+	open := &trackedSession{Session: &testSession{}, closed: func(mux.Session) {}}
+	subscriber := &qrpc.Client{Session: closed}
+	authed := &qrpc.Client{Session: closed}
+	remaining := &qrpc.Client{Session: open}
+
+	s.mu.Lock()
+	s.joinSession(s.client(subscriber), "window")
+	s.authed[authed] = ownerGrant("o")
+	s.client(remaining)
+	s.mu.Unlock()
+
+	_, err := closed.Accept()
+	require.Error(t, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Len(t, s.clients, 1)
+	assert.NotNil(t, s.clients[remaining])
+	assert.Empty(t, s.authed)
+	assert.Empty(t, s.sessions)
+}
+
+func TestResyncKeepsNoClient(t *testing.T) {
+	s := newTestService()
+	caller := newTestCaller()
+	r := &testResponder{}
+	s.Resync()(r, &qrpc.Call{Caller: caller})
+	state, ok := r.v.(*view.State)
+	require.True(t, ok)
+	assert.Equal(t, []string{"/a"}, state.Hierarchy)
+	assert.Empty(t, s.clients)
+}
@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"reflect"
+	"strings"
+
+	qrpc "github.com/manifold/qtalk/golang/rpc"
+	"github.com/manifold/tractor/pkg/manifold"
+)
+
+func decode(c *qrpc.Call, v interface{}) error {
+	if err := c.Decode(v); err != nil {
+		return Errorf(InvalidArgument, "unable to decode arguments: %s", err)
+	}
+	return nil
+}
+
+func (s *Service) findID(id string) (manifold.Object, error) {
+	if id == "" {
+		return nil, Errorf(InvalidArgument, "node id is required")
+	}
+	n := s.State.Root.FindID(id)
+	if n == nil {
+		return nil, Errorf(NotFound, "unable to find node: %s", id)
+	}
+	return n, nil
+}
+
+// findParent is findID, except that an empty id is the root node.
+func (s *Service) findParent(id string) (manifold.Object, error) {
+	if id == "" {
+		return s.State.Root, nil
+	}
+	return s.findID(id)
+}
+
+func (s *Service) findPath(path string) (manifold.Object, error) {
+	if path == "" {
+		return nil, Errorf(InvalidArgument, "path is required")
+	}
+	n := s.State.Root.FindChild(path)
+	if n == nil {
+		return nil, Errorf(NotFound, "unable to find node: %s", path)
+	}
+	return n, nil
+}
+
+// findLocal returns the node for a path into one of its components and the
+// rest of the path relative to that node.
+func (s *Service) findLocal(path string) (manifold.Object, string, error) {
+	n, err := s.findPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(path) <= len(n.Path())+1 {
+		return nil, "", Errorf(InvalidArgument, "path does not reference a component: %s", path)
+	}
+	return n, path[len(n.Path())+1:], nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return Errorf(InvalidArgument, "node name is required")
+	}
+	if strings.Contains(name, "/") {
+		return Errorf(InvalidArgument, "node name cannot contain '/': %s", name)
+	}
+	return nil
+}
+
+// checkSibling returns a Conflict error if parent already has a child with
+// the given name, since paths would no longer be unique.
+func checkSibling(parent manifold.Object, name string) error {
+	if parent == nil {
+		return nil
+	}
+	for _, child := range parent.Children() {
+		if child.Name() == name {
+			return Errorf(Conflict, "node named %q already exists under %s", name, parent.Path())
+		}
+	}
+	return nil
+}
+
+// coerceValue returns v as a value that can be set on a field of type typ.
+// Numbers are converted since clients don't know the exact numeric type.
+func coerceValue(v interface{}, typ reflect.Type) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(typ) {
+		return v, nil
+	}
+	if isNumber(rv.Kind()) && isNumber(typ.Kind()) {
+		return rv.Convert(typ).Interface(), nil
+	}
+	return nil, Errorf(TypeMismatch, "cannot set %T value on field of type %s", v, typ)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,357 @@
+// Package search keeps a full-text index of the objects in a workspace tree:
+// their names, attributes, component types and field values. The index is
+// kept up to date from object changes and only re-indexes what changed.
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/workspace/view"
+)
+
+// Kinds of text a match can be in.
+const (
+	Name      = "name"
+	Attribute = "attribute"
+	Component = "component"
+	Field     = "field"
+)
+
+// weights rank matches by the kind of text they are in.
+var weights = map[string]int{
+	Name:      4,
+	Component: 3,
+	Attribute: 2,
+	Field:     2,
+}
+
+// snippetLen is the longest snippet returned before it is shortened around
+// its first highlight.
+const snippetLen = 80
+
+// Result is an object matching every term of a query.
+type Result struct {
+	ID      string  `json:"id" msgpack:"id"`
+	Path    string  `json:"path" msgpack:"path"`
+	Score   int     `json:"score" msgpack:"score"`
+	Matches []Match `json:"matches" msgpack:"matches"`
+}
+
+// Match is text of an object that matched one or more query terms, best
+// first. Highlights are the byte ranges of the terms in Snippet.
+type Match struct {
+	Kind       string   `json:"kind" msgpack:"kind"`
+	Snippet    string   `json:"snippet" msgpack:"snippet"`
+	Highlights [][2]int `json:"highlights" msgpack:"highlights"`
+
+	score int
+}
+
+// entry is searchable text of an object, such as "http.Server/Addr = :8080"
+// for a field.
+type entry struct {
+	kind  string
+	text  string
+	lower string
+}
+
+type doc struct {
+	obj     manifold.Object
+	path    string
+	entries []entry
+	// refs is set if any field shows the path of another object
+	refs bool
+}
+
+// Index is a full-text index of a tree of objects.
+type Index struct {
+	root manifold.Object
+	docs map[string]*doc
+	mu   sync.Mutex
+}
+
+// New returns an index of the tree at root.
+func New(root manifold.Object) *Index {
+	ix := &Index{
+		root: root,
+		docs: make(map[string]*doc),
+	}
+	manifold.Walk(root, func(n manifold.Object) {
+		ix.docs[n.ID()] = newDoc(n)
+	})
+	return ix
+}
+
+// Apply updates the index from object changes. Only objects that were
+// changed or added are indexed again.
+func (ix *Index) Apply(changes []manifold.ObjectChange) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	dirty := make(map[string]manifold.Object)
+	structural := false
+	for _, change := range changes {
+		if change.Object == nil {
+			continue
+		}
+		switch change.Path {
+		case "::SiblingIndex":
+		case "::Children", "::Parent":
+			structural = true
+		case "::Name":
+			structural = true
+			dirty[change.Object.ID()] = change.Object
+		default:
+			dirty[change.Object.ID()] = change.Object
+		}
+	}
+
+	if structural {
+		seen := make(map[string]bool)
+		moved := false
+		manifold.Walk(ix.root, func(n manifold.Object) {
+			id := n.ID()
+			seen[id] = true
+			d, exists := ix.docs[id]
+			switch {
+			case !exists:
+				ix.docs[id] = newDoc(n)
+				delete(dirty, id)
+			case d.path != n.Path():
+				d.path = n.Path()
+				moved = true
+			}
+		})
+		for id := range ix.docs {
+			if !seen[id] {
+				delete(ix.docs, id)
+				delete(dirty, id)
+			}
+		}
+		if moved {
+			// reference fields show the paths of the objects they point to
+			for id, d := range ix.docs {
+				if d.refs {
+					dirty[id] = d.obj
+				}
+			}
+		}
+	}
+
+	for id, n := range dirty {
+		if _, exists := ix.docs[id]; !exists || (n != ix.root && n.Root() != ix.root) {
+			// removed from the tree, or not added yet
+			continue
+		}
+		ix.docs[id] = newDoc(n)
+	}
+}
+
+// Search returns objects matching every whitespace separated term of the
+// query, ignoring case, best first. A limit above zero limits the number of
+// results.
+func (ix *Index) Search(query string, limit int) []Result {
+	terms := strings.Fields(lower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	results := []Result{}
+	for id, d := range ix.docs {
+		if r, ok := d.search(terms); ok {
+			r.ID = id
+			results = append(results, r)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (d *doc) search(terms []string) (Result, bool) {
+	r := Result{Path: d.path}
+	best := make([]int, len(terms))
+	for _, e := range d.entries {
+		m := Match{Kind: e.kind}
+		for i, term := range terms {
+			score, spans := matchTerm(e.lower, term)
+			if score == 0 {
+				continue
+			}
+			score *= weights[e.kind]
+			if score > best[i] {
+				best[i] = score
+			}
+			m.score += score
+			m.Highlights = append(m.Highlights, spans...)
+		}
+		if m.score > 0 {
+			m.Snippet, m.Highlights = snippet(e.text, m.Highlights)
+			r.Matches = append(r.Matches, m)
+		}
+	}
+	for _, score := range best {
+		if score == 0 {
+			return Result{}, false
+		}
+		r.Score += score
+	}
+	sort.SliceStable(r.Matches, func(i, j int) bool {
+		return r.Matches[i].score > r.Matches[j].score
+	})
+	return r, true
+}
+
+// matchTerm returns the spans of a term in text and how well it matches:
+// 3 if it is a whole word, 2 if it starts a word and 1 if it is inside one.
+func matchTerm(text, term string) (int, [][2]int) {
+	var spans [][2]int
+	quality := 0
+	for off := 0; ; {
+		i := strings.Index(text[off:], term)
+		if i < 0 {
+			break
+		}
+		start := off + i
+		end := start + len(term)
+		spans = append(spans, [2]int{start, end})
+		q := 1
+		if start == 0 || !isWordByte(text[start-1]) {
+			q = 2
+			if end == len(text) || !isWordByte(text[end]) {
+				q = 3
+			}
+		}
+		if q > quality {
+			quality = q
+		}
+		off = end
+	}
+	return quality, spans
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 0x80
+}
+
+// snippet returns text with its highlights sorted and merged, shortened
+// around the first highlight if the text is long.
+func snippet(text string, spans [][2]int) (string, [][2]int) {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+	var merged [][2]int
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s[0] <= merged[n-1][1] {
+			if s[1] > merged[n-1][1] {
+				merged[n-1][1] = s[1]
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	if len(text) <= snippetLen {
+		return text, merged
+	}
+
+	start := merged[0][0] - snippetLen/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLen
+	if end > len(text) {
+		end = len(text)
+	}
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "..."
+	}
+	if end < len(text) {
+		suffix = "..."
+	}
+	var shifted [][2]int
+	for _, s := range merged {
+		if s[0] >= end {
+			break
+		}
+		if s[1] > end {
+			s[1] = end
+		}
+		shifted = append(shifted, [2]int{s[0] - start + len(prefix), s[1] - start + len(prefix)})
+	}
+	return prefix + text[start:end] + suffix, shifted
+}
+
+// newDoc indexes an object as clients see it, so secret values and hidden
+// fields are never indexed.
+func newDoc(n manifold.Object) *doc {
+	d := &doc{obj: n, path: n.Path()}
+	d.add(Name, n.Name())
+	attrs := n.Snapshot().Attrs
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.add(Attribute, fmt.Sprintf("%s = %v", key, attrs[key]))
+	}
+	node := view.ExportNode(n)
+	prefix := n.Path() + "/"
+	for _, com := range node.Components {
+		d.add(Component, com.Name)
+		for _, f := range com.Fields {
+			d.addField(prefix, f)
+		}
+	}
+	return d
+}
+
+func (d *doc) addField(prefix string, f view.Field) {
+	if len(f.Fields) > 0 {
+		for _, sub := range f.Fields {
+			d.addField(prefix, sub)
+		}
+		return
+	}
+	if f.Value == nil || f.Value == "" || f.Value == view.SecretMask {
+		return
+	}
+	if strings.HasPrefix(f.Type, "reference:") {
+		d.refs = true
+	}
+	d.add(Field, fmt.Sprintf("%s = %v", strings.TrimPrefix(f.Path, prefix), f.Value))
+}
+
+func (d *doc) add(kind, text string) {
+	d.entries = append(d.entries, entry{
+		kind:  kind,
+		text:  text,
+		lower: lower(text),
+	})
+}
+
+// lower lowercases ASCII letters only, so byte offsets into the result are
+// offsets into s.
+func lower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type searchServer struct {
+	Addr     string
+	Port     int
+	Password string `tractor:"secret"`
+}
+
+func init() {
+	library.Register(&searchServer{}, "", "")
+}
+
+func newServer(t *testing.T, name string, port int) manifold.Object {
+	obj := object.New(name)
+	for _, rc := range library.Registered() {
+		if reflect.TypeOf(rc.NewValue()) == reflect.TypeOf(&searchServer{}) {
+			com := rc.New()
+			srv := com.Pointer().(*searchServer)
+			srv.Addr = "localhost"
+			srv.Port = port
+			srv.Password = "hunter2"
+			obj.AppendComponent(com)
+			return obj
+		}
+	}
+	require.FailNow(t, "component not registered")
+	return nil
+}
+
+func paths(results []Result) []string {
+	var p []string
+	for _, r := range results {
+		p = append(p, r.Path)
+	}
+	return p
+}
+
+func TestSearch(t *testing.T) {
+	root := object.New("::root")
+	web := newServer(t, "Web", 8080)
+	api := newServer(t, "API", 9090)
+	root.AppendChild(web)
+	root.AppendChild(api)
+	api.SetAttribute("owner", "platform")
+	ix := New(root)
+
+	results := ix.Search("port 8080", 0)
+	require.Equal(t, []string{"/Web"}, paths(results))
+	m := results[0].Matches[0]
+	assert.Equal(t, Field, m.Kind)
+	assert.Contains(t, m.Snippet, "/Port = 8080")
+	require.Len(t, m.Highlights, 2)
+	assert.Equal(t, "Port", m.Snippet[m.Highlights[0][0]:m.Highlights[0][1]])
+	assert.Equal(t, "8080", m.Snippet[m.Highlights[1][0]:m.Highlights[1][1]])
+
+	assert.Equal(t, []string{"/API"}, paths(ix.Search("PLATFORM", 0)))
+	assert.Empty(t, ix.Search("hunter2", 0))
+	assert.Empty(t, ix.Search("  ", 0))
+
+	// names rank above field values
+	web.Components()[0].SetField("Addr", "api.example.com")
+	ix.Apply([]manifold.ObjectChange{{Object: web, Path: web.Components()[0].Name() + "/Addr"}})
+	assert.Equal(t, []string{"/API", "/Web"}, paths(ix.Search("api", 0)))
+	assert.Len(t, ix.Search("api", 1), 1)
+
+	child := newServer(t, "Worker", 7070)
+	api.AppendChild(child)
+	api.SetName("Backend")
+	ix.Apply([]manifold.ObjectChange{
+		{Object: api, Path: "::Children", New: child},
+		{Object: api, Path: "::Name", Old: "API", New: "Backend"},
+	})
+	assert.Equal(t, []string{"/Backend/Worker"}, paths(ix.Search("7070", 0)))
+	assert.Equal(t, []string{"/Web"}, paths(ix.Search("api", 0)))
+
+	root.RemoveChild(web)
+	ix.Apply([]manifold.ObjectChange{{Object: root, Path: "::Children", Old: web}})
+	assert.Empty(t, ix.Search("8080", 0))
+}
+
+func TestSnippet(t *testing.T) {
+	text := "Config/Body = " + string(make([]byte, 100)) + "needle" + string(make([]byte, 100))
+	s, spans := snippet(text, [][2]int{{114, 120}})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "needle", s[spans[0][0]:spans[0][1]])
+	assert.Equal(t, snippetLen+6, len(s))
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/manifold/tractor/pkg/manifold"
 	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
 
 	//"github.com/manifold/tractor/pkg/repl"
 
@@ -15,51 +16,54 @@ import (
 )
 
 type Field struct {
-	Type       string      `msgpack:"type"`
-	Name       string      `msgpack:"name"`
-	Path       string      `msgpack:"path"`
-	Value      interface{} `msgpack:"value"`
-	Expression *string     `msgpack:"expression"`
-	Fields     []Field     `msgpack:"fields"`
+	Type       string      `json:"type" msgpack:"type"`
+	Name       string      `json:"name" msgpack:"name"`
+	Path       string      `json:"path" msgpack:"path"`
+	Value      interface{} `json:"value" msgpack:"value"`
+	Expression *string     `json:"expression" msgpack:"expression"`
+	Fields     []Field     `json:"fields" msgpack:"fields"`
 }
 
 type Button struct {
-	Name    string `msgpack:"name"`
-	Path    string `msgpack:"path"`
-	OnClick string `msgpack:"onclick"`
+	Name    string `json:"name" msgpack:"name"`
+	Path    string `json:"path" msgpack:"path"`
+	OnClick string `json:"onclick" msgpack:"onclick"`
 }
 
 type Component struct {
-	Name     string   `msgpack:"name"`
-	Filepath string   `msgpack:"filepath"`
-	Fields   []Field  `msgpack:"fields"`
-	Buttons  []Button `msgpack:"buttons"`
-	Related  []string `msgpack:"related"`
+	Name     string   `json:"name" msgpack:"name"`
+	Filepath string   `json:"filepath" msgpack:"filepath"`
+	Fields   []Field  `json:"fields" msgpack:"fields"`
+	Buttons  []Button `json:"buttons" msgpack:"buttons"`
+	Related  []string `json:"related" msgpack:"related"`
 }
 
 type Node struct {
-	Name       string      `msgpack:"name"`
-	Path       string      `msgpack:"path"`
-	Dir        string      `msgpack:"dir"`
-	ID         string      `msgpack:"id"`
-	Index      int         `msgpack:"index"`
-	Active     bool        `msgpack:"active"`
-	Components []Component `msgpack:"components"`
+	Name       string      `json:"name" msgpack:"name"`
+	Path       string      `json:"path" msgpack:"path"`
+	Dir        string      `json:"dir" msgpack:"dir"`
+	ID         string      `json:"id" msgpack:"id"`
+	Index      int         `json:"index" msgpack:"index"`
+	Active     bool        `json:"active" msgpack:"active"`
+	Components []Component `json:"components" msgpack:"components"`
 }
 
 type Project struct {
-	Name string `msgpack:"name"`
-	Path string `msgpack:"path"`
+	Name string `json:"name" msgpack:"name"`
+	Path string `json:"path" msgpack:"path"`
 }
 
 type State struct {
-	Projects       []Project         `msgpack:"projects"`
-	CurrentProject string            `msgpack:"currentProject"`
-	Components     []ComponentType   `msgpack:"components"`
-	Hierarchy      []string          `msgpack:"hierarchy"`
-	Nodes          map[string]Node   `msgpack:"nodes"`
-	NodePaths      map[string]string `msgpack:"nodePaths"`
-	SelectedNode   string            `msgpack:"selectedNode"`
+	Projects       []Project         `json:"projects" msgpack:"projects"`
+	CurrentProject string            `json:"currentProject" msgpack:"currentProject"`
+	Components     []ComponentType   `json:"components" msgpack:"components"`
+	Hierarchy      []string          `json:"hierarchy" msgpack:"hierarchy"`
+	Nodes          map[string]Node   `json:"nodes" msgpack:"nodes"`
+	NodePaths      map[string]string `json:"nodePaths" msgpack:"nodePaths"`
+	SelectedNode   string            `json:"selectedNode" msgpack:"selectedNode"`
+	ExpandedNodes  []string          `json:"expandedNodes" msgpack:"expandedNodes"`
+	Build          *gobuild.Result   `json:"build" msgpack:"build"`
+	Seq            uint64            `json:"seq" msgpack:"seq"`
 
 	mu sync.Mutex
 }
@@ -92,10 +96,26 @@ func exportElem(v reflected.Value, path string, idx int, n manifold.Object) (Fie
 	}
 }
 
+// SecretMask is exported in place of the value of fields tagged
+// `tractor:"secret"`. Setting a field to it leaves the value unchanged.
+const SecretMask = "********"
+
 func exportField(o reflected.Value, field, path string, n manifold.Object) Field {
 	var kind reflect.Kind
 	if o.Type().Kind() == reflect.Struct {
 		kind = o.Type().FieldType(field).Kind()
+		if strInSlice(o.Type().FieldsTagged("tractor", "secret"), field) {
+			var value string
+			if v, _ := o.Get(field).Interface().(string); v != "" {
+				value = SecretMask
+			}
+			return Field{
+				Name:  field,
+				Path:  path + "/" + field,
+				Type:  "string",
+				Value: value,
+			}
+		}
 	} else {
 		if !o.Get(field).IsValid() {
 			kind = reflect.Invalid
@@ -235,82 +255,89 @@ func strInSlice(strs []string, str string) bool {
 }
 
 func (s *State) Update(root manifold.Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.Hierarchy = []string{}
 	s.Nodes = make(map[string]Node)
+	s.NodePaths = make(map[string]string)
 	manifold.Walk(root, func(n manifold.Object) {
 		s.Hierarchy = append(s.Hierarchy, n.Path())
-		node := Node{
-			Name:   n.Name(),
-			Active: true,
-			// Dir:        n.Dir,
-			Path:       n.Path(),
-			Index:      n.SiblingIndex(),
-			ID:         n.ID(),
-			Components: []Component{},
+		s.Nodes[n.ID()] = ExportNode(n)
+		s.NodePaths[n.Path()] = n.ID()
+	})
+}
+
+// ExportNode returns a node as clients see it, with secret values masked and
+// hidden fields left out.
+func ExportNode(n manifold.Object) Node {
+	node := Node{
+		Name:   n.Name(),
+		Active: true,
+		// Dir:        n.Dir,
+		Path:       n.Path(),
+		Index:      n.SiblingIndex(),
+		ID:         n.ID(),
+		Components: []Component{},
+	}
+	for _, com := range n.Components() {
+		var fields []Field
+		c := reflected.ValueOf(com.Pointer())
+		path := n.Path() + "/" + com.Name()
+		hiddenFields := c.Type().FieldsTagged("tractor", "hidden")
+		for _, field := range c.Type().Fields() {
+			if strInSlice(hiddenFields, field) {
+				continue
+			}
+			fields = append(fields, exportField(c, field, path, n))
 		}
-		for _, com := range n.Components() {
-			var fields []Field
-			c := reflected.ValueOf(com.Pointer())
-			path := n.Path() + "/" + com.Name()
-			hiddenFields := c.Type().FieldsTagged("tractor", "hidden")
-			for _, field := range c.Type().Fields() {
-				if strInSlice(hiddenFields, field) {
+		var buttons []Button
+		p, ok := com.Pointer().(ButtonProvider)
+		if ok {
+			buttons = p.InspectorButtons()
+			for idx, button := range buttons {
+				if button.OnClick != "" {
 					continue
 				}
-				fields = append(fields, exportField(c, field, path, n))
-			}
-			var buttons []Button
-			p, ok := com.Pointer().(ButtonProvider)
-			if ok {
-				buttons = p.InspectorButtons()
-				for idx, button := range buttons {
-					if button.OnClick != "" {
+				typ := reflect.ValueOf(com.Pointer()).Type()
+				for i := 0; i < typ.NumMethod(); i++ {
+					method := typ.Method(i)
+					if method.Name != button.Name {
 						continue
 					}
-					typ := reflect.ValueOf(com.Pointer()).Type()
-					for i := 0; i < typ.NumMethod(); i++ {
-						method := typ.Method(i)
-						if method.Name != button.Name {
-							continue
-						}
-						if method.Type.NumIn() == 1 {
-							buttons[idx].Path = path + "/" + method.Name
-							break
-						}
+					if method.Type.NumIn() == 1 {
+						buttons[idx].Path = path + "/" + method.Name
+						break
 					}
 				}
 			}
+		}
 
-			var filepath string
-			if com.ID() != "" {
-				filepath = library.LookupID(com.ID()).Filepath
-			} else {
-				filepath = library.Lookup(com.Name()).Filepath
-			}
-
-			var related []string
-			for _, rc := range library.Related(library.Lookup(com.Name())) {
-				related = append(related, rc.Type.Name())
-			}
+		var filepath string
+		if com.ID() != "" {
+			filepath = library.LookupID(com.ID()).Filepath
+		} else {
+			filepath = library.Lookup(com.Name()).Filepath
+		}
 
-			node.Components = append(node.Components, Component{
-				Name:     com.Name(),
-				Filepath: filepath,
-				Fields:   fields,
-				Buttons:  buttons,
-				Related:  related,
-			})
+		var related []string
+		for _, rc := range library.Related(library.Lookup(com.Name())) {
+			related = append(related, rc.Type.Name())
 		}
-		s.mu.Lock()
-		s.Nodes[n.ID()] = node
-		s.NodePaths[n.Path()] = n.ID()
-		s.mu.Unlock()
-	})
+
+		node.Components = append(node.Components, Component{
+			Name:     com.Name(),
+			Filepath: filepath,
+			Fields:   fields,
+			Buttons:  buttons,
+			Related:  related,
+		})
+	}
+	return node
 }
 
 type ComponentType struct {
-	Filepath string `msgpack:"filepath"`
-	Name     string `msgpack:"name"`
+	Filepath string `json:"filepath" msgpack:"filepath"`
+	Name     string `json:"name" msgpack:"name"`
 }
 
 func New(root manifold.Object) *State {
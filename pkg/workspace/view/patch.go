@@ -0,0 +1,164 @@
+package view
+
+import (
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/misc/gobuild"
+	"github.com/manifold/tractor/pkg/misc/jsonpointer"
+)
+
+// PatchOp is a single change to a State. Path is a JSON pointer into the
+// msgpack or JSON encoding of State, such as /nodes/{id} or /hierarchy, and
+// Op is one of "add", "replace" or "remove" as in JSON Patch.
+type PatchOp struct {
+	Op    string      `json:"op" msgpack:"op"`
+	Path  string      `json:"path" msgpack:"path"`
+	Value interface{} `json:"value" msgpack:"value"`
+}
+
+// Patch is a set of changes that moves a client's State from sequence
+// number Seq-1 to Seq. Clients that miss a patch should resync.
+type Patch struct {
+	Seq uint64    `json:"seq" msgpack:"seq"`
+	Ops []PatchOp `json:"ops" msgpack:"ops"`
+}
+
+// Apply updates the shared tree data of the State from object changes and
+// returns the resulting operations. Only nodes that were changed, added or
+// moved are exported again.
+func (s *State) Apply(root manifold.Object, changes []manifold.ObjectChange) []PatchOp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ops []PatchOp
+
+	dirty := make(map[string]manifold.Object)
+	structural := false
+	for _, change := range changes {
+		if change.Object == nil {
+			continue
+		}
+		switch change.Path {
+		case "::Children", "::Parent", "::Name", "::SiblingIndex":
+			structural = true
+		default:
+			dirty[change.Object.ID()] = change.Object
+		}
+	}
+
+	if structural {
+		hierarchy := []string{}
+		nodePaths := make(map[string]string)
+		seen := make(map[string]bool)
+		manifold.Walk(root, func(n manifold.Object) {
+			id := n.ID()
+			hierarchy = append(hierarchy, n.Path())
+			nodePaths[n.Path()] = id
+			seen[id] = true
+			old, exists := s.Nodes[id]
+			switch {
+			case !exists:
+				node := ExportNode(n)
+				s.Nodes[id] = node
+				ops = append(ops, PatchOp{Op: "add", Path: nodePath(id), Value: node})
+				delete(dirty, id)
+			case old.Path != n.Path() || old.Name != n.Name() || old.Index != n.SiblingIndex():
+				dirty[id] = n
+			}
+		})
+		for id := range s.Nodes {
+			if !seen[id] {
+				delete(s.Nodes, id)
+				delete(dirty, id)
+				ops = append(ops, PatchOp{Op: "remove", Path: nodePath(id)})
+			}
+		}
+		if !strSliceEqual(hierarchy, s.Hierarchy) {
+			s.Hierarchy = hierarchy
+			ops = append(ops, PatchOp{Op: "replace", Path: "/hierarchy", Value: hierarchy})
+		}
+		if !strMapEqual(nodePaths, s.NodePaths) {
+			s.NodePaths = nodePaths
+			ops = append(ops, PatchOp{Op: "replace", Path: "/nodePaths", Value: nodePaths})
+		}
+	}
+
+	for id, n := range dirty {
+		if _, exists := s.Nodes[id]; !exists || n.Root() != root {
+			// removed from the tree, or not added yet
+			continue
+		}
+		node := ExportNode(n)
+		s.Nodes[id] = node
+		ops = append(ops, PatchOp{Op: "replace", Path: nodePath(id), Value: node})
+	}
+
+	return ops
+}
+
+// SetBuild sets the last build result of the workspace and returns the
+// resulting operation.
+func (s *State) SetBuild(result *gobuild.Result) []PatchOp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Build = result
+	return []PatchOp{{Op: "replace", Path: "/build", Value: result}}
+}
+
+// HasNode returns whether a node with the given ID is in the State.
+func (s *State) HasNode(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Nodes[id]
+	return ok
+}
+
+func nodePath(id string) string {
+	return "/nodes/" + jsonpointer.Escape(id)
+}
+
+func strSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func strMapEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a copy of the state that is safe to encode while the state
+// continues to be updated.
+func (s *State) Copy() *State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &State{
+		Projects:       s.Projects,
+		CurrentProject: s.CurrentProject,
+		Components:     s.Components,
+		Hierarchy:      s.Hierarchy,
+		Nodes:          make(map[string]Node, len(s.Nodes)),
+		NodePaths:      s.NodePaths,
+		SelectedNode:   s.SelectedNode,
+		ExpandedNodes:  s.ExpandedNodes,
+		Build:          s.Build,
+		Seq:            s.Seq,
+	}
+	for id, node := range s.Nodes {
+		c.Nodes[id] = node
+	}
+	return c
+}
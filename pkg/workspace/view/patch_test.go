@@ -0,0 +1,146 @@
+package view
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/manifold/tractor/pkg/manifold"
+	"github.com/manifold/tractor/pkg/manifold/library"
+	"github.com/manifold/tractor/pkg/manifold/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type patchComponent struct {
+	Label    string
+	Password string `tractor:"secret"`
+}
+
+func init() {
+	library.Register(&patchComponent{}, "", "")
+}
+
+func newPatchComponent(t *testing.T, label, password string) manifold.Component {
+	for _, rc := range library.Registered() {
+		if reflect.TypeOf(rc.NewValue()) == reflect.TypeOf(&patchComponent{}) {
+			com := rc.New()
+			v := com.Pointer().(*patchComponent)
+			v.Label = label
+			v.Password = password
+			return com
+		}
+	}
+	require.FailNow(t, "component not registered")
+	return nil
+}
+
+func opPaths(ops []PatchOp) []string {
+	var paths []string
+	for _, op := range ops {
+		paths = append(paths, op.Op+" "+op.Path)
+	}
+	return paths
+}
+
+func fieldValue(node Node, name string) interface{} {
+	for _, com := range node.Components {
+		for _, f := range com.Fields {
+			if f.Name == name {
+				return f.Value
+			}
+		}
+	}
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	root := object.New("::root")
+	a := object.New("a")
+	b := object.New("b")
+	root.AppendChild(a)
+	root.AppendChild(b)
+	a.AppendComponent(newPatchComponent(t, "first", "hunter2"))
+
+	state := New(root)
+	assert.True(t, state.HasNode(a.ID()))
+	assert.Equal(t, []string{"/a", "/b"}, state.Hierarchy)
+
+	t.Run("secrets are masked", func(t *testing.T) {
+		node := state.Copy().Nodes[a.ID()]
+		assert.Equal(t, "first", fieldValue(node, "Label"))
+		assert.Equal(t, SecretMask, fieldValue(node, "Password"))
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		assert.Empty(t, state.Apply(root, nil))
+	})
+
+	t.Run("changed field", func(t *testing.T) {
+		com := a.Components()[0]
+		com.SetField("Label", "second")
+		com.SetField("Password", "hunter3")
+		ops := state.Apply(root, []manifold.ObjectChange{{Object: a, Path: com.Name() + "/Label"}})
+		assert.Equal(t, []string{"replace /nodes/" + a.ID()}, opPaths(ops))
+		node := ops[0].Value.(Node)
+		assert.Equal(t, "second", fieldValue(node, "Label"))
+		assert.Equal(t, SecretMask, fieldValue(node, "Password"))
+	})
+
+	t.Run("add", func(t *testing.T) {
+		c := object.New("c")
+		b.AppendChild(c)
+		ops := state.Apply(root, []manifold.ObjectChange{{Object: b, Path: "::Children", New: c}})
+		assert.Equal(t, []string{
+			"add /nodes/" + c.ID(),
+			"replace /hierarchy",
+			"replace /nodePaths",
+		}, opPaths(ops))
+		assert.True(t, state.HasNode(c.ID()))
+		assert.Equal(t, []string{"/a", "/b", "/b/c"}, state.Hierarchy)
+		assert.Equal(t, c.ID(), state.NodePaths["/b/c"])
+	})
+
+	t.Run("move", func(t *testing.T) {
+		c := b.FindChild("c")
+		require.NotNil(t, c)
+		b.RemoveChild(c)
+		a.AppendChild(c)
+		ops := state.Apply(root, []manifold.ObjectChange{{Object: c, Path: "::Parent", Old: b, New: a}})
+		assert.Equal(t, []string{
+			"replace /hierarchy",
+			"replace /nodePaths",
+			"replace /nodes/" + c.ID(),
+		}, opPaths(ops))
+		assert.Equal(t, "/a/c", state.Copy().Nodes[c.ID()].Path)
+		assert.Equal(t, c.ID(), state.NodePaths["/a/c"])
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		c := a.FindChild("c")
+		require.NotNil(t, c)
+		a.RemoveChild(c)
+		ops := state.Apply(root, []manifold.ObjectChange{
+			{Object: a, Path: "::Children", Old: c},
+			// changes to removed objects are left out
+			{Object: c, Path: "patchComponent/Label"},
+		})
+		assert.Equal(t, []string{
+			"remove /nodes/" + c.ID(),
+			"replace /hierarchy",
+			"replace /nodePaths",
+		}, opPaths(ops))
+		assert.False(t, state.HasNode(c.ID()))
+		assert.Equal(t, []string{"/a", "/b"}, state.Hierarchy)
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		cp := state.Copy()
+		d := object.New("d")
+		root.AppendChild(d)
+		state.Apply(root, []manifold.ObjectChange{{Object: root, Path: "::Children", New: d}})
+		assert.True(t, state.HasNode(d.ID()))
+		_, ok := cp.Nodes[d.ID()]
+		assert.False(t, ok)
+		assert.Equal(t, []string{"/a", "/b"}, cp.Hierarchy)
+	})
+}
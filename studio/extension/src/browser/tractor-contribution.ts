@@ -39,6 +39,12 @@ export namespace TractorCommands {
         id: 'tractor:component-add',
         label: 'Add Component...'
     };
+    export const SESSION_KEY: Command = {
+        id: 'tractor:session-key'
+    };
+    export const TOKEN: Command = {
+        id: 'tractor:token'
+    };
 }
 
 export const TRACTOR_CONTEXT_MENU: MenuPath = ['tractor-context-menu'];
@@ -137,6 +143,13 @@ export class TractorContribution extends AbstractViewContribution<TractorTreeWid
         commands.registerCommand(TractorCommands.TOGGLE, {
             execute: () => super.openView({ activate: false, reveal: true })
         });
+        // lets webview plugins share this window's view session
+        commands.registerCommand(TractorCommands.SESSION_KEY, {
+            execute: () => this.tractor.sessionKey
+        });
+        commands.registerCommand(TractorCommands.TOKEN, {
+            execute: () => this.tractor.token
+        });
         commands.registerCommand(TractorCommands.DEBUG, {
             execute: () => super.openView({ activate: false, reveal: true })
         });
@@ -35,6 +35,16 @@ function scheduleRetry(fn: any) {
 	setTimeout(fn, RetryInterval);
 }
 
+function workspaceToken(): string {
+    const token = new URLSearchParams(window.location.search).get("token");
+    if (token) {
+        // keep it for reloads, Theia may rewrite the URL
+        window.sessionStorage.setItem("tractor-token", token);
+        return token;
+    }
+    return window.sessionStorage.getItem("tractor-token") || "";
+}
+
 
 @injectable()
 export class TractorService implements WidgetFactory {
@@ -63,6 +73,13 @@ export class TractorService implements WidgetFactory {
     protected api: qrpc.API;
 
     public components: any[];
+    protected state: any;
+
+    // shared by the connections of this window so they see the same selection
+    public readonly sessionKey = Math.random().toString(36).slice(2);
+
+    // issued by the agent and passed in the Studio URL
+    public readonly token = workspaceToken();
 
     protected widget?: TractorTreeWidget;
     protected readonly onDidChangeEmitter = new Emitter<ObjectNode[]>();
@@ -103,7 +120,7 @@ export class TractorService implements WidgetFactory {
         var session = new qmux.Session(conn);
         var client = new qrpc.Client(session);
         var path = new URI(this.workspace.workspace.uri).path.toString()
-        var resp = await client.call("connect", path);
+        var resp = await client.call("connect", {Name: path});
         this.connectWorkspace(resp.reply);
     }
 
@@ -129,15 +146,17 @@ export class TractorService implements WidgetFactory {
 			"serveRPC": async (r, c) => {
                 var data = await c.decode();
                 //this.logger.warn(data);
-                this.components = data.components;
-                this.refreshRegistries();
-                if (this.widget) {
-                    this.widget.setData(data);
-                    this.onDidChangeEmitter.fire(this.widget.rootObjects());
-                }
+                this.setState(data);
                 r.return();
 			}
         });
+        this.api.handle("patch", {
+			"serveRPC": async (r, c) => {
+                var patch = await c.decode();
+                r.return();
+                this.applyPatch(patch);
+			}
+        });
         this.client.serveAPI();
         if (this.widget) {
             this.widget.model.onSelectionChanged(event => {
@@ -145,8 +164,46 @@ export class TractorService implements WidgetFactory {
                 this.buildContextMenus(node as ObjectNode);
                 this.client.call("selectNode", node.id);
             });
+            this.widget.model.onExpansionChanged(node => {
+                this.client.call("expandNode", {"ID": node.id, "Expanded": node.expanded});
+            });
         }
-		await this.client.call("subscribe");
+		await this.client.call("authenticate", this.token);
+		await this.client.call("subscribe", this.sessionKey);
+    }
+
+    setState(data: any) {
+        this.state = data;
+        this.components = data.components;
+        this.refreshRegistries();
+        if (this.widget) {
+            this.widget.setData(data);
+            this.onDidChangeEmitter.fire(this.widget.rootObjects());
+        }
+    }
+
+    async applyPatch(patch: any) {
+        if (!this.state || patch.seq <= this.state.seq) {
+            return;
+        }
+        if (patch.seq !== this.state.seq + 1) {
+            // missed a patch, start over from the full state
+            var resp = await this.client.call("resync");
+            this.setState(resp.reply);
+            return;
+        }
+        patch.ops.forEach((op) => {
+            var keys = op.path.split("/").slice(1).map((k) => k.replace(/~1/g, "/").replace(/~0/g, "~"));
+            var last = keys.pop();
+            var target = keys.reduce((obj, k) => obj[k], this.state);
+            if (op.op === "remove") {
+                delete target[last];
+            } else {
+                target[last] = op.value;
+            }
+        });
+        this.state.seq = patch.seq;
+        this.setState(this.state);
     }
 
     buildContextMenus(node: ObjectNode) {
@@ -203,6 +260,10 @@ export class TractorService implements WidgetFactory {
 		this.client.call("deleteNode", id);
     }
 
+    reparentNode(id: string, parentId: string|undefined, index: number) {
+		this.client.call("reparentNode", {"ID": id, "ParentID": parentId||"", "Index": index});
+	}
+
     addComponent(component: string, nodeId: string) {
         this.client.call("appendComponent", {ID: nodeId, Name: component});
     }
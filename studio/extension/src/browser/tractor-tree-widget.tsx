@@ -133,7 +133,7 @@ export class TractorTreeWidget extends TreeWidget {
                 name: n.name,
                 iconClass: "",
                 visible: true,
-                expanded: true,
+                expanded: !data.expandedNodes || data.expandedNodes.indexOf(obj.id) !== -1,
                 absPath: obj.path,
                 selected: false,
                 relatedComponents: [...new Set(related)]
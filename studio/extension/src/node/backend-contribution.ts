@@ -17,7 +17,21 @@ export class BackendContribution implements BackendApplicationContribution {
         // TODO: separate, static port might not work later on.
         //       unfortunately, no way to hook into theia websocket
         //       without using their crazy system.
-        const wss = new ws.Server({ port: 3001 });
+        const wss = new ws.Server({
+            port: 3001,
+            // only Studio pages and its webviews may reach the agent
+            verifyClient: (info) => {
+                if (!info.origin) {
+                    return true;
+                }
+                try {
+                    const origin = new URL(info.origin);
+                    return origin.port === "3000" && (origin.hostname === "localhost" || origin.hostname.endsWith(".localhost"));
+                } catch (e) {
+                    return false;
+                }
+            }
+        });
         wss.on('connection', async function connection(ws, req) {
             var path = req.url;
             if (path === "/") {
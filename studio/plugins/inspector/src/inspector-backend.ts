@@ -74,7 +74,12 @@ class InspectorPanel {
         this._extensionPath = extensionPath;
 
         // Set the webview's initial html content
-        this._panel.webview.html = this._getHtmlForWebview(this._panel.webview);
+        Promise.all([
+            theia.commands.executeCommand<string>('tractor:session-key'),
+            theia.commands.executeCommand<string>('tractor:token')
+        ]).then(([key, token]) => {
+            this._panel.webview.html = this._getHtmlForWebview(this._panel.webview, key || "", token || "");
+        });
 
 
         // Listen for when the panel is disposed
@@ -127,7 +132,7 @@ class InspectorPanel {
     }
 
 
-    private _getHtmlForWebview(webview: theia.Webview) {
+    private _getHtmlForWebview(webview: theia.Webview, sessionKey: string, token: string) {
         const mediaPath = path.join(this._extensionPath, "media");
         const webviewUri = (filepath: string) => webview.asWebviewUri(theia.Uri.file(path.join(mediaPath, filepath)));
         const nonce = getNonce();
@@ -163,6 +168,8 @@ class InspectorPanel {
             <div id="app"></div>
             <script type="text/babel">
               window.workspacePath = "${rootPath}";
+              window.sessionKey = "${sessionKey}";
+              window.workspaceToken = "${token}";
               window.functionIcon = "${webviewUri('inspector/function-icon.png')}";
               window.rpc = undefined;
               window.theia = acquireTheiaApi();
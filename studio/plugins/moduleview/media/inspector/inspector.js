@@ -7,6 +7,20 @@ function scheduleRetry(fn) {
 	setTimeout(fn, RetryInterval);
 }
 
+function applyPatchOps(state, ops) {
+    ops.forEach((op) => {
+        var keys = op.path.split("/").slice(1).map((k) => k.replace(/~1/g, "/").replace(/~0/g, "~"));
+        var last = keys.pop();
+        var target = keys.reduce((obj, k) => obj[k], state);
+        if (op.op === "remove") {
+            delete target[last];
+        } else {
+            target[last] = op.value;
+        }
+    });
+    return state;
+}
+
 class InspectorContainer extends React.Component {
     instance = null;
 
@@ -34,7 +48,7 @@ class InspectorContainer extends React.Component {
 		}
         var session = new qmux.Session(conn);
         var client = new qrpc.Client(session);
-        var resp = await client.call("connect", window.workspacePath);
+        var resp = await client.call("connect", {Name: window.workspacePath});
         this.connectWorkspace(resp.reply);
     }
 
@@ -62,8 +76,28 @@ class InspectorContainer extends React.Component {
                 componentPaths = data.componentPaths;
                 r.return();
 			}
+        });
+        this.api.handle("patch", {
+			"serveRPC": async (r, c) => {
+                var patch = await c.decode();
+                r.return();
+                var remote = this.state.remote;
+                if (remote.seq === undefined || patch.seq <= remote.seq) {
+                    return;
+                }
+                if (patch.seq !== remote.seq + 1) {
+                    // missed a patch, start over from the full state
+                    var resp = await this.client.call("resync");
+                    this.setState({"remote": resp.reply});
+                    return;
+                }
+                remote = applyPatchOps(Object.assign({}, remote), patch.ops);
+                remote.seq = patch.seq;
+                this.setState({"remote": remote});
+			}
         });
 		this.client.serveAPI();
+		await this.client.call("authenticate", window.workspaceToken);
 		await this.client.call("subscribe");
     }
 
@@ -74,7 +74,9 @@ class ModuleViewPanel {
         this._extensionPath = extensionPath;
 
         // Set the webview's initial html content
-        this._panel.webview.html = this._getHtmlForWebview(this._panel.webview);
+        theia.commands.executeCommand<string>('tractor:token').then((token) => {
+            this._panel.webview.html = this._getHtmlForWebview(this._panel.webview, token || "");
+        });
 
 
         // Listen for when the panel is disposed
@@ -135,7 +137,7 @@ class ModuleViewPanel {
     }
 
 
-    private _getHtmlForWebview(webview: theia.Webview) {
+    private _getHtmlForWebview(webview: theia.Webview, token: string) {
         const mediaPath = path.join(this._extensionPath, "media");
         const webviewUri = (filepath: string) => webview.asWebviewUri(theia.Uri.file(path.join(mediaPath, filepath)));
         const nonce = getNonce();
@@ -171,6 +173,7 @@ class ModuleViewPanel {
             <div id="app"></div>
             <script type="text/babel">
               window.workspacePath = "${rootPath}";
+              window.workspaceToken = "${token}";
               window.functionIcon = "${webviewUri('inspector/function-icon.png')}";
               window.rpc = undefined;
               window.theia = acquireTheiaApi();